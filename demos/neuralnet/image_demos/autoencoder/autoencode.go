@@ -12,9 +12,17 @@ import (
 )
 
 const (
-	HiddenSize1 = 300
-	HiddenSize2 = 100
-	MaxSubBatch = 20
+	FilterCount1 = 16
+	FilterCount2 = 8
+	FilterSize   = 2
+	Stride       = 2
+	MaxSubBatch  = 20
+
+	// SizeMultiple is the factor by which the two strided
+	// convolutions shrink each side of an image.
+	// Images are padded so that their sides are multiples
+	// of this value.
+	SizeMultiple = Stride * Stride
 )
 
 func Autoencode(images <-chan image.Image) (neuralnet.Network, error) {
@@ -25,6 +33,8 @@ func Autoencode(images <-chan image.Image) (neuralnet.Network, error) {
 
 	width := firstImage.Bounds().Dx()
 	height := firstImage.Bounds().Dy()
+	tensorWidth := paddedSize(width)
+	tensorHeight := paddedSize(height)
 
 	log.Print("Reading images...")
 
@@ -49,30 +59,54 @@ func Autoencode(images <-chan image.Image) (neuralnet.Network, error) {
 
 	average, stddev := statisticalInfo(tensorSlices)
 
+	conv1 := &neuralnet.ConvLayer{
+		FilterCount:  FilterCount1,
+		FilterWidth:  FilterSize,
+		FilterHeight: FilterSize,
+		Stride:       Stride,
+		InputWidth:   tensorWidth,
+		InputHeight:  tensorHeight,
+		InputDepth:   3,
+	}
+	conv2 := &neuralnet.ConvLayer{
+		FilterCount:  FilterCount2,
+		FilterWidth:  FilterSize,
+		FilterHeight: FilterSize,
+		Stride:       Stride,
+		InputWidth:   conv1.OutputWidth(),
+		InputHeight:  conv1.OutputHeight(),
+		InputDepth:   conv1.OutputDepth(),
+	}
+	deconv1 := &neuralnet.DeconvLayer{
+		FilterCount:  FilterCount1,
+		FilterWidth:  FilterSize,
+		FilterHeight: FilterSize,
+		Stride:       Stride,
+		InputWidth:   conv2.OutputWidth(),
+		InputHeight:  conv2.OutputHeight(),
+		InputDepth:   conv2.OutputDepth(),
+	}
+	deconv2 := &neuralnet.DeconvLayer{
+		FilterCount:  3,
+		FilterWidth:  FilterSize,
+		FilterHeight: FilterSize,
+		Stride:       Stride,
+		InputWidth:   deconv1.OutputWidth(),
+		InputHeight:  deconv1.OutputHeight(),
+		InputDepth:   deconv1.OutputDepth(),
+	}
 	network := neuralnet.Network{
 		&neuralnet.RescaleLayer{
 			Bias:  -average,
 			Scale: 1 / stddev,
 		},
-		&neuralnet.DenseLayer{
-			InputCount:  width * height * 3,
-			OutputCount: HiddenSize1,
-		},
+		conv1,
 		neuralnet.Sigmoid{},
-		&neuralnet.DenseLayer{
-			InputCount:  HiddenSize1,
-			OutputCount: HiddenSize2,
-		},
+		conv2,
 		neuralnet.Sigmoid{},
-		&neuralnet.DenseLayer{
-			InputCount:  HiddenSize2,
-			OutputCount: HiddenSize1,
-		},
+		deconv1,
 		neuralnet.Sigmoid{},
-		&neuralnet.DenseLayer{
-			InputCount:  HiddenSize1,
-			OutputCount: width * height * 3,
-		},
+		deconv2,
 	}
 	network.Randomize()
 
@@ -10,11 +10,23 @@ import (
 	"github.com/unixpickle/weakai/neuralnet"
 )
 
+// ImageTensor converts an image to a tensor whose sides
+// are padded to multiples of SizeMultiple by repeating
+// the image's edge pixels.
 func ImageTensor(img image.Image) *neuralnet.Tensor3 {
-	res := neuralnet.NewTensor3(img.Bounds().Dx(), img.Bounds().Dy(), 3)
+	bounds := img.Bounds()
+	res := neuralnet.NewTensor3(paddedSize(bounds.Dx()), paddedSize(bounds.Dy()), 3)
 	for y := 0; y < res.Height; y++ {
+		imgY := bounds.Min.Y + y
+		if imgY >= bounds.Max.Y {
+			imgY = bounds.Max.Y - 1
+		}
 		for x := 0; x < res.Width; x++ {
-			r, g, b, _ := img.At(x+img.Bounds().Min.X, y+img.Bounds().Min.Y).RGBA()
+			imgX := bounds.Min.X + x
+			if imgX >= bounds.Max.X {
+				imgX = bounds.Max.X - 1
+			}
+			r, g, b, _ := img.At(imgX, imgY).RGBA()
 			res.Set(x, y, 0, float64(r)/65535.0)
 			res.Set(x, y, 1, float64(g)/65535.0)
 			res.Set(x, y, 2, float64(b)/65535.0)
@@ -23,11 +35,14 @@ func ImageTensor(img image.Image) *neuralnet.Tensor3 {
 	return res
 }
 
-func ImageFromTensor(t *neuralnet.Tensor3) image.Image {
-	res := image.NewRGBA(image.Rect(0, 0, t.Width, t.Height))
+// ImageFromTensor converts the top-left width by height
+// region of a tensor to an image, cropping off any
+// padding added by ImageTensor.
+func ImageFromTensor(t *neuralnet.Tensor3, width, height int) image.Image {
+	res := image.NewRGBA(image.Rect(0, 0, width, height))
 
-	for y := 0; y < t.Height; y++ {
-		for x := 0; x < t.Width; x++ {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
 			r := math.Min(math.Max(t.Get(x, y, 0), 0), 1)
 			g := math.Min(math.Max(t.Get(x, y, 1), 0), 1)
 			b := math.Min(math.Max(t.Get(x, y, 2), 0), 1)
@@ -73,3 +88,7 @@ func ReadImages(path string) (<-chan image.Image, error) {
 	}()
 	return resChan, nil
 }
+
+func paddedSize(size int) int {
+	return ((size + SizeMultiple - 1) / SizeMultiple) * SizeMultiple
+}
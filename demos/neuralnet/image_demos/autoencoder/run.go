@@ -41,16 +41,17 @@ func Run() {
 		os.Exit(1)
 	}
 
-	res := network.Apply(&autofunc.Variable{Vector: ImageTensor(inputImage).Data})
+	inTensor := ImageTensor(inputImage)
+	res := network.Apply(&autofunc.Variable{Vector: inTensor.Data})
 
 	tensor := &neuralnet.Tensor3{
-		Width:  inputImage.Bounds().Dx(),
-		Height: inputImage.Bounds().Dy(),
+		Width:  inTensor.Width,
+		Height: inTensor.Height,
 		Depth:  3,
 		Data:   res.Output(),
 	}
 
-	image := ImageFromTensor(tensor)
+	image := ImageFromTensor(tensor, inputImage.Bounds().Dx(), inputImage.Bounds().Dy())
 	outFile, err := os.Create(outputPath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/boosting"
+	"github.com/unixpickle/weakai/idtrees"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/svm"
+)
+
+// NetworkOutputs applies a function, such as a
+// neuralnet.Network, to every neuralnet.VectorSample in
+// a sample set.
+// It returns the outputs of the function along with the
+// desired outputs from the samples.
+//
+// For classifiers, the results can be converted to class
+// indices with Argmaxes.
+// For regressors, they can be passed through Flatten.
+func NetworkOutputs(f autofunc.Func, s sgd.SampleSet) (outputs, desired []linalg.Vector) {
+	for i := 0; i < s.Len(); i++ {
+		sample := s.GetSample(i).(neuralnet.VectorSample)
+		output := f.Apply(&autofunc.Variable{Vector: sample.Input})
+		outputs = append(outputs, output.Output())
+		desired = append(desired, sample.Output)
+	}
+	return
+}
+
+// Flatten concatenates a list of vectors.
+func Flatten(vecs []linalg.Vector) []float64 {
+	var res []float64
+	for _, vec := range vecs {
+		res = append(res, vec...)
+	}
+	return res
+}
+
+// SVMRatings computes the ratings that an SVM classifier
+// gives to the samples in a Problem.
+// The labels indicate which samples were positive.
+func SVMRatings(c svm.Classifier, p *svm.Problem) (scores []float64, positive []bool) {
+	for _, sample := range p.Positives {
+		scores = append(scores, c.Rating(sample))
+		positive = append(positive, true)
+	}
+	for _, sample := range p.Negatives {
+		scores = append(scores, c.Rating(sample))
+		positive = append(positive, false)
+	}
+	return
+}
+
+// BoostingRatings computes the classifications that a
+// boosting classifier (such as a *boosting.SumClassifier)
+// gives to a list of samples.
+// The labels indicate which of the desired
+// classifications are positive.
+func BoostingRatings(c boosting.Classifier, s boosting.SampleList,
+	desired linalg.Vector) (scores []float64, positive []bool) {
+	scores = c.Classify(s)
+	positive = make([]bool, len(desired))
+	for i, x := range desired {
+		positive[i] = x > 0
+	}
+	return
+}
+
+// TreePredictions classifies a list of samples using
+// the Classify method of an *idtrees.Tree or of an
+// idtrees.Forest, choosing the most likely class for each
+// sample.
+//
+// Classes are converted to indices in the returned list
+// of classes, which contains the classes of the samples
+// in the order they first appear, followed by any other
+// predicted classes in the order they are first
+// predicted.
+// If a sample's classification is empty, it is predicted
+// to be an unknown class, which is represented by a nil
+// entry at the end of the list of classes.
+func TreePredictions(classify func(idtrees.AttrMap) map[idtrees.Class]float64,
+	samples []idtrees.Sample) (predicted, actual []int, classes []idtrees.Class) {
+	indices := map[idtrees.Class]int{}
+	index := func(c idtrees.Class) int {
+		if idx, ok := indices[c]; ok {
+			return idx
+		}
+		indices[c] = len(classes)
+		classes = append(classes, c)
+		return len(classes) - 1
+	}
+	for _, sample := range samples {
+		actual = append(actual, index(sample.Class()))
+	}
+	var hasUnknown bool
+	for _, sample := range samples {
+		class, ok := mostLikelyClass(classify(sample), indices)
+		if ok {
+			predicted = append(predicted, index(class))
+		} else {
+			hasUnknown = true
+			predicted = append(predicted, -1)
+		}
+	}
+	if hasUnknown {
+		classes = append(classes, nil)
+		for i, idx := range predicted {
+			if idx == -1 {
+				predicted[i] = len(classes) - 1
+			}
+		}
+	}
+	return
+}
+
+// mostLikelyClass finds the most likely class in a
+// classification, or returns false if the classification
+// is empty.
+//
+// Ties are broken in favor of classes which already have
+// indices (choosing the lowest index), and then by the
+// classes' types and values, so that the result never
+// depends on map iteration order.
+func mostLikelyClass(probs map[idtrees.Class]float64,
+	indices map[idtrees.Class]int) (idtrees.Class, bool) {
+	var res idtrees.Class
+	var found bool
+	for class, prob := range probs {
+		if !found || prob > probs[res] ||
+			(prob == probs[res] && classBefore(class, res, indices)) {
+			res = class
+			found = true
+		}
+	}
+	return res, found
+}
+
+// classBefore determines if c1 should be preferred to c2
+// when they are equally likely.
+func classBefore(c1, c2 idtrees.Class, indices map[idtrees.Class]int) bool {
+	idx1, ok1 := indices[c1]
+	idx2, ok2 := indices[c2]
+	if ok1 && ok2 {
+		return idx1 < idx2
+	} else if ok1 != ok2 {
+		return ok1
+	}
+	return fmt.Sprintf("%T %v", c1, c1) < fmt.Sprintf("%T %v", c2, c2)
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/unixpickle/weakai/idtrees"
+	"github.com/unixpickle/weakai/svm"
+)
+
+type adapterTestSample map[idtrees.Attr]idtrees.Val
+
+func (a adapterTestSample) Attr(n idtrees.Attr) idtrees.Val {
+	return a[n]
+}
+
+func (a adapterTestSample) Class() idtrees.Class {
+	return a["class"]
+}
+
+func TestTreePredictions(t *testing.T) {
+	tree := &idtrees.Tree{
+		Attr: "color",
+		ValSplit: idtrees.ValSplit{
+			"red":  &idtrees.Tree{Classification: map[idtrees.Class]float64{"apple": 1}},
+			"blue": &idtrees.Tree{Classification: map[idtrees.Class]float64{"berry": 1}},
+			"green": &idtrees.Tree{
+				Classification: map[idtrees.Class]float64{"apple": 0.25, "lime": 0.75},
+			},
+		},
+	}
+	samples := []idtrees.Sample{
+		adapterTestSample{"color": "red", "class": "apple"},
+		adapterTestSample{"color": "green", "class": "apple"},
+		adapterTestSample{"color": "blue", "class": "berry"},
+	}
+	predicted, actual, classes := TreePredictions(tree.Classify, samples)
+	expectedClasses := []idtrees.Class{"apple", "berry", "lime"}
+	if len(classes) != len(expectedClasses) {
+		t.Fatalf("expected classes %v but got %v", expectedClasses, classes)
+	}
+	for i, c := range expectedClasses {
+		if classes[i] != c {
+			t.Fatalf("expected classes %v but got %v", expectedClasses, classes)
+		}
+	}
+	if Accuracy(predicted, actual) != 2.0/3 || predicted[1] != 2 {
+		t.Errorf("unexpected predictions %v for labels %v", predicted, actual)
+	}
+}
+
+func TestTreePredictionsDeterministic(t *testing.T) {
+	tree := &idtrees.Tree{
+		Attr: "color",
+		ValSplit: idtrees.ValSplit{
+			"red": &idtrees.Tree{
+				Classification: map[idtrees.Class]float64{
+					"plum": 0.25, "cherry": 0.375, "grape": 0.375,
+				},
+			},
+			"blue": &idtrees.Tree{
+				Classification: map[idtrees.Class]float64{
+					"fig": 0.5, "berry": 0.25, "kiwi": 0.25,
+				},
+			},
+		},
+	}
+	samples := []idtrees.Sample{
+		adapterTestSample{"color": "red", "class": "apple"},
+		adapterTestSample{"color": "blue", "class": "berry"},
+	}
+	for i := 0; i < 20; i++ {
+		predicted, _, classes := TreePredictions(tree.Classify, samples)
+		expectedClasses := []idtrees.Class{"apple", "berry", "cherry", "fig"}
+		if len(classes) != len(expectedClasses) {
+			t.Fatalf("expected classes %v but got %v", expectedClasses, classes)
+		}
+		for j, c := range expectedClasses {
+			if classes[j] != c {
+				t.Fatalf("expected classes %v but got %v", expectedClasses, classes)
+			}
+		}
+		if predicted[0] != 2 || predicted[1] != 3 {
+			t.Fatalf("unexpected predictions %v", predicted)
+		}
+	}
+}
+
+func TestSVMRatings(t *testing.T) {
+	classifier := &svm.LinearClassifier{
+		HyperplaneNormal: svm.Sample{V: []float64{1, -1}},
+		Threshold:        0.5,
+		Kernel:           svm.LinearKernel,
+	}
+	problem := &svm.Problem{
+		Positives: []svm.Sample{{V: []float64{1, 0}}, {V: []float64{0, 2}}},
+		Negatives: []svm.Sample{{V: []float64{0, 1}}},
+		Kernel:    svm.LinearKernel,
+	}
+	scores, positive := SVMRatings(classifier, problem)
+	expected := []float64{1.5, -1.5, -0.5}
+	for i, x := range expected {
+		if scores[i] != x {
+			t.Errorf("score %d: expected %f but got %f", i, x, scores[i])
+		}
+	}
+	if !positive[0] || !positive[1] || positive[2] {
+		t.Errorf("unexpected labels: %v", positive)
+	}
+	if acc := BinaryAccuracy(scores, positive); acc != 2.0/3 {
+		t.Errorf("expected accuracy %f but got %f", 2.0/3, acc)
+	}
+}
+
+func TestTreePredictionsUnknown(t *testing.T) {
+	tree := &idtrees.Tree{
+		Attr: "color",
+		ValSplit: idtrees.ValSplit{
+			"red":  &idtrees.Tree{Classification: map[idtrees.Class]float64{"apple": 1}},
+			"blue": &idtrees.Tree{Classification: map[idtrees.Class]float64{}},
+		},
+	}
+	samples := []idtrees.Sample{
+		adapterTestSample{"color": "red", "class": "apple"},
+		adapterTestSample{"color": "blue", "class": "berry"},
+	}
+	predicted, actual, classes := TreePredictions(tree.Classify, samples)
+	if len(classes) != 3 || classes[2] != nil {
+		t.Fatalf("unexpected classes %v", classes)
+	}
+	if predicted[0] != 0 || predicted[1] != 2 {
+		t.Fatalf("unexpected predictions %v", predicted)
+	}
+	matrix := NewConfusionMatrix(len(classes), predicted, actual)
+	if matrix.Accuracy() != 0.5 || matrix[1][2] != 1 {
+		t.Errorf("unexpected confusion matrix %v", matrix)
+	}
+}
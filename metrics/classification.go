@@ -0,0 +1,153 @@
+// Package metrics computes standard measures of how
+// well classifiers and regressors perform.
+//
+// Most functions in this package operate on plain
+// slices, and adapters are provided to obtain those
+// slices from the learners in this repository.
+package metrics
+
+import (
+	"math"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+const logLossEpsilon = 1e-15
+
+// Accuracy returns the fraction of predicted classes
+// which match the actual classes.
+func Accuracy(predicted, actual []int) float64 {
+	if len(predicted) != len(actual) {
+		panic("prediction count must match label count")
+	}
+	var correct int
+	for i, x := range predicted {
+		if x == actual[i] {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(actual))
+}
+
+// LogLoss returns the mean negative log probability
+// that a list of probability distributions assigns to
+// the actual classes.
+// Probabilities are clipped away from 0 to keep the
+// result finite.
+func LogLoss(probs []linalg.Vector, actual []int) float64 {
+	if len(probs) != len(actual) {
+		panic("prediction count must match label count")
+	}
+	var sum float64
+	for i, dist := range probs {
+		sum -= math.Log(math.Max(dist[actual[i]], logLossEpsilon))
+	}
+	return sum / float64(len(actual))
+}
+
+// Argmaxes returns the index of the largest component
+// of each vector.
+// This can be used to turn network outputs or one-hot
+// vectors into class indices.
+func Argmaxes(vecs []linalg.Vector) []int {
+	res := make([]int, len(vecs))
+	for i, vec := range vecs {
+		for j, x := range vec {
+			if x > vec[res[i]] {
+				res[i] = j
+			}
+		}
+	}
+	return res
+}
+
+// A ConfusionMatrix counts how often each actual class
+// is classified as each predicted class.
+// The entry at [i][j] is the number of samples of class
+// i which were classified as class j.
+type ConfusionMatrix [][]int
+
+// NewConfusionMatrix creates a ConfusionMatrix for the
+// given predicted and actual classes, which must be in
+// the range [0, classCount).
+// It panics if a class index is out of range.
+func NewConfusionMatrix(classCount int, predicted, actual []int) ConfusionMatrix {
+	if len(predicted) != len(actual) {
+		panic("prediction count must match label count")
+	}
+	res := make(ConfusionMatrix, classCount)
+	for i := range res {
+		res[i] = make([]int, classCount)
+	}
+	for i, x := range predicted {
+		if x < 0 || x >= classCount || actual[i] < 0 || actual[i] >= classCount {
+			panic("class index out of range")
+		}
+		res[actual[i]][x]++
+	}
+	return res
+}
+
+// Accuracy returns the fraction of samples which were
+// classified correctly.
+func (c ConfusionMatrix) Accuracy() float64 {
+	var correct, total int
+	for i, row := range c {
+		for j, x := range row {
+			if i == j {
+				correct += x
+			}
+			total += x
+		}
+	}
+	return float64(correct) / float64(total)
+}
+
+// Precision returns the fraction of samples classified
+// as the given class which actually belong to it.
+// It returns 0 if no samples were classified as the
+// class.
+func (c ConfusionMatrix) Precision(class int) float64 {
+	var predicted int
+	for _, row := range c {
+		predicted += row[class]
+	}
+	if predicted == 0 {
+		return 0
+	}
+	return float64(c[class][class]) / float64(predicted)
+}
+
+// Recall returns the fraction of samples of the given
+// class which were classified correctly.
+// It returns 0 if there are no samples of the class.
+func (c ConfusionMatrix) Recall(class int) float64 {
+	var actual int
+	for _, x := range c[class] {
+		actual += x
+	}
+	if actual == 0 {
+		return 0
+	}
+	return float64(c[class][class]) / float64(actual)
+}
+
+// F1 returns the harmonic mean of the precision and
+// recall for the given class.
+func (c ConfusionMatrix) F1(class int) float64 {
+	precision, recall := c.Precision(class), c.Recall(class)
+	if precision+recall == 0 {
+		return 0
+	}
+	return 2 * precision * recall / (precision + recall)
+}
+
+// MacroF1 returns the mean F1 score across all of the
+// classes.
+func (c ConfusionMatrix) MacroF1() float64 {
+	var sum float64
+	for class := range c {
+		sum += c.F1(class)
+	}
+	return sum / float64(len(c))
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestConfusionMatrix(t *testing.T) {
+	predicted := []int{0, 1, 1, 2, 2, 0, 1}
+	actual := []int{0, 1, 2, 2, 0, 0, 1}
+	matrix := NewConfusionMatrix(3, predicted, actual)
+	expected := ConfusionMatrix{
+		{2, 0, 1},
+		{0, 2, 0},
+		{0, 1, 1},
+	}
+	for i, row := range expected {
+		for j, x := range row {
+			if matrix[i][j] != x {
+				t.Fatalf("expected %v but got %v", expected, matrix)
+			}
+		}
+	}
+
+	if acc := Accuracy(predicted, actual); math.Abs(acc-5.0/7) > 1e-8 {
+		t.Errorf("expected accuracy %f but got %f", 5.0/7, acc)
+	}
+	if acc := matrix.Accuracy(); math.Abs(acc-5.0/7) > 1e-8 {
+		t.Errorf("expected matrix accuracy %f but got %f", 5.0/7, acc)
+	}
+
+	precisions := []float64{1, 2.0 / 3, 0.5}
+	recalls := []float64{2.0 / 3, 1, 0.5}
+	var f1Sum float64
+	for class := range matrix {
+		if p := matrix.Precision(class); math.Abs(p-precisions[class]) > 1e-8 {
+			t.Errorf("class %d: expected precision %f but got %f", class,
+				precisions[class], p)
+		}
+		if r := matrix.Recall(class); math.Abs(r-recalls[class]) > 1e-8 {
+			t.Errorf("class %d: expected recall %f but got %f", class, recalls[class], r)
+		}
+		f1 := 2 * precisions[class] * recalls[class] / (precisions[class] + recalls[class])
+		if actual := matrix.F1(class); math.Abs(actual-f1) > 1e-8 {
+			t.Errorf("class %d: expected F1 %f but got %f", class, f1, actual)
+		}
+		f1Sum += f1
+	}
+	if actual := matrix.MacroF1(); math.Abs(actual-f1Sum/3) > 1e-8 {
+		t.Errorf("expected macro F1 %f but got %f", f1Sum/3, actual)
+	}
+}
+
+func TestLogLoss(t *testing.T) {
+	probs := []linalg.Vector{{0.5, 0.25, 0.25}, {0.1, 0.9, 0}, {1, 0, 0}}
+	actual := LogLoss(probs, []int{0, 1, 2})
+	expected := -(math.Log(0.5) + math.Log(0.9) + math.Log(logLossEpsilon)) / 3
+	if math.Abs(actual-expected) > 1e-8 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+	if classes := Argmaxes(probs); classes[0] != 0 || classes[1] != 1 || classes[2] != 0 {
+		t.Errorf("unexpected argmaxes: %v", classes)
+	}
+}
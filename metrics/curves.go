@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+)
+
+// A CurvePoint is a point on an ROC or PR curve.
+type CurvePoint struct {
+	X float64
+	Y float64
+
+	// Threshold is the minimum score which is considered
+	// positive at this point on the curve.
+	Threshold float64
+}
+
+// BinaryAccuracy returns the fraction of samples whose
+// scores have the correct sign, where positive scores
+// indicate positive samples.
+func BinaryAccuracy(scores []float64, positive []bool) float64 {
+	if len(scores) != len(positive) {
+		panic("score count must match label count")
+	}
+	var correct int
+	for i, score := range scores {
+		if (score > 0) == positive[i] {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(scores))
+}
+
+// ROCCurve computes the receiver operating
+// characteristic curve for a binary classifier.
+// The X coordinates are false positive rates and the Y
+// coordinates are true positive rates.
+//
+// Higher scores should indicate that a sample is more
+// likely to be positive.
+// The curve starts at (0, 0) and ends at (1, 1).
+func ROCCurve(scores []float64, positive []bool) []CurvePoint {
+	posCount, negCount := countLabels(positive)
+	var res []CurvePoint
+	forEachThreshold(scores, positive, func(threshold float64, tp, fp int) {
+		res = append(res, CurvePoint{
+			X:         safeRatio(fp, negCount),
+			Y:         safeRatio(tp, posCount),
+			Threshold: threshold,
+		})
+	})
+	return res
+}
+
+// PRCurve computes the precision-recall curve for a
+// binary classifier.
+// The X coordinates are recalls and the Y coordinates
+// are precisions.
+//
+// Higher scores should indicate that a sample is more
+// likely to be positive.
+// The curve starts at a recall of 0, where the precision
+// is taken to be 1.
+func PRCurve(scores []float64, positive []bool) []CurvePoint {
+	posCount, _ := countLabels(positive)
+	var res []CurvePoint
+	forEachThreshold(scores, positive, func(threshold float64, tp, fp int) {
+		precision := 1.0
+		if tp+fp > 0 {
+			precision = float64(tp) / float64(tp+fp)
+		}
+		res = append(res, CurvePoint{
+			X:         safeRatio(tp, posCount),
+			Y:         precision,
+			Threshold: threshold,
+		})
+	})
+	return res
+}
+
+// AUC computes the area under a curve using the
+// trapezoidal rule.
+// The points must be sorted by X coordinate, as they are
+// for ROCCurve and PRCurve.
+func AUC(curve []CurvePoint) float64 {
+	var res float64
+	for i := 1; i < len(curve); i++ {
+		res += (curve[i].X - curve[i-1].X) * (curve[i].Y + curve[i-1].Y) / 2
+	}
+	return res
+}
+
+// forEachThreshold calls f for an infinite threshold,
+// which is above every score, and then for each distinct score, from highest
+// to lowest, giving the number of true and false
+// positives at each threshold.
+func forEachThreshold(scores []float64, positive []bool, f func(t float64, tp, fp int)) {
+	if len(scores) != len(positive) {
+		panic("score count must match label count")
+	}
+	indices := make([]int, len(scores))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.Sort(&scoreSorter{indices: indices, scores: scores})
+
+	var tp, fp int
+	if len(indices) > 0 {
+		f(math.Inf(1), 0, 0)
+	}
+	for i, idx := range indices {
+		if positive[idx] {
+			tp++
+		} else {
+			fp++
+		}
+		if i+1 == len(indices) || scores[indices[i+1]] != scores[idx] {
+			f(scores[idx], tp, fp)
+		}
+	}
+}
+
+func countLabels(positive []bool) (posCount, negCount int) {
+	for _, x := range positive {
+		if x {
+			posCount++
+		} else {
+			negCount++
+		}
+	}
+	return
+}
+
+func safeRatio(num, denom int) float64 {
+	if denom == 0 {
+		return 0
+	}
+	return float64(num) / float64(denom)
+}
+
+type scoreSorter struct {
+	indices []int
+	scores  []float64
+}
+
+func (s *scoreSorter) Len() int {
+	return len(s.indices)
+}
+
+func (s *scoreSorter) Less(i, j int) bool {
+	return s.scores[s.indices[i]] > s.scores[s.indices[j]]
+}
+
+func (s *scoreSorter) Swap(i, j int) {
+	s.indices[i], s.indices[j] = s.indices[j], s.indices[i]
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestROCCurve(t *testing.T) {
+	scores := []float64{0.9, 0.8, 0.8, 0.3, 0.1}
+	positive := []bool{true, true, false, true, false}
+	curve := ROCCurve(scores, positive)
+	expected := []CurvePoint{
+		{X: 0, Y: 0},
+		{X: 0, Y: 1.0 / 3},
+		{X: 0.5, Y: 2.0 / 3},
+		{X: 0.5, Y: 1},
+		{X: 1, Y: 1},
+	}
+	if len(curve) != len(expected) {
+		t.Fatalf("expected %d points but got %d", len(expected), len(curve))
+	}
+	for i, p := range expected {
+		if math.Abs(curve[i].X-p.X) > 1e-8 || math.Abs(curve[i].Y-p.Y) > 1e-8 {
+			t.Errorf("point %d: expected (%f, %f) but got (%f, %f)", i, p.X, p.Y,
+				curve[i].X, curve[i].Y)
+		}
+	}
+}
+
+func TestCurveLargeScores(t *testing.T) {
+	scores := []float64{1e17, 0}
+	positive := []bool{true, false}
+	for _, curve := range [][]CurvePoint{ROCCurve(scores, positive),
+		PRCurve(scores, positive)} {
+		if !(curve[0].Threshold > scores[0]) || curve[0].X != 0 {
+			t.Errorf("first point %+v should exclude every score", curve[0])
+		}
+	}
+}
+
+func TestROCAUC(t *testing.T) {
+	// The ROC AUC is the probability that a random positive
+	// is scored higher than a random negative, with ties
+	// counting as half.
+	for i := 0; i < 10; i++ {
+		var scores []float64
+		var positive []bool
+		for j := 0; j < 30; j++ {
+			scores = append(scores, float64(rand.Intn(10)))
+			positive = append(positive, rand.Intn(2) == 0)
+		}
+		var expected, pairs float64
+		for j, s1 := range scores {
+			for k, s2 := range scores {
+				if !positive[j] || positive[k] {
+					continue
+				}
+				pairs++
+				if s1 > s2 {
+					expected++
+				} else if s1 == s2 {
+					expected += 0.5
+				}
+			}
+		}
+		expected /= pairs
+		if actual := AUC(ROCCurve(scores, positive)); math.Abs(actual-expected) > 1e-8 {
+			t.Errorf("expected %f but got %f", expected, actual)
+		}
+	}
+}
+
+func TestPRCurve(t *testing.T) {
+	scores := []float64{0.9, 0.8, 0.7, 0.3}
+	positive := []bool{true, false, true, false}
+	curve := PRCurve(scores, positive)
+	expected := []CurvePoint{
+		{X: 0, Y: 1},
+		{X: 0.5, Y: 1},
+		{X: 0.5, Y: 0.5},
+		{X: 1, Y: 2.0 / 3},
+		{X: 1, Y: 0.5},
+	}
+	if len(curve) != len(expected) {
+		t.Fatalf("expected %d points but got %d", len(expected), len(curve))
+	}
+	for i, p := range expected {
+		if math.Abs(curve[i].X-p.X) > 1e-8 || math.Abs(curve[i].Y-p.Y) > 1e-8 {
+			t.Errorf("point %d: expected (%f, %f) but got (%f, %f)", i, p.X, p.Y,
+				curve[i].X, curve[i].Y)
+		}
+	}
+	expectedAUC := 0.5 + 0.5*(0.5+2.0/3)/2
+	if actual := AUC(curve); math.Abs(actual-expectedAUC) > 1e-8 {
+		t.Errorf("expected AUC %f but got %f", expectedAUC, actual)
+	}
+}
+
+func TestBinaryAccuracy(t *testing.T) {
+	scores := []float64{1, -2, 0.5, -0.1}
+	positive := []bool{true, true, false, false}
+	if actual := BinaryAccuracy(scores, positive); actual != 0.5 {
+		t.Errorf("expected 0.5 but got %f", actual)
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import "math"
+
+// MAE returns the mean absolute error of a list of
+// predictions.
+func MAE(predicted, actual []float64) float64 {
+	if len(predicted) != len(actual) {
+		panic("prediction count must match target count")
+	}
+	var sum float64
+	for i, x := range predicted {
+		sum += math.Abs(x - actual[i])
+	}
+	return sum / float64(len(actual))
+}
+
+// RMSE returns the root mean squared error of a list of
+// predictions.
+func RMSE(predicted, actual []float64) float64 {
+	if len(predicted) != len(actual) {
+		panic("prediction count must match target count")
+	}
+	var sum float64
+	for i, x := range predicted {
+		sum += math.Pow(x-actual[i], 2)
+	}
+	return math.Sqrt(sum / float64(len(actual)))
+}
+
+// RSquared returns the coefficient of determination of
+// a list of predictions, which is 1 minus the ratio of
+// the squared error to the variance of the targets.
+func RSquared(predicted, actual []float64) float64 {
+	if len(predicted) != len(actual) {
+		panic("prediction count must match target count")
+	}
+	var mean float64
+	for _, x := range actual {
+		mean += x
+	}
+	mean /= float64(len(actual))
+
+	var residual, total float64
+	for i, x := range actual {
+		residual += math.Pow(x-predicted[i], 2)
+		total += math.Pow(x-mean, 2)
+	}
+	return 1 - residual/total
+}
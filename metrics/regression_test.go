@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRegressionMetrics(t *testing.T) {
+	predicted := []float64{1, 2, 4, 3}
+	actual := []float64{1, 3, 3, 5}
+	if mae := MAE(predicted, actual); math.Abs(mae-1) > 1e-8 {
+		t.Errorf("expected MAE 1 but got %f", mae)
+	}
+	if rmse := RMSE(predicted, actual); math.Abs(rmse-math.Sqrt(1.5)) > 1e-8 {
+		t.Errorf("expected RMSE %f but got %f", math.Sqrt(1.5), rmse)
+	}
+	// The mean is 3, so the variance sum is 4+0+0+4.
+	if r2 := RSquared(predicted, actual); math.Abs(r2-(1-6.0/8)) > 1e-8 {
+		t.Errorf("expected R^2 %f but got %f", 1-6.0/8, r2)
+	}
+	if r2 := RSquared(actual, actual); r2 != 1 {
+		t.Errorf("expected perfect R^2 but got %f", r2)
+	}
+}
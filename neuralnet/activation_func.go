@@ -1,6 +1,9 @@
 package neuralnet
 
 import (
+	"encoding/json"
+	"math"
+
 	"github.com/unixpickle/autofunc"
 	"github.com/unixpickle/num-analysis/linalg"
 )
@@ -168,3 +171,467 @@ func (_ HyperbolicTangent) Serialize() ([]byte, error) {
 func (_ HyperbolicTangent) SerializerType() string {
 	return serializerTypeHyperbolicTangent
 }
+
+const (
+	seluScale = 1.0507009873554805
+	seluAlpha = 1.6732632423543772
+)
+
+// LeakyReLU is a Layer which acts like ReLU for positive
+// inputs, but scales negative inputs by Slope instead of
+// zeroing them out.
+// A common choice for Slope is 0.01.
+type LeakyReLU struct {
+	Slope float64
+}
+
+// DeserializeLeakyReLU deserializes a LeakyReLU.
+func DeserializeLeakyReLU(d []byte) (*LeakyReLU, error) {
+	var res LeakyReLU
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (l LeakyReLU) Apply(r autofunc.Result) autofunc.Result {
+	return l.elementwise().Apply(r)
+}
+
+func (l LeakyReLU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return l.elementwise().ApplyR(v, r)
+}
+
+func (l LeakyReLU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return l.Apply(inputs)
+}
+
+func (l LeakyReLU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return l.ApplyR(v, inputs)
+}
+
+func (l LeakyReLU) Serialize() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+func (l LeakyReLU) SerializerType() string {
+	return serializerTypeLeakyReLU
+}
+
+func (l LeakyReLU) elementwise() *elementwiseFunc {
+	return &elementwiseFunc{
+		F: func(x float64) float64 {
+			if x > 0 {
+				return x
+			}
+			return l.Slope * x
+		},
+		Deriv: func(x float64) float64 {
+			if x > 0 {
+				return 1
+			}
+			return l.Slope
+		},
+	}
+}
+
+// ELU is a Layer which applies the exponential linear
+// unit, which is x for positive x and Alpha*(exp(x)-1)
+// otherwise.
+// A common choice for Alpha is 1.
+type ELU struct {
+	Alpha float64
+}
+
+// DeserializeELU deserializes an ELU.
+func DeserializeELU(d []byte) (*ELU, error) {
+	var res ELU
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (e ELU) Apply(r autofunc.Result) autofunc.Result {
+	return eluFunc(e.Alpha, 1).Apply(r)
+}
+
+func (e ELU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return eluFunc(e.Alpha, 1).ApplyR(v, r)
+}
+
+func (e ELU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return e.Apply(inputs)
+}
+
+func (e ELU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return e.ApplyR(v, inputs)
+}
+
+func (e ELU) Serialize() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (e ELU) SerializerType() string {
+	return serializerTypeELU
+}
+
+// SELU is a Layer which applies the scaled exponential
+// linear unit from "Self-Normalizing Neural Networks".
+type SELU struct{}
+
+func (_ SELU) Apply(r autofunc.Result) autofunc.Result {
+	return eluFunc(seluAlpha, seluScale).Apply(r)
+}
+
+func (_ SELU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return eluFunc(seluAlpha, seluScale).ApplyR(v, r)
+}
+
+func (_ SELU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return SELU{}.Apply(inputs)
+}
+
+func (_ SELU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return SELU{}.ApplyR(v, inputs)
+}
+
+func (_ SELU) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ SELU) SerializerType() string {
+	return serializerTypeSELU
+}
+
+// Softplus is a Layer which applies the function
+// log(1+exp(x)), a smooth approximation of ReLU.
+type Softplus struct{}
+
+func (_ Softplus) Apply(r autofunc.Result) autofunc.Result {
+	return softplusFunc.Apply(r)
+}
+
+func (_ Softplus) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return softplusFunc.ApplyR(v, r)
+}
+
+func (_ Softplus) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return Softplus{}.Apply(inputs)
+}
+
+func (_ Softplus) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return Softplus{}.ApplyR(v, inputs)
+}
+
+func (_ Softplus) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ Softplus) SerializerType() string {
+	return serializerTypeSoftplus
+}
+
+// Swish is a Layer which applies the function
+// x*sigmoid(x).
+type Swish struct{}
+
+func (_ Swish) Apply(r autofunc.Result) autofunc.Result {
+	return swishFunc.Apply(r)
+}
+
+func (_ Swish) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return swishFunc.ApplyR(v, r)
+}
+
+func (_ Swish) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return Swish{}.Apply(inputs)
+}
+
+func (_ Swish) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return Swish{}.ApplyR(v, inputs)
+}
+
+func (_ Swish) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ Swish) SerializerType() string {
+	return serializerTypeSwish
+}
+
+// SiLU is the same as Swish, but under the name used by
+// some other frameworks.
+type SiLU struct{}
+
+func (_ SiLU) Apply(r autofunc.Result) autofunc.Result {
+	return swishFunc.Apply(r)
+}
+
+func (_ SiLU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return swishFunc.ApplyR(v, r)
+}
+
+func (_ SiLU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return SiLU{}.Apply(inputs)
+}
+
+func (_ SiLU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return SiLU{}.ApplyR(v, inputs)
+}
+
+func (_ SiLU) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ SiLU) SerializerType() string {
+	return serializerTypeSiLU
+}
+
+// GELU is a Layer which applies the Gaussian error
+// linear unit x*Phi(x), where Phi is the standard
+// normal CDF.
+type GELU struct{}
+
+func (_ GELU) Apply(r autofunc.Result) autofunc.Result {
+	return geluFunc.Apply(r)
+}
+
+func (_ GELU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return geluFunc.ApplyR(v, r)
+}
+
+func (_ GELU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return GELU{}.Apply(inputs)
+}
+
+func (_ GELU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return GELU{}.ApplyR(v, inputs)
+}
+
+func (_ GELU) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ GELU) SerializerType() string {
+	return serializerTypeGELU
+}
+
+// HardTanh is a Layer which clips its inputs to the
+// range [-1, 1].
+type HardTanh struct{}
+
+func (_ HardTanh) Apply(r autofunc.Result) autofunc.Result {
+	return hardTanhFunc.Apply(r)
+}
+
+func (_ HardTanh) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return hardTanhFunc.ApplyR(v, r)
+}
+
+func (_ HardTanh) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return HardTanh{}.Apply(inputs)
+}
+
+func (_ HardTanh) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return HardTanh{}.ApplyR(v, inputs)
+}
+
+func (_ HardTanh) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ HardTanh) SerializerType() string {
+	return serializerTypeHardTanh
+}
+
+var softplusFunc = &elementwiseFunc{
+	F: func(x float64) float64 {
+		if x > 0 {
+			return x + math.Log1p(math.Exp(-x))
+		}
+		return math.Log1p(math.Exp(x))
+	},
+	Deriv: sigmoid,
+	Deriv2: func(x float64) float64 {
+		s := sigmoid(x)
+		return s * (1 - s)
+	},
+}
+
+var swishFunc = &elementwiseFunc{
+	F: func(x float64) float64 {
+		return x * sigmoid(x)
+	},
+	Deriv: func(x float64) float64 {
+		s := sigmoid(x)
+		return s + x*s*(1-s)
+	},
+	Deriv2: func(x float64) float64 {
+		s := sigmoid(x)
+		return s * (1 - s) * (2 + x*(1-2*s))
+	},
+}
+
+var geluFunc = &elementwiseFunc{
+	F: func(x float64) float64 {
+		return x * normalCDF(x)
+	},
+	Deriv: func(x float64) float64 {
+		return normalCDF(x) + x*normalPDF(x)
+	},
+	Deriv2: func(x float64) float64 {
+		return normalPDF(x) * (2 - x*x)
+	},
+}
+
+var hardTanhFunc = &elementwiseFunc{
+	F: func(x float64) float64 {
+		return math.Max(-1, math.Min(1, x))
+	},
+	Deriv: func(x float64) float64 {
+		if x > -1 && x < 1 {
+			return 1
+		}
+		return 0
+	},
+}
+
+// eluFunc creates an elementwiseFunc for a scaled ELU.
+func eluFunc(alpha, scale float64) *elementwiseFunc {
+	return &elementwiseFunc{
+		F: func(x float64) float64 {
+			if x > 0 {
+				return scale * x
+			}
+			return scale * alpha * (math.Exp(x) - 1)
+		},
+		Deriv: func(x float64) float64 {
+			if x > 0 {
+				return scale
+			}
+			return scale * alpha * math.Exp(x)
+		},
+		Deriv2: func(x float64) float64 {
+			if x > 0 {
+				return 0
+			}
+			return scale * alpha * math.Exp(x)
+		},
+	}
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func normalCDF(x float64) float64 {
+	return 0.5 * (1 + math.Erf(x/math.Sqrt2))
+}
+
+func normalPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+// elementwiseFunc applies a scalar function to every
+// component of its input.
+type elementwiseFunc struct {
+	F     func(x float64) float64
+	Deriv func(x float64) float64
+
+	// Deriv2 is the second derivative of F.
+	// If it is nil, F is assumed to be piecewise linear.
+	Deriv2 func(x float64) float64
+}
+
+func (e *elementwiseFunc) Apply(r autofunc.Result) autofunc.Result {
+	in := r.Output()
+	res := &elementwiseResult{
+		OutputVec: make(linalg.Vector, len(in)),
+		Derivs:    make(linalg.Vector, len(in)),
+		Input:     r,
+	}
+	for i, x := range in {
+		res.OutputVec[i] = e.F(x)
+		res.Derivs[i] = e.Deriv(x)
+	}
+	return res
+}
+
+func (e *elementwiseFunc) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	in := r.Output()
+	inR := r.ROutput()
+	res := &elementwiseRResult{
+		OutputVec:  make(linalg.Vector, len(in)),
+		ROutputVec: make(linalg.Vector, len(in)),
+		Derivs:     make(linalg.Vector, len(in)),
+		Derivs2:    make(linalg.Vector, len(in)),
+		Input:      r,
+	}
+	for i, x := range in {
+		res.OutputVec[i] = e.F(x)
+		res.Derivs[i] = e.Deriv(x)
+		res.ROutputVec[i] = res.Derivs[i] * inR[i]
+		if e.Deriv2 != nil {
+			res.Derivs2[i] = e.Deriv2(x)
+		}
+	}
+	return res
+}
+
+type elementwiseResult struct {
+	OutputVec linalg.Vector
+	Derivs    linalg.Vector
+	Input     autofunc.Result
+}
+
+func (e *elementwiseResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *elementwiseResult) Constant(g autofunc.Gradient) bool {
+	return e.Input.Constant(g)
+}
+
+func (e *elementwiseResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	if e.Input.Constant(grad) {
+		return
+	}
+	for i, d := range e.Derivs {
+		upstream[i] *= d
+	}
+	e.Input.PropagateGradient(upstream, grad)
+}
+
+type elementwiseRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Derivs     linalg.Vector
+	Derivs2    linalg.Vector
+	Input      autofunc.RResult
+}
+
+func (e *elementwiseRResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *elementwiseRResult) ROutput() linalg.Vector {
+	return e.ROutputVec
+}
+
+func (e *elementwiseRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return e.Input.Constant(rg, g)
+}
+
+func (e *elementwiseRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if e.Input.Constant(rgrad, grad) {
+		return
+	}
+	inR := e.Input.ROutput()
+	for i, d := range e.Derivs {
+		upstreamR[i] = upstreamR[i]*d + upstream[i]*e.Derivs2[i]*inR[i]
+		upstream[i] *= d
+	}
+	e.Input.PropagateRGradient(upstream, upstreamR, rgrad, grad)
+}
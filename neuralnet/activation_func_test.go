@@ -0,0 +1,132 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/sgd"
+)
+
+func TestActivationOutputs(t *testing.T) {
+	inputs := []float64{-2, -0.5, 0.5, 3}
+	tests := []struct {
+		Layer    Layer
+		Expected []float64
+	}{
+		{&LeakyReLU{Slope: 0.1}, []float64{-0.2, -0.05, 0.5, 3}},
+		{&ELU{Alpha: 2}, []float64{2 * (math.Exp(-2) - 1), 2 * (math.Exp(-0.5) - 1),
+			0.5, 3}},
+		{&SELU{}, []float64{seluScale * seluAlpha * (math.Exp(-2) - 1),
+			seluScale * seluAlpha * (math.Exp(-0.5) - 1), seluScale * 0.5,
+			seluScale * 3}},
+		{&Softplus{}, []float64{math.Log(1 + math.Exp(-2)), math.Log(1 + math.Exp(-0.5)),
+			math.Log(1 + math.Exp(0.5)), math.Log(1 + math.Exp(3))}},
+		{&Swish{}, []float64{-2 / (1 + math.Exp(2)), -0.5 / (1 + math.Exp(0.5)),
+			0.5 / (1 + math.Exp(-0.5)), 3 / (1 + math.Exp(-3))}},
+		{&SiLU{}, []float64{-2 / (1 + math.Exp(2)), -0.5 / (1 + math.Exp(0.5)),
+			0.5 / (1 + math.Exp(-0.5)), 3 / (1 + math.Exp(-3))}},
+		{&GELU{}, []float64{-0.04550026389635842, -0.15426876936299344,
+			0.34573123063700656, 2.99595030590511}},
+		{&HardTanh{}, []float64{-1, -0.5, 0.5, 1}},
+		{NewPReLU(1), []float64{-0.5, -0.125, 0.5, 3}},
+	}
+	for _, test := range tests {
+		actual := test.Layer.Apply(&autofunc.Variable{Vector: inputs}).Output()
+		for i, x := range test.Expected {
+			if math.Abs(actual[i]-x) > 1e-6 {
+				t.Errorf("%T output %d: expected %f got %f", test.Layer, i, x,
+					actual[i])
+			}
+		}
+	}
+}
+
+func TestActivationRProp(t *testing.T) {
+	for _, layer := range testActivationLayers() {
+		inVar := testActivationInput(8)
+		vars := []*autofunc.Variable{inVar}
+		if l, ok := layer.(sgd.Learner); ok {
+			vars = append(l.Parameters(), inVar)
+		}
+		funcTest := &functest.RFuncTest{
+			F:     layer,
+			Vars:  vars,
+			Input: inVar,
+			RV:    randomRVector(vars),
+		}
+		funcTest.Run(t)
+	}
+}
+
+func TestActivationBatch(t *testing.T) {
+	for _, layer := range testActivationLayers() {
+		n := 3
+		inVar := testActivationInput(4 * n)
+		params := []*autofunc.Variable{inVar}
+		if l, ok := layer.(sgd.Learner); ok {
+			params = append(l.Parameters(), inVar)
+		}
+		testBatcher(t, layer.(batchFuncR), inVar, n, params)
+		rv := randomRVector(params)
+		testRBatcher(t, rv, layer.(batchFuncR), autofunc.NewRVariable(inVar, rv),
+			n, params)
+	}
+}
+
+func TestActivationSerialize(t *testing.T) {
+	for _, layer := range testActivationLayers() {
+		data, err := layer.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := serializer.GetDeserializer(layer.SerializerType())(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newLayer, ok := decoded.(Layer)
+		if !ok {
+			t.Fatalf("unexpected type: %T", decoded)
+		}
+		inVar := testActivationInput(4)
+		expected := layer.Apply(inVar).Output()
+		actual := newLayer.Apply(inVar).Output()
+		if actual.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-6 {
+			t.Errorf("%T: expected %v but got %v", layer, expected, actual)
+		}
+	}
+}
+
+func testActivationLayers() []Layer {
+	prelu := NewPReLU(2)
+	prelu.Slopes.Vector[1] = -0.3
+	return []Layer{
+		&LeakyReLU{Slope: 0.01},
+		&ELU{Alpha: 1.5},
+		&SELU{},
+		&Softplus{},
+		&Swish{},
+		&SiLU{},
+		&GELU{},
+		&HardTanh{},
+		prelu,
+	}
+}
+
+// testActivationInput generates a random input which
+// stays away from the kinks at 0, 1, and -1.
+func testActivationInput(size int) *autofunc.Variable {
+	res := make(linalg.Vector, size)
+	for i := range res {
+		x := rand.NormFloat64() * 2
+		for math.Abs(x) < 0.1 || math.Abs(math.Abs(x)-1) < 0.1 {
+			x = rand.NormFloat64() * 2
+		}
+		res[i] = x
+	}
+	return &autofunc.Variable{Vector: res}
+}
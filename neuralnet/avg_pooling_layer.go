@@ -0,0 +1,358 @@
+package neuralnet
+
+import (
+	"encoding/json"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// An AvgPoolingLayer reduces the width and height of an
+// input tensor by averaging the values in each of many
+// small two-dimensional regions in each depth layer of
+// the input tensor.
+//
+// Pools which go past the edge of the input tensor only
+// average the inputs which are inside of the tensor.
+type AvgPoolingLayer struct {
+	// XSpan indicates how many consecutive
+	// horizontal inputs correspond to a pool.
+	XSpan int
+
+	// YSpan indicates how many consecutive
+	// vertical inputs correspond to a pool.
+	YSpan int
+
+	// XStride is the horizontal distance between
+	// neighboring pools.
+	// If it is 0, XSpan is used.
+	XStride int
+
+	// YStride is the vertical distance between
+	// neighboring pools.
+	// If it is 0, YSpan is used.
+	YStride int
+
+	// InputWidth indicates the width of the
+	// layer's input tensor.
+	InputWidth int
+
+	// InputHeight indicates the height of the
+	// layer's input tensor.
+	InputHeight int
+
+	// InputDepth indicates the depth of the
+	// layer's input tensor.
+	InputDepth int
+}
+
+// DeserializeAvgPoolingLayer deserializes an AvgPoolingLayer.
+func DeserializeAvgPoolingLayer(d []byte) (*AvgPoolingLayer, error) {
+	var res AvgPoolingLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// OutputWidth returns the output tensor width.
+func (a *AvgPoolingLayer) OutputWidth() int {
+	return avgPoolingOutputSize(a.InputWidth, a.XSpan, a.xStride())
+}
+
+// OutputHeight returns the output tensor height.
+func (a *AvgPoolingLayer) OutputHeight() int {
+	return avgPoolingOutputSize(a.InputHeight, a.YSpan, a.yStride())
+}
+
+// Apply applies the layer to an input, which is treated
+// as a tensor.
+func (a *AvgPoolingLayer) Apply(in autofunc.Result) autofunc.Result {
+	return a.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (a *AvgPoolingLayer) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return a.BatchR(rv, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (a *AvgPoolingLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	a.checkInput(in.Output(), n)
+	return &avgPoolingResult{
+		OutputVec: a.forward(in.Output(), n),
+		Input:     in,
+		N:         n,
+		Layer:     a,
+	}
+}
+
+// BatchR is like Batch, but for RResults.
+func (a *AvgPoolingLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	a.checkInput(in.Output(), n)
+	return &avgPoolingRResult{
+		OutputVec:  a.forward(in.Output(), n),
+		ROutputVec: a.forward(in.ROutput(), n),
+		Input:      in,
+		N:          n,
+		Layer:      a,
+	}
+}
+
+// Serialize serializes the layer.
+func (a *AvgPoolingLayer) Serialize() ([]byte, error) {
+	return json.Marshal(a)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (a *AvgPoolingLayer) SerializerType() string {
+	return serializerTypeAvgPoolingLayer
+}
+
+func (a *AvgPoolingLayer) xStride() int {
+	if a.XStride == 0 {
+		return a.XSpan
+	}
+	return a.XStride
+}
+
+func (a *AvgPoolingLayer) yStride() int {
+	if a.YStride == 0 {
+		return a.YSpan
+	}
+	return a.YStride
+}
+
+func (a *AvgPoolingLayer) checkInput(in linalg.Vector, n int) {
+	if len(in) != n*a.InputWidth*a.InputHeight*a.InputDepth {
+		panic("invalid input size")
+	}
+}
+
+func (a *AvgPoolingLayer) forward(in linalg.Vector, n int) linalg.Vector {
+	inSize := a.InputWidth * a.InputHeight * a.InputDepth
+	outSize := a.OutputWidth() * a.OutputHeight() * a.InputDepth
+	res := make(linalg.Vector, outSize*n)
+	for i := 0; i < n; i++ {
+		inTensor := a.inputTensor(in[i*inSize : (i+1)*inSize])
+		outTensor := a.outputTensor(res[i*outSize : (i+1)*outSize])
+		a.evaluate(inTensor, outTensor)
+	}
+	return res
+}
+
+func (a *AvgPoolingLayer) backward(upstream linalg.Vector, n int) linalg.Vector {
+	inSize := a.InputWidth * a.InputHeight * a.InputDepth
+	outSize := a.OutputWidth() * a.OutputHeight() * a.InputDepth
+	res := make(linalg.Vector, inSize*n)
+	for i := 0; i < n; i++ {
+		upTensor := a.outputTensor(upstream[i*outSize : (i+1)*outSize])
+		downTensor := a.inputTensor(res[i*inSize : (i+1)*inSize])
+		a.propagate(upTensor, downTensor)
+	}
+	return res
+}
+
+func (a *AvgPoolingLayer) evaluate(in, out *Tensor3) {
+	a.forEachPool(func(x, y, startX, endX, startY, endY int) {
+		scaler := 1 / float64((endX-startX)*(endY-startY))
+		for z := 0; z < in.Depth; z++ {
+			var sum float64
+			for poolY := startY; poolY < endY; poolY++ {
+				for poolX := startX; poolX < endX; poolX++ {
+					sum += in.Get(poolX, poolY, z)
+				}
+			}
+			out.Set(x, y, z, sum*scaler)
+		}
+	})
+}
+
+func (a *AvgPoolingLayer) propagate(upstream, downstream *Tensor3) {
+	a.forEachPool(func(x, y, startX, endX, startY, endY int) {
+		scaler := 1 / float64((endX-startX)*(endY-startY))
+		for z := 0; z < upstream.Depth; z++ {
+			val := upstream.Get(x, y, z) * scaler
+			for poolY := startY; poolY < endY; poolY++ {
+				for poolX := startX; poolX < endX; poolX++ {
+					old := downstream.Get(poolX, poolY, z)
+					downstream.Set(poolX, poolY, z, old+val)
+				}
+			}
+		}
+	})
+}
+
+// forEachPool calls f for each output position with
+// the bounds of the corresponding pool, where the end
+// coordinates are exclusive.
+func (a *AvgPoolingLayer) forEachPool(f func(x, y, startX, endX, startY, endY int)) {
+	outWidth := a.OutputWidth()
+	outHeight := a.OutputHeight()
+	for y := 0; y < outHeight; y++ {
+		startY := y * a.yStride()
+		endY := startY + a.YSpan
+		if endY > a.InputHeight {
+			endY = a.InputHeight
+		}
+		for x := 0; x < outWidth; x++ {
+			startX := x * a.xStride()
+			endX := startX + a.XSpan
+			if endX > a.InputWidth {
+				endX = a.InputWidth
+			}
+			f(x, y, startX, endX, startY, endY)
+		}
+	}
+}
+
+func (a *AvgPoolingLayer) inputTensor(inVec linalg.Vector) *Tensor3 {
+	return &Tensor3{
+		Width:  a.InputWidth,
+		Height: a.InputHeight,
+		Depth:  a.InputDepth,
+		Data:   inVec,
+	}
+}
+
+func (a *AvgPoolingLayer) outputTensor(outVec linalg.Vector) *Tensor3 {
+	return &Tensor3{
+		Width:  a.OutputWidth(),
+		Height: a.OutputHeight(),
+		Depth:  a.InputDepth,
+		Data:   outVec,
+	}
+}
+
+// GlobalAvgPoolingLayer averages each depth layer of an
+// input tensor, producing one output per depth layer.
+type GlobalAvgPoolingLayer struct {
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+}
+
+// DeserializeGlobalAvgPoolingLayer deserializes a
+// GlobalAvgPoolingLayer.
+func DeserializeGlobalAvgPoolingLayer(d []byte) (*GlobalAvgPoolingLayer, error) {
+	var res GlobalAvgPoolingLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Apply applies the layer to an input, which is treated
+// as a tensor.
+func (g *GlobalAvgPoolingLayer) Apply(in autofunc.Result) autofunc.Result {
+	return g.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (g *GlobalAvgPoolingLayer) ApplyR(rv autofunc.RVector,
+	in autofunc.RResult) autofunc.RResult {
+	return g.BatchR(rv, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (g *GlobalAvgPoolingLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	return g.poolingLayer().Batch(in, n)
+}
+
+// BatchR is like Batch, but for RResults.
+func (g *GlobalAvgPoolingLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	return g.poolingLayer().BatchR(rv, in, n)
+}
+
+// Serialize serializes the layer.
+func (g *GlobalAvgPoolingLayer) Serialize() ([]byte, error) {
+	return json.Marshal(g)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (g *GlobalAvgPoolingLayer) SerializerType() string {
+	return serializerTypeGlobalAvgPoolingLayer
+}
+
+func (g *GlobalAvgPoolingLayer) poolingLayer() *AvgPoolingLayer {
+	return &AvgPoolingLayer{
+		XSpan:       g.InputWidth,
+		YSpan:       g.InputHeight,
+		InputWidth:  g.InputWidth,
+		InputHeight: g.InputHeight,
+		InputDepth:  g.InputDepth,
+	}
+}
+
+type avgPoolingResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	N         int
+	Layer     *AvgPoolingLayer
+}
+
+func (a *avgPoolingResult) Output() linalg.Vector {
+	return a.OutputVec
+}
+
+func (a *avgPoolingResult) Constant(g autofunc.Gradient) bool {
+	return a.Input.Constant(g)
+}
+
+func (a *avgPoolingResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	if a.Input.Constant(grad) {
+		return
+	}
+	a.Input.PropagateGradient(a.Layer.backward(upstream, a.N), grad)
+}
+
+type avgPoolingRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	N          int
+	Layer      *AvgPoolingLayer
+}
+
+func (a *avgPoolingRResult) Output() linalg.Vector {
+	return a.OutputVec
+}
+
+func (a *avgPoolingRResult) ROutput() linalg.Vector {
+	return a.ROutputVec
+}
+
+func (a *avgPoolingRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return a.Input.Constant(rg, g)
+}
+
+func (a *avgPoolingRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if a.Input.Constant(rgrad, grad) {
+		return
+	}
+	a.Input.PropagateRGradient(a.Layer.backward(upstream, a.N),
+		a.Layer.backward(upstreamR, a.N), rgrad, grad)
+}
+
+func avgPoolingOutputSize(inSize, span, stride int) int {
+	if inSize <= span {
+		return 1
+	}
+	extra := inSize - span
+	res := 1 + extra/stride
+	if extra%stride != 0 {
+		res++
+	}
+
+	// When the stride exceeds the span, the formula above
+	// may count a pool which starts past the input.
+	if maxRes := (inSize + stride - 1) / stride; res > maxRes {
+		res = maxRes
+	}
+	return res
+}
@@ -0,0 +1,139 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestAvgPoolingDimensions(t *testing.T) {
+	layers := []*AvgPoolingLayer{
+		{XSpan: 3, YSpan: 3, InputWidth: 9, InputHeight: 9, InputDepth: 5},
+		{XSpan: 2, YSpan: 2, InputWidth: 9, InputHeight: 9, InputDepth: 7},
+		{XSpan: 3, YSpan: 3, XStride: 2, YStride: 1, InputWidth: 9,
+			InputHeight: 9, InputDepth: 2},
+		{XSpan: 3, YSpan: 2, XStride: 2, YStride: 3, InputWidth: 10,
+			InputHeight: 10, InputDepth: 2},
+	}
+	outSizes := [][2]int{
+		{3, 3},
+		{5, 5},
+		{4, 7},
+		{5, 4},
+	}
+	for i, layer := range layers {
+		expOutSize := outSizes[i]
+		if layer.OutputWidth() != expOutSize[0] ||
+			layer.OutputHeight() != expOutSize[1] {
+			t.Errorf("test %d gave output size %dX%d (expected %dX%d)",
+				i, layer.OutputWidth(), layer.OutputHeight(),
+				expOutSize[0], expOutSize[1])
+		}
+	}
+}
+
+func TestAvgPoolingForward(t *testing.T) {
+	layer := &AvgPoolingLayer{
+		XSpan:       2,
+		YSpan:       2,
+		XStride:     1,
+		InputWidth:  3,
+		InputHeight: 3,
+		InputDepth:  1,
+	}
+	input := &autofunc.Variable{Vector: []float64{
+		1, 2, 3,
+		4, 5, 6,
+		7, 8, 9,
+	}}
+	expected := []float64{
+		3, 4,
+		7.5, 8.5,
+	}
+	actual := layer.Apply(input).Output()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d outputs but got %d", len(expected), len(actual))
+	}
+	for i, x := range expected {
+		if math.Abs(actual[i]-x) > 1e-5 {
+			t.Errorf("output %d: expected %f got %f", i, x, actual[i])
+		}
+	}
+}
+
+func TestAvgPoolingLargeStride(t *testing.T) {
+	layer := &AvgPoolingLayer{
+		XSpan:       1,
+		YSpan:       2,
+		XStride:     2,
+		YStride:     3,
+		InputWidth:  4,
+		InputHeight: 6,
+		InputDepth:  1,
+	}
+	if layer.OutputWidth() != 2 || layer.OutputHeight() != 2 {
+		t.Fatalf("expected output size 2X2 but got %dX%d", layer.OutputWidth(),
+			layer.OutputHeight())
+	}
+	input := &autofunc.Variable{Vector: make(linalg.Vector, 4*6)}
+	for i := range input.Vector {
+		input.Vector[i] = float64(i + 1)
+	}
+	expected := []float64{3, 5, 15, 17}
+	actual := layer.Apply(input).Output()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d outputs but got %d", len(expected), len(actual))
+	}
+	for i, x := range expected {
+		if math.Abs(actual[i]-x) > 1e-5 {
+			t.Errorf("output %d: expected %f got %f", i, x, actual[i])
+		}
+	}
+}
+
+func TestAvgPoolingSerialize(t *testing.T) {
+	layer := &AvgPoolingLayer{
+		XSpan:       3,
+		YSpan:       2,
+		XStride:     1,
+		YStride:     2,
+		InputWidth:  7,
+		InputHeight: 4,
+		InputDepth:  3,
+	}
+	data, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(layer.SerializerType())(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newLayer, ok := decoded.(*AvgPoolingLayer); !ok {
+		t.Fatalf("unexpected type: %T", decoded)
+	} else if *newLayer != *layer {
+		t.Errorf("expected %v but got %v", layer, newLayer)
+	}
+}
+
+func TestGlobalAvgPoolingForward(t *testing.T) {
+	layer := &GlobalAvgPoolingLayer{
+		InputWidth:  2,
+		InputHeight: 2,
+		InputDepth:  2,
+	}
+	input := &autofunc.Variable{Vector: []float64{1, 2, 3, 4, 5, 6, 7, 8}}
+	expected := []float64{4, 5}
+	actual := layer.Apply(input).Output()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d outputs but got %d", len(expected), len(actual))
+	}
+	for i, x := range expected {
+		if math.Abs(actual[i]-x) > 1e-5 {
+			t.Errorf("output %d: expected %f got %f", i, x, actual[i])
+		}
+	}
+}
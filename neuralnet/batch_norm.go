@@ -0,0 +1,460 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+const (
+	defaultBatchNormStabilizer = 1e-5
+	defaultBatchNormDecayRate  = 0.9
+)
+
+// BatchNormLayer normalizes each of its input features
+// to have a mean of 0 and a variance of 1, then scales
+// and shifts the normalized features using learned
+// per-feature parameters.
+//
+// If the input vectors are larger than InputCount, they
+// are treated as consecutive groups of InputCount
+// features, each of which is normalized using the same
+// statistics.
+// Since the depth index varies fastest in a Tensor3, this
+// means that setting InputCount to a ConvLayer's output
+// depth will normalize each channel of its output.
+//
+// A BatchNormLayer can either be in training mode, where
+// it normalizes using statistics from the current batch,
+// or in usage mode, where it normalizes using running
+// averages which were accumulated during training.
+type BatchNormLayer struct {
+	// InputCount is the number of features (or tensor
+	// channels) to normalize.
+	InputCount int
+
+	// Stabilizer is added to each variance before it is
+	// used to normalize a feature.
+	Stabilizer float64
+
+	// DecayRate determines how much of the running
+	// averages is kept every time they are updated
+	// with new batch statistics.
+	DecayRate float64
+
+	Scales *autofunc.Variable
+	Biases *autofunc.Variable
+
+	RunningMeans     linalg.Vector
+	RunningVariances linalg.Vector
+
+	// Training is true if batch statistics should be
+	// used (and the running averages updated) instead
+	// of the running averages.
+	Training bool
+
+	runningLock sync.Mutex
+}
+
+// NewBatchNormLayer creates a BatchNormLayer with an
+// identity transformation and default hyper-parameters.
+// The resulting layer is in training mode.
+func NewBatchNormLayer(inCount int) *BatchNormLayer {
+	res := &BatchNormLayer{
+		InputCount: inCount,
+		Stabilizer: defaultBatchNormStabilizer,
+		DecayRate:  defaultBatchNormDecayRate,
+		Scales:     &autofunc.Variable{Vector: make(linalg.Vector, inCount)},
+		Biases:     &autofunc.Variable{Vector: make(linalg.Vector, inCount)},
+
+		RunningMeans:     make(linalg.Vector, inCount),
+		RunningVariances: make(linalg.Vector, inCount),
+
+		Training: true,
+	}
+	for i := 0; i < inCount; i++ {
+		res.Scales.Vector[i] = 1
+		res.RunningVariances[i] = 1
+	}
+	return res
+}
+
+// DeserializeBatchNormLayer deserializes a BatchNormLayer.
+func DeserializeBatchNormLayer(d []byte) (*BatchNormLayer, error) {
+	var res BatchNormLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Parameters returns a slice containing the scale and
+// bias variables.
+func (b *BatchNormLayer) Parameters() []*autofunc.Variable {
+	if b.Scales == nil || b.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{b.Scales, b.Biases}
+}
+
+// Apply normalizes a single input.
+// In training mode, the input's features are normalized
+// using statistics from the input itself, so the input
+// must contain several groups of InputCount features
+// (e.g. several pixels of a Tensor3).
+func (b *BatchNormLayer) Apply(in autofunc.Result) autofunc.Result {
+	return b.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (b *BatchNormLayer) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return b.BatchR(rv, in, 1)
+}
+
+// Batch normalizes a batch of inputs.
+// In training mode, this updates the running averages.
+func (b *BatchNormLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	b.checkInput(in.Output(), n)
+	means, invStddevs := b.statistics(in.Output(), true)
+	res := &batchNormResult{
+		OutputVec:  make(linalg.Vector, len(in.Output())),
+		Normalized: make(linalg.Vector, len(in.Output())),
+		InvStddevs: invStddevs,
+		Input:      in,
+		Layer:      b,
+		BatchStats: b.Training,
+	}
+	for i, x := range in.Output() {
+		k := i % b.InputCount
+		res.Normalized[i] = (x - means[k]) * invStddevs[k]
+		res.OutputVec[i] = res.Normalized[i]*b.Scales.Vector[k] + b.Biases.Vector[k]
+	}
+	return res
+}
+
+// BatchR is like Batch, but for RResults.
+// Unlike Batch, it never updates the running averages,
+// since it is typically evaluated on batches that have
+// already been passed to Batch (e.g. during
+// Hessian-free training).
+func (b *BatchNormLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	b.checkInput(in.Output(), n)
+	means, invStddevs := b.statistics(in.Output(), false)
+	res := &batchNormRResult{
+		OutputVec:   make(linalg.Vector, len(in.Output())),
+		ROutputVec:  make(linalg.Vector, len(in.Output())),
+		Normalized:  make(linalg.Vector, len(in.Output())),
+		NormalizedR: make(linalg.Vector, len(in.Output())),
+		InvStddevs:  invStddevs,
+		InvStddevsR: make(linalg.Vector, b.InputCount),
+		Input:       in,
+		ScalesR:     rv[b.Scales],
+		Layer:       b,
+		BatchStats:  b.Training,
+	}
+	for i, x := range in.Output() {
+		k := i % b.InputCount
+		res.Normalized[i] = (x - means[k]) * invStddevs[k]
+		res.OutputVec[i] = res.Normalized[i]*b.Scales.Vector[k] + b.Biases.Vector[k]
+	}
+
+	inR := in.ROutput()
+	if b.Training {
+		meansR := b.featureMeans(inR)
+		centeredR := make(linalg.Vector, len(inR))
+		for i, x := range inR {
+			centeredR[i] = x - meansR[i%b.InputCount]
+		}
+		products := make(linalg.Vector, len(inR))
+		for i, x := range centeredR {
+			products[i] = x * res.Normalized[i]
+		}
+		for k, x := range b.featureMeans(products) {
+			s := invStddevs[k]
+			res.InvStddevsR[k] = -s * s * x
+		}
+		for i, x := range centeredR {
+			k := i % b.InputCount
+			res.NormalizedR[i] = x*invStddevs[k] +
+				res.Normalized[i]*res.InvStddevsR[k]/invStddevs[k]
+		}
+	} else {
+		for i, x := range inR {
+			res.NormalizedR[i] = x * invStddevs[i%b.InputCount]
+		}
+	}
+
+	biasesR := rv[b.Biases]
+	for i, x := range res.NormalizedR {
+		k := i % b.InputCount
+		res.ROutputVec[i] = x * b.Scales.Vector[k]
+		if res.ScalesR != nil {
+			res.ROutputVec[i] += res.Normalized[i] * res.ScalesR[k]
+		}
+		if biasesR != nil {
+			res.ROutputVec[i] += biasesR[k]
+		}
+	}
+
+	return res
+}
+
+// Serialize serializes the layer.
+func (b *BatchNormLayer) Serialize() ([]byte, error) {
+	b.runningLock.Lock()
+	defer b.runningLock.Unlock()
+	return json.Marshal(b)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (b *BatchNormLayer) SerializerType() string {
+	return serializerTypeBatchNormLayer
+}
+
+func (b *BatchNormLayer) checkInput(in linalg.Vector, n int) {
+	if b.Scales == nil || b.Biases == nil || b.RunningMeans == nil ||
+		b.RunningVariances == nil {
+		panic(uninitPanicMessage)
+	}
+	if len(in)%(n*b.InputCount) != 0 {
+		panic("invalid input size")
+	}
+	if b.Training && len(in) == b.InputCount {
+		panic("batch statistics need several values per feature")
+	}
+}
+
+// statistics returns the means and inverse standard
+// deviations which should be used to normalize the
+// given batch.
+// In training mode, this updates the running averages
+// if update is true.
+func (b *BatchNormLayer) statistics(in linalg.Vector,
+	update bool) (means, invStddevs linalg.Vector) {
+	var variances linalg.Vector
+	if b.Training {
+		means = b.featureMeans(in)
+		squares := make(linalg.Vector, len(in))
+		for i, x := range in {
+			diff := x - means[i%b.InputCount]
+			squares[i] = diff * diff
+		}
+		variances = b.featureMeans(squares)
+		if update {
+			b.updateRunning(means, variances)
+		}
+	} else {
+		b.runningLock.Lock()
+		means = b.RunningMeans.Copy()
+		variances = b.RunningVariances.Copy()
+		b.runningLock.Unlock()
+	}
+	invStddevs = make(linalg.Vector, b.InputCount)
+	for i, v := range variances {
+		invStddevs[i] = 1 / math.Sqrt(v+b.Stabilizer)
+	}
+	return
+}
+
+func (b *BatchNormLayer) updateRunning(means, variances linalg.Vector) {
+	b.runningLock.Lock()
+	defer b.runningLock.Unlock()
+	keep := b.DecayRate
+	for i, x := range means {
+		b.RunningMeans[i] = keep*b.RunningMeans[i] + (1-keep)*x
+	}
+	for i, x := range variances {
+		b.RunningVariances[i] = keep*b.RunningVariances[i] + (1-keep)*x
+	}
+}
+
+// featureMeans averages the entries of v which
+// correspond to each feature.
+func (b *BatchNormLayer) featureMeans(v linalg.Vector) linalg.Vector {
+	res := make(linalg.Vector, b.InputCount)
+	for i, x := range v {
+		res[i%b.InputCount] += x
+	}
+	return res.Scale(float64(b.InputCount) / float64(len(v)))
+}
+
+// featureSums sums the entries of v which correspond
+// to each feature and adds the sums to dest.
+func (b *BatchNormLayer) featureSums(dest, v linalg.Vector) {
+	for i, x := range v {
+		dest[i%b.InputCount] += x
+	}
+}
+
+type batchNormResult struct {
+	OutputVec  linalg.Vector
+	Normalized linalg.Vector
+	InvStddevs linalg.Vector
+	Input      autofunc.Result
+	Layer      *BatchNormLayer
+	BatchStats bool
+}
+
+func (b *batchNormResult) Output() linalg.Vector {
+	return b.OutputVec
+}
+
+func (b *batchNormResult) Constant(g autofunc.Gradient) bool {
+	return b.Input.Constant(g) && b.Layer.Scales.Constant(g) &&
+		b.Layer.Biases.Constant(g)
+}
+
+func (b *batchNormResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	layer := b.Layer
+	if biasGrad, ok := grad[layer.Biases]; ok {
+		layer.featureSums(biasGrad, upstream)
+	}
+	if scaleGrad, ok := grad[layer.Scales]; ok {
+		products := make(linalg.Vector, len(upstream))
+		for i, x := range upstream {
+			products[i] = x * b.Normalized[i]
+		}
+		layer.featureSums(scaleGrad, products)
+	}
+
+	if b.Input.Constant(grad) {
+		return
+	}
+
+	normGrad := make(linalg.Vector, len(upstream))
+	for i, x := range upstream {
+		normGrad[i] = x * layer.Scales.Vector[i%layer.InputCount]
+	}
+	downstream := make(linalg.Vector, len(upstream))
+	if b.BatchStats {
+		products := make(linalg.Vector, len(normGrad))
+		for i, x := range normGrad {
+			products[i] = x * b.Normalized[i]
+		}
+		gradMeans := layer.featureMeans(normGrad)
+		productMeans := layer.featureMeans(products)
+		for i, x := range normGrad {
+			k := i % layer.InputCount
+			downstream[i] = b.InvStddevs[k] *
+				(x - gradMeans[k] - b.Normalized[i]*productMeans[k])
+		}
+	} else {
+		for i, x := range normGrad {
+			downstream[i] = x * b.InvStddevs[i%layer.InputCount]
+		}
+	}
+	b.Input.PropagateGradient(downstream, grad)
+}
+
+type batchNormRResult struct {
+	OutputVec   linalg.Vector
+	ROutputVec  linalg.Vector
+	Normalized  linalg.Vector
+	NormalizedR linalg.Vector
+	InvStddevs  linalg.Vector
+	InvStddevsR linalg.Vector
+	Input       autofunc.RResult
+	ScalesR     linalg.Vector
+	Layer       *BatchNormLayer
+	BatchStats  bool
+}
+
+func (b *batchNormRResult) Output() linalg.Vector {
+	return b.OutputVec
+}
+
+func (b *batchNormRResult) ROutput() linalg.Vector {
+	return b.ROutputVec
+}
+
+func (b *batchNormRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	if !b.Layer.Scales.Constant(g) || !b.Layer.Biases.Constant(g) {
+		return false
+	}
+	if _, ok := rg[b.Layer.Scales]; ok {
+		return false
+	}
+	if _, ok := rg[b.Layer.Biases]; ok {
+		return false
+	}
+	return b.Input.Constant(rg, g)
+}
+
+func (b *batchNormRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if grad == nil {
+		grad = autofunc.Gradient{}
+	}
+	layer := b.Layer
+
+	if biasGrad, ok := grad[layer.Biases]; ok {
+		layer.featureSums(biasGrad, upstream)
+	}
+	if biasRGrad, ok := rgrad[layer.Biases]; ok {
+		layer.featureSums(biasRGrad, upstreamR)
+	}
+	if scaleGrad, ok := grad[layer.Scales]; ok {
+		products := make(linalg.Vector, len(upstream))
+		for i, x := range upstream {
+			products[i] = x * b.Normalized[i]
+		}
+		layer.featureSums(scaleGrad, products)
+	}
+	if scaleRGrad, ok := rgrad[layer.Scales]; ok {
+		products := make(linalg.Vector, len(upstream))
+		for i, x := range upstream {
+			products[i] = x*b.NormalizedR[i] + upstreamR[i]*b.Normalized[i]
+		}
+		layer.featureSums(scaleRGrad, products)
+	}
+
+	if b.Input.Constant(rgrad, grad) {
+		return
+	}
+
+	normGrad := make(linalg.Vector, len(upstream))
+	normGradR := make(linalg.Vector, len(upstream))
+	for i, x := range upstream {
+		k := i % layer.InputCount
+		normGrad[i] = x * layer.Scales.Vector[k]
+		normGradR[i] = upstreamR[i] * layer.Scales.Vector[k]
+		if b.ScalesR != nil {
+			normGradR[i] += x * b.ScalesR[k]
+		}
+	}
+
+	downstream := make(linalg.Vector, len(upstream))
+	downstreamR := make(linalg.Vector, len(upstream))
+	if b.BatchStats {
+		products := make(linalg.Vector, len(normGrad))
+		productsR := make(linalg.Vector, len(normGrad))
+		for i, x := range normGrad {
+			products[i] = x * b.Normalized[i]
+			productsR[i] = normGradR[i]*b.Normalized[i] + x*b.NormalizedR[i]
+		}
+		gradMeans := layer.featureMeans(normGrad)
+		gradMeansR := layer.featureMeans(normGradR)
+		productMeans := layer.featureMeans(products)
+		productMeansR := layer.featureMeans(productsR)
+		for i, x := range normGrad {
+			k := i % layer.InputCount
+			centered := x - gradMeans[k] - b.Normalized[i]*productMeans[k]
+			centeredR := normGradR[i] - gradMeansR[k] -
+				b.NormalizedR[i]*productMeans[k] - b.Normalized[i]*productMeansR[k]
+			downstream[i] = b.InvStddevs[k] * centered
+			downstreamR[i] = b.InvStddevsR[k]*centered + b.InvStddevs[k]*centeredR
+		}
+	} else {
+		for i, x := range normGrad {
+			k := i % layer.InputCount
+			downstream[i] = x * b.InvStddevs[k]
+			downstreamR[i] = normGradR[i] * b.InvStddevs[k]
+		}
+	}
+	b.Input.PropagateRGradient(downstream, downstreamR, rgrad, grad)
+}
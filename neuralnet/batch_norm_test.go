@@ -0,0 +1,180 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+// batchNormBatchFunc turns a batch of a fixed size into
+// an RFunc so that it can be tested with functest.
+type batchNormBatchFunc struct {
+	Layer *BatchNormLayer
+	N     int
+}
+
+func (b *batchNormBatchFunc) Apply(in autofunc.Result) autofunc.Result {
+	return b.Layer.Batch(in, b.N)
+}
+
+func (b *batchNormBatchFunc) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return b.Layer.BatchR(rv, in, b.N)
+}
+
+func TestBatchNormOutput(t *testing.T) {
+	layer := NewBatchNormLayer(2)
+	layer.Scales.Vector = linalg.Vector{2, 1}
+	layer.Biases.Vector = linalg.Vector{0, -1}
+	input := &autofunc.Variable{Vector: linalg.Vector{1, 5, 3, 5, 5, 5}}
+	output := layer.Batch(input, 3).Output()
+
+	s := 1 / math.Sqrt(8.0/3+layer.Stabilizer)
+	expected := linalg.Vector{-4 * s, -1, 0, -1, 4 * s, -1}
+	for i, x := range expected {
+		if math.Abs(output[i]-x) > 1e-5 {
+			t.Errorf("output %d: expected %f got %f", i, x, output[i])
+		}
+	}
+
+	expectedMeans := linalg.Vector{0.3, 0.5}
+	expectedVars := linalg.Vector{0.9 + 0.1*8.0/3, 0.9}
+	for i, x := range expectedMeans {
+		if math.Abs(layer.RunningMeans[i]-x) > 1e-5 {
+			t.Errorf("running mean %d: expected %f got %f", i, x,
+				layer.RunningMeans[i])
+		}
+		if math.Abs(layer.RunningVariances[i]-expectedVars[i]) > 1e-5 {
+			t.Errorf("running variance %d: expected %f got %f", i,
+				expectedVars[i], layer.RunningVariances[i])
+		}
+	}
+}
+
+func TestBatchNormRunningUpdates(t *testing.T) {
+	layer, inVar := batchNormTestInfo(3, 2)
+	means := layer.RunningMeans.Copy()
+	variances := layer.RunningVariances.Copy()
+	rVector := batchNormTestRVector(layer, inVar)
+	layer.BatchR(rVector, autofunc.NewRVariable(inVar, rVector), 2)
+	if layer.RunningMeans.Copy().Scale(-1).Add(means).MaxAbs() != 0 ||
+		layer.RunningVariances.Copy().Scale(-1).Add(variances).MaxAbs() != 0 {
+		t.Error("BatchR should not update the running averages")
+	}
+	layer.Batch(inVar, 2)
+	if layer.RunningMeans.Copy().Scale(-1).Add(means).MaxAbs() == 0 {
+		t.Error("Batch should update the running averages")
+	}
+}
+
+func TestBatchNormSingleTraining(t *testing.T) {
+	layer := NewBatchNormLayer(3)
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for a single training input")
+		}
+	}()
+	layer.Apply(&autofunc.Variable{Vector: linalg.Vector{1, 2, 3}})
+}
+
+func TestBatchNormTrainingProp(t *testing.T) {
+	layer, inVar := batchNormTestInfo(3, 2)
+	rVector := batchNormTestRVector(layer, inVar)
+	funcTest := &functest.RFuncTest{
+		F:     &batchNormBatchFunc{Layer: layer, N: 2},
+		Vars:  append(layer.Parameters(), inVar),
+		Input: inVar,
+		RV:    rVector,
+	}
+	funcTest.Run(t)
+}
+
+func TestBatchNormUsageProp(t *testing.T) {
+	layer, inVar := batchNormTestInfo(3, 2)
+	layer.Training = false
+	rVector := batchNormTestRVector(layer, inVar)
+	funcTest := &functest.RFuncTest{
+		F:     layer,
+		Vars:  append(layer.Parameters(), inVar),
+		Input: inVar,
+		RV:    rVector,
+	}
+	funcTest.Run(t)
+}
+
+func TestBatchNormUsageBatch(t *testing.T) {
+	layer, inVar := batchNormTestInfo(3, 4)
+	layer.Training = false
+	params := append(layer.Parameters(), inVar)
+	testBatcher(t, layer, inVar, 4, params)
+
+	rVector := batchNormTestRVector(layer, inVar)
+	inRVar := autofunc.NewRVariable(inVar, rVector)
+	testRBatcher(t, rVector, layer, inRVar, 4, params)
+}
+
+func TestBatchNormSerialize(t *testing.T) {
+	layer, _ := batchNormTestInfo(3, 1)
+	layer.Training = false
+	data, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(layer.SerializerType())(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := decoded.(*BatchNormLayer)
+	if !ok {
+		t.Fatalf("unexpected type: %T", decoded)
+	}
+	if newLayer.InputCount != layer.InputCount || newLayer.Training ||
+		newLayer.Stabilizer != layer.Stabilizer ||
+		newLayer.DecayRate != layer.DecayRate {
+		t.Fatal("invalid hyper-parameters")
+	}
+	vecs := [][2]linalg.Vector{
+		{layer.Scales.Vector, newLayer.Scales.Vector},
+		{layer.Biases.Vector, newLayer.Biases.Vector},
+		{layer.RunningMeans, newLayer.RunningMeans},
+		{layer.RunningVariances, newLayer.RunningVariances},
+	}
+	for i, pair := range vecs {
+		if pair[0].Copy().Scale(-1).Add(pair[1]).MaxAbs() != 0 {
+			t.Errorf("vector %d: expected %v got %v", i, pair[0], pair[1])
+		}
+	}
+}
+
+func batchNormTestInfo(inCount, n int) (*BatchNormLayer, *autofunc.Variable) {
+	layer := NewBatchNormLayer(inCount)
+	for i := 0; i < inCount; i++ {
+		layer.Scales.Vector[i] = rand.NormFloat64()
+		layer.Biases.Vector[i] = rand.NormFloat64()
+		layer.RunningMeans[i] = rand.NormFloat64()
+		layer.RunningVariances[i] = rand.Float64() + 0.5
+	}
+
+	// Use several groups per input to test Tensor3
+	// channel normalization.
+	inVec := make(linalg.Vector, inCount*n*4)
+	for i := range inVec {
+		inVec[i] = rand.NormFloat64()
+	}
+	return layer, &autofunc.Variable{Vector: inVec}
+}
+
+func batchNormTestRVector(layer *BatchNormLayer, in *autofunc.Variable) autofunc.RVector {
+	rVector := autofunc.RVector{}
+	for _, variable := range append(layer.Parameters(), in) {
+		rVector[variable] = make(linalg.Vector, len(variable.Vector))
+		for i := range rVector[variable] {
+			rVector[variable][i] = rand.NormFloat64()
+		}
+	}
+	return rVector
+}
@@ -75,24 +75,28 @@ func (b *BatchRGradienter) runBatch(rv autofunc.RVector, rgrad autofunc.RGradien
 	outputSize := len(firstSample.Output)
 	inVec := make(linalg.Vector, sampleCount*inputSize)
 	outVec := make(linalg.Vector, sampleCount*outputSize)
+	costFunc := b.CostFunc
 
 	for i := 0; i < s.Len(); i++ {
 		sample := s.GetSample(i)
 		vs := sample.(VectorSample)
 		copy(inVec[i*inputSize:], vs.Input)
-		copy(outVec[i*outputSize:], vs.Output)
+		copy(outVec[i*outputSize:], vs.maskedOutput())
+		if vs.Mask != nil {
+			costFunc = vs.costFunc(b.CostFunc)
+		}
 	}
 
 	inVar := &autofunc.Variable{inVec}
 	if rgrad != nil {
 		rVar := autofunc.NewRVariable(inVar, rv)
 		result := b.Learner.BatchR(rv, rVar, sampleCount)
-		cost := b.CostFunc.CostR(rv, outVec, result)
+		cost := batchCostR(rv, costFunc, outVec, result, sampleCount)
 		cost.PropagateRGradient(linalg.Vector{1}, linalg.Vector{0},
 			rgrad, grad)
 	} else {
 		result := b.Learner.Batch(inVar, sampleCount)
-		cost := b.CostFunc.Cost(outVec, result)
+		cost := batchCost(costFunc, outVec, result, sampleCount)
 		cost.PropagateGradient(linalg.Vector{1}, grad)
 	}
 }
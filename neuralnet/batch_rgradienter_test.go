@@ -8,6 +8,7 @@ import (
 
 	"github.com/unixpickle/autofunc"
 	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
 )
 
 const (
@@ -42,6 +43,108 @@ func TestBatchRGradienterUnevenConcurrent(t *testing.T) {
 	runtime.GOMAXPROCS(n)
 }
 
+func TestBatchRGradienterWeightedCE(t *testing.T) {
+	cost := WeightedCrossEntropyCost{Weights: []float64{2, 0.5, 1}}
+	testBatchRGradienter(t, 8, &BatchRGradienter{
+		CostFunc:      cost,
+		MaxGoroutines: 1,
+		MaxBatchSize:  4,
+	})
+
+	net := Network{
+		&DenseLayer{InputCount: 2, OutputCount: 3},
+		&Sigmoid{},
+	}
+	net.Randomize()
+	inputs := []linalg.Vector{{1, 0}, {0, 1}, {1, 1}, {-1, 0.5}}
+	outputs := []linalg.Vector{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {1, 0, 1}}
+	samples := VectorSampleSet(inputs, outputs)
+	gradienter := &BatchRGradienter{
+		Learner:  net.BatchLearner(),
+		CostFunc: cost,
+	}
+	initialCost := TotalCost(cost, net, samples)
+	sgd.SGD(gradienter, samples, 0.1, 50, len(inputs))
+	if finalCost := TotalCost(cost, net, samples); finalCost >= initialCost {
+		t.Errorf("cost did not decrease: %f -> %f", initialCost, finalCost)
+	}
+}
+
+func TestBatchRGradienterMultiHinge(t *testing.T) {
+	testBatchRGradienter(t, 8, &BatchRGradienter{
+		CostFunc:      MultiHingeCost{},
+		MaxGoroutines: 1,
+		MaxBatchSize:  4,
+	})
+	testBatchRGradienter(t, 8, &BatchRGradienter{
+		CostFunc:      &RegularizingCost{Penalty: 0.1, CostFunc: MultiHingeCost{}},
+		MaxGoroutines: 1,
+		MaxBatchSize:  4,
+	})
+}
+
+func TestBatchCostRegularizer(t *testing.T) {
+	n := 3
+	regVar := &autofunc.Variable{Vector: linalg.Vector{1, -2, 0.5}}
+	actual := &autofunc.Variable{Vector: make(linalg.Vector, 4*n)}
+	expected := make(linalg.Vector, len(actual.Vector))
+	for i := range expected {
+		actual.Vector[i] = rand.NormFloat64()
+		expected[i] = rand.NormFloat64()
+	}
+	vars := []*autofunc.Variable{regVar, actual}
+	rv := autofunc.RVector{}
+	for _, v := range vars {
+		rv[v] = make(linalg.Vector, len(v.Vector))
+		for i := range rv[v] {
+			rv[v][i] = rand.NormFloat64()
+		}
+	}
+
+	// Both costs have the same value, but the second one is
+	// applied to each sample separately.
+	costs := []CostFunc{
+		&RegularizingCost{
+			Variables: []*autofunc.Variable{regVar},
+			Penalty:   0.1,
+			CostFunc:  MeanSquaredCost{},
+		},
+		&RegularizingCost{
+			Variables: []*autofunc.Variable{regVar},
+			Penalty:   0.1,
+			CostFunc:  nonSeparableCost{MeanSquaredCost{}},
+		},
+	}
+	var outputs, rOutputs []float64
+	var grads []autofunc.Gradient
+	var rGrads []autofunc.RGradient
+	for _, cost := range costs {
+		result := batchCost(cost, expected, actual, n)
+		grad := autofunc.NewGradient(vars)
+		result.PropagateGradient(linalg.Vector{1}, grad)
+		outputs = append(outputs, result.Output()[0])
+		grads = append(grads, grad)
+
+		resultR := batchCostR(rv, cost, expected, autofunc.NewRVariable(actual, rv), n)
+		rGrad := autofunc.NewRGradient(vars)
+		resultR.PropagateRGradient(linalg.Vector{1}, linalg.Vector{0}, rGrad, nil)
+		rOutputs = append(rOutputs, resultR.ROutput()[0])
+		rGrads = append(rGrads, rGrad)
+	}
+	if math.Abs(outputs[0]-outputs[1]) > batchRGradienterTestPrec {
+		t.Errorf("expected cost %f but got %f", outputs[0], outputs[1])
+	}
+	if math.Abs(rOutputs[0]-rOutputs[1]) > batchRGradienterTestPrec {
+		t.Errorf("expected r-cost %f but got %f", rOutputs[0], rOutputs[1])
+	}
+	if !vecMapsEqual(grads[0], grads[1]) {
+		t.Error("bad gradient")
+	}
+	if !vecMapsEqual(rGrads[0], rGrads[1]) {
+		t.Error("bad r-gradient")
+	}
+}
+
 func testBatchRGradienter(t *testing.T, batchSize int, b *BatchRGradienter) {
 	rand.Seed(batchRGradienterSeed)
 
@@ -128,3 +231,13 @@ func vecMapsEqual(m1, m2 map[*autofunc.Variable]linalg.Vector) bool {
 
 	return true
 }
+
+// nonSeparableCost wraps a CostFunc and claims that it
+// is not separable.
+type nonSeparableCost struct {
+	CostFunc
+}
+
+func (_ nonSeparableCost) Separable() bool {
+	return false
+}
@@ -0,0 +1,167 @@
+package neuralnet
+
+import "github.com/unixpickle/autofunc"
+
+// Concat is a Layer which feeds its input to several
+// branches and concatenates their outputs.
+// For a batch of inputs, the outputs of the branches
+// are concatenated separately for each input.
+type Concat struct {
+	Branches []Layer
+}
+
+// DeserializeConcat deserializes a Concat.
+func DeserializeConcat(d []byte) (*Concat, error) {
+	branches, err := DeserializeNetwork(d)
+	if err != nil {
+		return nil, err
+	}
+	return &Concat{Branches: branches}, nil
+}
+
+// Randomize randomizes every branch which implements
+// Randomizer.
+func (c *Concat) Randomize() {
+	Network(c.Branches).Randomize()
+}
+
+// Parameters concatenates the parameters of every
+// branch which implements sgd.Learner.
+func (c *Concat) Parameters() []*autofunc.Variable {
+	return Network(c.Branches).Parameters()
+}
+
+// Apply applies the layer to an input.
+func (c *Concat) Apply(in autofunc.Result) autofunc.Result {
+	return c.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (c *Concat) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return c.BatchR(v, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (c *Concat) Batch(in autofunc.Result, n int) autofunc.Result {
+	return autofunc.Pool(in, func(in autofunc.Result) autofunc.Result {
+		outs := make([]autofunc.Result, len(c.Branches))
+		for i, branch := range c.Branches {
+			outs[i] = batchLayer(branch, in, n)
+		}
+		var pieces []autofunc.Result
+		for i := 0; i < n; i++ {
+			for _, out := range outs {
+				size := len(out.Output()) / n
+				pieces = append(pieces, autofunc.Slice(out, i*size, (i+1)*size))
+			}
+		}
+		return autofunc.Concat(pieces...)
+	})
+}
+
+// BatchR is like Batch, but for RResults.
+func (c *Concat) BatchR(v autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	return autofunc.PoolR(in, func(in autofunc.RResult) autofunc.RResult {
+		outs := make([]autofunc.RResult, len(c.Branches))
+		for i, branch := range c.Branches {
+			outs[i] = batchLayerR(branch, v, in, n)
+		}
+		var pieces []autofunc.RResult
+		for i := 0; i < n; i++ {
+			for _, out := range outs {
+				size := len(out.Output()) / n
+				pieces = append(pieces, autofunc.SliceR(out, i*size, (i+1)*size))
+			}
+		}
+		return autofunc.ConcatR(pieces...)
+	})
+}
+
+// Serialize serializes the layer.
+func (c *Concat) Serialize() ([]byte, error) {
+	return Network(c.Branches).Serialize()
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (c *Concat) SerializerType() string {
+	return serializerTypeConcat
+}
+
+// Sum is a Layer which feeds its input to several
+// branches and adds their outputs.
+// Every branch must produce outputs of the same size.
+type Sum struct {
+	Branches []Layer
+}
+
+// DeserializeSum deserializes a Sum.
+func DeserializeSum(d []byte) (*Sum, error) {
+	branches, err := DeserializeNetwork(d)
+	if err != nil {
+		return nil, err
+	}
+	return &Sum{Branches: branches}, nil
+}
+
+// Randomize randomizes every branch which implements
+// Randomizer.
+func (s *Sum) Randomize() {
+	Network(s.Branches).Randomize()
+}
+
+// Parameters concatenates the parameters of every
+// branch which implements sgd.Learner.
+func (s *Sum) Parameters() []*autofunc.Variable {
+	return Network(s.Branches).Parameters()
+}
+
+// Apply applies the layer to an input.
+func (s *Sum) Apply(in autofunc.Result) autofunc.Result {
+	return s.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (s *Sum) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return s.BatchR(v, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (s *Sum) Batch(in autofunc.Result, n int) autofunc.Result {
+	if len(s.Branches) == 0 {
+		panic("no branches to sum")
+	}
+	return autofunc.Pool(in, func(in autofunc.Result) autofunc.Result {
+		res := batchLayer(s.Branches[0], in, n)
+		for _, branch := range s.Branches[1:] {
+			res = autofunc.Add(res, batchLayer(branch, in, n))
+		}
+		return res
+	})
+}
+
+// BatchR is like Batch, but for RResults.
+func (s *Sum) BatchR(v autofunc.RVector, in autofunc.RResult, n int) autofunc.RResult {
+	if len(s.Branches) == 0 {
+		panic("no branches to sum")
+	}
+	return autofunc.PoolR(in, func(in autofunc.RResult) autofunc.RResult {
+		res := batchLayerR(s.Branches[0], v, in, n)
+		for _, branch := range s.Branches[1:] {
+			res = autofunc.AddR(res, batchLayerR(branch, v, in, n))
+		}
+		return res
+	})
+}
+
+// Serialize serializes the layer.
+func (s *Sum) Serialize() ([]byte, error) {
+	return Network(s.Branches).Serialize()
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (s *Sum) SerializerType() string {
+	return serializerTypeSum
+}
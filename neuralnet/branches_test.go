@@ -0,0 +1,27 @@
+package neuralnet
+
+import (
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+)
+
+func TestConcatOutput(t *testing.T) {
+	layer := &Concat{
+		Branches: []Layer{
+			&RescaleLayer{Scale: 2},
+			&RescaleLayer{Bias: 1, Scale: 1},
+		},
+	}
+	input := &autofunc.Variable{Vector: []float64{1, 2, 3, 4}}
+	expected := []float64{2, 4, 2, 3, 6, 8, 4, 5}
+	actual := layer.Batch(input, 2).Output()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d outputs but got %d", len(expected), len(actual))
+	}
+	for i, x := range expected {
+		if actual[i] != x {
+			t.Errorf("output %d: expected %f got %f", i, x, actual[i])
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package neuralnet
+
+import (
+	"math"
+	"sync"
+
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas64"
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// CompiledNetwork evaluates a Network without building
+// an autofunc graph, making it suitable for inference.
+//
+// A CompiledNetwork shares parameters with the Network
+// it was compiled from, so changes to the parameters
+// (e.g. from further training) are reflected in its
+// outputs.
+// However, the layers of the Network and their
+// hyper-parameters must not change after compilation.
+//
+// A CompiledNetwork reuses internal buffers between
+// calls and is safe to use from multiple Goroutines.
+type CompiledNetwork struct {
+	stages  []compiledStage
+	buffers sync.Pool
+}
+
+// Compile creates a CompiledNetwork for n.
+//
+// DenseLayers, ConvLayers, pooling layers, activation
+// functions, softmax layers, and DropoutLayers (when not
+// training) are evaluated directly.
+// Other layers are evaluated through their Batch or
+// Apply methods.
+func (n Network) Compile() *CompiledNetwork {
+	res := &CompiledNetwork{}
+	for _, layer := range n {
+		res.stages = append(res.stages, compileLayer(layer))
+	}
+	numStages := len(res.stages)
+	res.buffers.New = func() interface{} {
+		return make([]linalg.Vector, numStages)
+	}
+	return res
+}
+
+// Apply evaluates the network on a single input.
+func (c *CompiledNetwork) Apply(in linalg.Vector) linalg.Vector {
+	return c.Batch(in, 1)
+}
+
+// Batch evaluates the network on n inputs which are
+// packed one after another in a single vector.
+// The outputs are packed in the same way.
+// The batch size n must be positive.
+func (c *CompiledNetwork) Batch(in linalg.Vector, n int) linalg.Vector {
+	if n <= 0 {
+		panic("batch size must be positive")
+	}
+	if len(in)%n != 0 {
+		panic("invalid input size")
+	}
+	buffers := c.buffers.Get().([]linalg.Vector)
+	defer c.buffers.Put(buffers)
+	for i, stage := range c.stages {
+		in = stage.evaluate(in, n, &buffers[i])
+	}
+	return in.Copy()
+}
+
+type compiledStage interface {
+	// evaluate applies the stage to a batch of inputs and
+	// returns the outputs.
+	// The outputs may be stored in *buf, which is grown as
+	// needed.
+	evaluate(in linalg.Vector, n int, buf *linalg.Vector) linalg.Vector
+}
+
+func compileLayer(layer Layer) compiledStage {
+	switch layer := layer.(type) {
+	case *DenseLayer:
+		return compiledDense{layer}
+	case *ConvLayer:
+		return newCompiledConv(layer)
+	case *MaxPoolingLayer:
+		return compiledMaxPool{layer}
+	case *AvgPoolingLayer:
+		return compiledAvgPool{layer}
+	case *SoftmaxLayer:
+		return compiledSoftmax{layer: layer}
+	case *LogSoftmaxLayer:
+		return compiledSoftmax{log: true}
+	case *DropoutLayer:
+		return compiledDropout{layer}
+	case Sigmoid, *Sigmoid:
+		return compiledElementwise(sigmoid)
+	case ReLU, *ReLU:
+		return compiledElementwise(func(x float64) float64 {
+			return math.Max(x, 0)
+		})
+	case HyperbolicTangent, *HyperbolicTangent:
+		return compiledElementwise(func(x float64) float64 {
+			return 2*sigmoid(2*x) - 1
+		})
+	case LeakyReLU:
+		return compiledElementwise(layer.elementwise().F)
+	case *LeakyReLU:
+		return compiledElementwise(layer.elementwise().F)
+	case ELU:
+		return compiledElementwise(eluFunc(layer.Alpha, 1).F)
+	case *ELU:
+		return compiledElementwise(eluFunc(layer.Alpha, 1).F)
+	case SELU, *SELU:
+		return compiledElementwise(eluFunc(seluAlpha, seluScale).F)
+	case Softplus, *Softplus:
+		return compiledElementwise(softplusFunc.F)
+	case Swish, *Swish, SiLU, *SiLU:
+		return compiledElementwise(swishFunc.F)
+	case GELU, *GELU:
+		return compiledElementwise(geluFunc.F)
+	case HardTanh, *HardTanh:
+		return compiledElementwise(hardTanhFunc.F)
+	default:
+		return compiledFallback{layer}
+	}
+}
+
+// resizeBuffer returns a vector of the given size which
+// uses the memory of *buf when possible.
+func resizeBuffer(buf *linalg.Vector, size int) linalg.Vector {
+	if cap(*buf) < size {
+		*buf = make(linalg.Vector, size)
+	}
+	return (*buf)[:size]
+}
+
+type compiledDense struct {
+	layer *DenseLayer
+}
+
+func (c compiledDense) evaluate(in linalg.Vector, n int, buf *linalg.Vector) linalg.Vector {
+	d := c.layer
+	if d.Weights == nil || d.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	if len(in) != n*d.InputCount {
+		panic("invalid input size")
+	}
+	out := resizeBuffer(buf, n*d.OutputCount)
+	inMat := blas64.General{
+		Rows:   n,
+		Cols:   d.InputCount,
+		Stride: d.InputCount,
+		Data:   in,
+	}
+	weightMat := blas64.General{
+		Rows:   d.OutputCount,
+		Cols:   d.InputCount,
+		Stride: d.InputCount,
+		Data:   d.Weights.Data.Vector,
+	}
+	outMat := blas64.General{
+		Rows:   n,
+		Cols:   d.OutputCount,
+		Stride: d.OutputCount,
+		Data:   out,
+	}
+	blas64.Gemm(blas.NoTrans, blas.Trans, 1, inMat, weightMat, 0, outMat)
+
+	biases := d.Biases.Var.Vector
+	for i := 0; i < len(out); i += d.OutputCount {
+		out[i : i+d.OutputCount].Add(biases)
+	}
+	return out
+}
+
+type compiledConv struct {
+	layer *ConvLayer
+
+	// colBuffers stores *linalg.Vector buffers for the
+	// im2col matrices of entire batches.
+	colBuffers sync.Pool
+}
+
+func newCompiledConv(layer *ConvLayer) *compiledConv {
+	res := &compiledConv{layer: layer}
+	res.colBuffers.New = func() interface{} {
+		return new(linalg.Vector)
+	}
+	return res
+}
+
+func (c *compiledConv) evaluate(in linalg.Vector, n int, buf *linalg.Vector) linalg.Vector {
+	l := c.layer
+	if l.Filters == nil || l.Biases == nil || l.FilterVar == nil {
+		panic(uninitPanicMessage)
+	}
+	inSize := l.InputWidth * l.InputHeight * l.InputDepth
+	outSize := l.OutputWidth() * l.OutputHeight() * l.OutputDepth()
+	if len(in) != n*inSize {
+		panic("invalid input size")
+	}
+
+	// Every sample's im2col matrix is stacked into one
+	// matrix so that a single Gemm covers the batch.
+	rows := l.OutputWidth() * l.OutputHeight()
+	cols := l.FilterWidth * l.FilterHeight * l.InputDepth
+	colBuf := c.colBuffers.Get().(*linalg.Vector)
+	defer c.colBuffers.Put(colBuf)
+	colData := resizeBuffer(colBuf, n*rows*cols)
+	for i := 0; i < n; i++ {
+		padded := l.paddedInput(in[i*inSize : (i+1)*inSize])
+		padded.colDilatedInto(colData[i*rows*cols:(i+1)*rows*cols], l.FilterWidth,
+			l.FilterHeight, l.xStride(), l.yStride(), l.dilation())
+	}
+
+	out := resizeBuffer(buf, n*outSize)
+	inMat := blas64.General{
+		Rows:   n * rows,
+		Cols:   cols,
+		Stride: cols,
+		Data:   colData,
+	}
+	filterMat := blas64.General{
+		Rows:   l.FilterCount,
+		Cols:   cols,
+		Stride: cols,
+		Data:   l.FilterVar.Vector,
+	}
+	outMat := blas64.General{
+		Rows:   n * rows,
+		Cols:   l.FilterCount,
+		Stride: l.FilterCount,
+		Data:   out,
+	}
+	blas64.Gemm(blas.NoTrans, blas.Trans, 1, inMat, filterMat, 0, outMat)
+
+	biases := l.Biases.Vector
+	for i := 0; i < len(out); i += l.FilterCount {
+		out[i : i+l.FilterCount].Add(biases)
+	}
+	return out
+}
+
+type compiledMaxPool struct {
+	layer *MaxPoolingLayer
+}
+
+func (c compiledMaxPool) evaluate(in linalg.Vector, n int, buf *linalg.Vector) linalg.Vector {
+	m := c.layer
+	inSize := m.InputWidth * m.InputHeight * m.InputDepth
+	outSize := m.OutputWidth() * m.OutputHeight() * m.InputDepth
+	if len(in) != n*inSize {
+		panic("invalid input size")
+	}
+	out := resizeBuffer(buf, n*outSize)
+	for i := 0; i < n; i++ {
+		inTensor := m.inputTensor(in[i*inSize : (i+1)*inSize])
+		outTensor := m.outputTensor(out[i*outSize : (i+1)*outSize])
+		for y := 0; y < outTensor.Height; y++ {
+			poolY := y * m.YSpan
+			maxY := poolY + m.YSpan - 1
+			if maxY >= inTensor.Height {
+				maxY = inTensor.Height - 1
+			}
+			for x := 0; x < outTensor.Width; x++ {
+				poolX := x * m.XSpan
+				maxX := poolX + m.XSpan - 1
+				if maxX >= inTensor.Width {
+					maxX = inTensor.Width - 1
+				}
+				for z := 0; z < outTensor.Depth; z++ {
+					value, _, _ := maxInput(inTensor, poolX, maxX, poolY, maxY, z)
+					outTensor.Set(x, y, z, value)
+				}
+			}
+		}
+	}
+	return out
+}
+
+type compiledAvgPool struct {
+	layer *AvgPoolingLayer
+}
+
+func (c compiledAvgPool) evaluate(in linalg.Vector, n int, buf *linalg.Vector) linalg.Vector {
+	a := c.layer
+	inSize := a.InputWidth * a.InputHeight * a.InputDepth
+	outSize := a.OutputWidth() * a.OutputHeight() * a.InputDepth
+	if len(in) != n*inSize {
+		panic("invalid input size")
+	}
+	out := resizeBuffer(buf, n*outSize)
+	for i := 0; i < n; i++ {
+		inTensor := a.inputTensor(in[i*inSize : (i+1)*inSize])
+		outTensor := a.outputTensor(out[i*outSize : (i+1)*outSize])
+		a.evaluate(inTensor, outTensor)
+	}
+	return out
+}
+
+type compiledSoftmax struct {
+	layer *SoftmaxLayer
+	log   bool
+}
+
+func (c compiledSoftmax) evaluate(in linalg.Vector, n int, buf *linalg.Vector) linalg.Vector {
+	temp := 1.0
+	if c.layer != nil && c.layer.Temperature != 0 {
+		temp = c.layer.Temperature
+	}
+	out := resizeBuffer(buf, len(in))
+	size := len(in) / n
+	for i := 0; i < len(in); i += size {
+		subIn := in[i : i+size]
+		subOut := out[i : i+size]
+		max := subIn[maxVecIdx(subIn)]
+		var sum float64
+		for j, x := range subIn {
+			subOut[j] = (x - max) / temp
+			sum += math.Exp(subOut[j])
+		}
+		if c.log {
+			logSum := math.Log(sum)
+			for j := range subOut {
+				subOut[j] -= logSum
+			}
+		} else {
+			for j, x := range subOut {
+				subOut[j] = math.Exp(x) / sum
+			}
+		}
+	}
+	return out
+}
+
+type compiledDropout struct {
+	layer *DropoutLayer
+}
+
+func (c compiledDropout) evaluate(in linalg.Vector, n int, buf *linalg.Vector) linalg.Vector {
+	if c.layer.Training {
+		return compiledFallback{c.layer}.evaluate(in, n, buf)
+	}
+	out := resizeBuffer(buf, len(in))
+	for i, x := range in {
+		out[i] = x * c.layer.KeepProbability
+	}
+	return out
+}
+
+type compiledElementwise func(float64) float64
+
+func (c compiledElementwise) evaluate(in linalg.Vector, n int, buf *linalg.Vector) linalg.Vector {
+	out := resizeBuffer(buf, len(in))
+	for i, x := range in {
+		out[i] = c(x)
+	}
+	return out
+}
+
+type compiledFallback struct {
+	layer Layer
+}
+
+func (c compiledFallback) evaluate(in linalg.Vector, n int, buf *linalg.Vector) linalg.Vector {
+	var output linalg.Vector
+	if b, ok := c.layer.(autofunc.Batcher); ok {
+		output = b.Batch(&autofunc.Variable{Vector: in}, n).Output()
+	} else {
+		inSize := len(in) / n
+		for i := 0; i < n; i++ {
+			subIn := &autofunc.Variable{Vector: in[i*inSize : (i+1)*inSize]}
+			output = append(output, c.layer.Apply(subIn).Output()...)
+		}
+	}
+	out := resizeBuffer(buf, len(output))
+	copy(out, output)
+	return out
+}
@@ -0,0 +1,181 @@
+package neuralnet
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestCompiledNetworkDense(t *testing.T) {
+	net := Network{
+		&DenseLayer{InputCount: 4, OutputCount: 6},
+		&Sigmoid{},
+		&DenseLayer{InputCount: 6, OutputCount: 6},
+		&HyperbolicTangent{},
+		&DenseLayer{InputCount: 6, OutputCount: 6},
+		&ReLU{},
+		&LeakyReLU{Slope: 0.1},
+		&ELU{Alpha: 0.5},
+		SELU{},
+		&Softplus{},
+		&Swish{},
+		&GELU{},
+		&HardTanh{},
+		&DenseLayer{InputCount: 6, OutputCount: 3},
+		&SoftmaxLayer{Temperature: 2},
+	}
+	net.Randomize()
+	testCompiledNetwork(t, net, 4)
+}
+
+func TestCompiledNetworkConv(t *testing.T) {
+	conv := &ConvLayer{
+		FilterCount:  3,
+		FilterWidth:  3,
+		FilterHeight: 3,
+		Stride:       1,
+		InputWidth:   9,
+		InputHeight:  8,
+		InputDepth:   2,
+	}
+	maxPool := &MaxPoolingLayer{
+		XSpan:       2,
+		YSpan:       3,
+		InputWidth:  conv.OutputWidth(),
+		InputHeight: conv.OutputHeight(),
+		InputDepth:  conv.OutputDepth(),
+	}
+	avgPool := &AvgPoolingLayer{
+		XSpan:       2,
+		YSpan:       2,
+		XStride:     1,
+		InputWidth:  maxPool.OutputWidth(),
+		InputHeight: maxPool.OutputHeight(),
+		InputDepth:  maxPool.InputDepth,
+	}
+	outSize := avgPool.OutputWidth() * avgPool.OutputHeight() * avgPool.InputDepth
+	net := Network{
+		conv,
+		&ReLU{},
+		maxPool,
+		avgPool,
+		&DropoutLayer{KeepProbability: 0.7},
+		&DenseLayer{InputCount: outSize, OutputCount: 4},
+		&LogSoftmaxLayer{},
+	}
+	net.Randomize()
+	testCompiledNetwork(t, net, 9*8*2)
+}
+
+func TestCompiledNetworkConvGeometry(t *testing.T) {
+	layers := []*ConvLayer{
+		{FilterCount: 2, FilterWidth: 3, FilterHeight: 2, Stride: 2, SamePadding: true,
+			InputWidth: 7, InputHeight: 6, InputDepth: 3},
+		{FilterCount: 4, FilterWidth: 2, FilterHeight: 2, XStride: 1, YStride: 2,
+			Dilation: 2, PaddingX: 1, InputWidth: 6, InputHeight: 7, InputDepth: 2},
+	}
+	for _, layer := range layers {
+		net := Network{layer}
+		net.Randomize()
+		testCompiledNetwork(t, net, layer.InputWidth*layer.InputHeight*layer.InputDepth)
+	}
+}
+
+func TestCompiledNetworkEmptyBatch(t *testing.T) {
+	net := Network{&DenseLayer{InputCount: 3, OutputCount: 2}}
+	net.Randomize()
+	compiled := net.Compile()
+	for _, n := range []int{0, -1} {
+		func() {
+			defer func() {
+				if r := recover(); r != "batch size must be positive" {
+					t.Errorf("batch size %d: unexpected panic %v", n, r)
+				}
+			}()
+			compiled.Batch(linalg.Vector{}, n)
+		}()
+	}
+}
+
+func TestCompiledNetworkFallback(t *testing.T) {
+	net := Network{
+		&DenseLayer{InputCount: 3, OutputCount: 5},
+		NewLayerNorm(5),
+		&RescaleLayer{Bias: 0.5, Scale: 2},
+		Network{
+			&DenseLayer{InputCount: 5, OutputCount: 2},
+			&Sigmoid{},
+		},
+	}
+	net.Randomize()
+	testCompiledNetwork(t, net, 3)
+}
+
+func TestCompiledNetworkConcurrency(t *testing.T) {
+	net := Network{
+		&DenseLayer{InputCount: 5, OutputCount: 8},
+		&Sigmoid{},
+		&DenseLayer{InputCount: 8, OutputCount: 2},
+	}
+	net.Randomize()
+	compiled := net.Compile()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				n := rand.Intn(4) + 1
+				in := randomCompiledInput(5 * n)
+				expected := net.BatchLearner().Batch(&autofunc.Variable{Vector: in}, n).Output()
+				actual := compiled.Batch(in, n)
+				if !compiledOutputsMatch(expected, actual) {
+					t.Errorf("expected %v but got %v", expected, actual)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func testCompiledNetwork(t *testing.T, net Network, inSize int) {
+	compiled := net.Compile()
+
+	in := randomCompiledInput(inSize)
+	expected := net.Apply(&autofunc.Variable{Vector: in}).Output()
+	actual := compiled.Apply(in)
+	if !compiledOutputsMatch(expected, actual) {
+		t.Errorf("single: expected %v but got %v", expected, actual)
+	}
+
+	// Run several batches of different sizes so that the
+	// reused buffers must be resized.
+	for _, n := range []int{3, 1, 5} {
+		in := randomCompiledInput(inSize * n)
+		expected := net.BatchLearner().Batch(&autofunc.Variable{Vector: in}, n).Output()
+		actual := compiled.Batch(in, n)
+		if !compiledOutputsMatch(expected, actual) {
+			t.Errorf("batch %d: expected %v but got %v", n, expected, actual)
+		}
+	}
+}
+
+func randomCompiledInput(size int) linalg.Vector {
+	res := make(linalg.Vector, size)
+	for i := range res {
+		res[i] = rand.NormFloat64()
+	}
+	return res
+}
+
+func compiledOutputsMatch(expected, actual linalg.Vector) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	return actual.Copy().Scale(-1).Add(expected).MaxAbs() < 1e-8
+}
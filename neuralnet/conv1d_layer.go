@@ -0,0 +1,159 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// Conv1DLayer is a convolutional layer for sequences.
+//
+// An input is a sequence of InputLength vectors, each of
+// size InputDepth, concatenated one after the other.
+// The output is likewise a sequence of OutputLength()
+// vectors, each of size FilterCount.
+//
+// The stride, dilation, and padding behave as they do
+// for ConvLayer, but only along the sequence.
+type Conv1DLayer struct {
+	FilterCount int
+	FilterSize  int
+	Stride      int
+	Dilation    int
+	Padding     int
+	SamePadding bool
+
+	InputLength int
+	InputDepth  int
+
+	// Filters stores all of the filters one after the
+	// other, each being a FilterSize by InputDepth matrix
+	// stored in row-major order.
+	Filters *autofunc.Variable
+
+	Biases *autofunc.Variable
+}
+
+// DeserializeConv1DLayer deserializes a Conv1DLayer.
+func DeserializeConv1DLayer(d []byte) (*Conv1DLayer, error) {
+	var res Conv1DLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// OutputLength computes the length of the output
+// sequence.
+func (c *Conv1DLayer) OutputLength() int {
+	return c.geometry().OutputWidth()
+}
+
+// OutputDepth returns the size of each output vector.
+func (c *Conv1DLayer) OutputDepth() int {
+	return c.FilterCount
+}
+
+// Randomize randomly initializes the layer's filters and
+// biases.
+// This will allocate c.Filters and c.Biases if needed.
+func (c *Conv1DLayer) Randomize() {
+	if c.Filters == nil {
+		c.Filters = &autofunc.Variable{
+			Vector: make(linalg.Vector, c.FilterCount*c.FilterSize*c.InputDepth),
+		}
+	}
+	if c.Biases == nil {
+		c.Biases = &autofunc.Variable{Vector: make(linalg.Vector, c.FilterCount)}
+	}
+	coeff := math.Sqrt(3.0 / float64(c.FilterSize*c.InputDepth))
+	for i := range c.Filters.Vector {
+		c.Filters.Vector[i] = coeff * ((rand.Float64() * 2) - 1)
+	}
+	for i := range c.Biases.Vector {
+		c.Biases.Vector[i] = (rand.Float64() * 2) - 1
+	}
+}
+
+// Parameters returns a slice containing the bias
+// and filter variables.
+func (c *Conv1DLayer) Parameters() []*autofunc.Variable {
+	if c.Filters == nil || c.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{c.Biases, c.Filters}
+}
+
+// Apply computes convolutions on the input.
+func (c *Conv1DLayer) Apply(in autofunc.Result) autofunc.Result {
+	return c.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for autofunc.RResults.
+func (c *Conv1DLayer) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return c.BatchR(v, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (c *Conv1DLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	return c.convLayer().Batch(in, n)
+}
+
+// BatchR is like Batch, but for RResults.
+func (c *Conv1DLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	return c.convLayer().BatchR(rv, in, n)
+}
+
+// Serialize serializes the layer.
+func (c *Conv1DLayer) Serialize() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (c *Conv1DLayer) SerializerType() string {
+	return serializerTypeConv1DLayer
+}
+
+// geometry creates a ConvLayer with the same input and
+// output shapes as c, without any filters.
+func (c *Conv1DLayer) geometry() *ConvLayer {
+	return &ConvLayer{
+		FilterCount:  c.FilterCount,
+		FilterWidth:  c.FilterSize,
+		FilterHeight: 1,
+		Stride:       c.Stride,
+		YStride:      1,
+		Dilation:     c.Dilation,
+		PaddingX:     c.Padding,
+		SamePadding:  c.SamePadding,
+		InputWidth:   c.InputLength,
+		InputHeight:  1,
+		InputDepth:   c.InputDepth,
+	}
+}
+
+// convLayer creates a ConvLayer which shares c's
+// parameters and computes the same function as c.
+func (c *Conv1DLayer) convLayer() *ConvLayer {
+	if c.Filters == nil || c.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	res := c.geometry()
+	filterSize := c.FilterSize * c.InputDepth
+	for i := 0; i < c.FilterCount; i++ {
+		res.Filters = append(res.Filters, &Tensor3{
+			Width:  c.FilterSize,
+			Height: 1,
+			Depth:  c.InputDepth,
+			Data:   c.Filters.Vector[i*filterSize : (i+1)*filterSize],
+		})
+	}
+	res.FilterVar = c.Filters
+	res.Biases = c.Biases
+	return res
+}
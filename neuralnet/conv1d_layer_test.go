@@ -0,0 +1,57 @@
+package neuralnet
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestConv1DOutput(t *testing.T) {
+	layers := []*Conv1DLayer{
+		{FilterCount: 3, FilterSize: 3, Stride: 1, InputLength: 7, InputDepth: 2},
+		{FilterCount: 2, FilterSize: 2, Stride: 2, Dilation: 2, SamePadding: true,
+			InputLength: 9, InputDepth: 3},
+		{FilterCount: 4, FilterSize: 3, Stride: 3, Padding: 2, InputLength: 6,
+			InputDepth: 1},
+	}
+	outLens := []int{5, 5, 3}
+	for i, layer := range layers {
+		layer.Randomize()
+		if layer.OutputLength() != outLens[i] {
+			t.Errorf("test %d: expected length %d but got %d", i, outLens[i],
+				layer.OutputLength())
+		}
+
+		equiv := &ConvLayer{
+			FilterCount:  layer.FilterCount,
+			FilterWidth:  layer.FilterSize,
+			FilterHeight: 1,
+			Stride:       layer.Stride,
+			YStride:      1,
+			Dilation:     layer.Dilation,
+			PaddingX:     layer.Padding,
+			SamePadding:  layer.SamePadding,
+			InputWidth:   layer.InputLength,
+			InputHeight:  1,
+			InputDepth:   layer.InputDepth,
+		}
+		equiv.Randomize()
+		copy(equiv.FilterVar.Vector, layer.Filters.Vector)
+		copy(equiv.Biases.Vector, layer.Biases.Vector)
+
+		inVar := &autofunc.Variable{
+			Vector: make(linalg.Vector, layer.InputLength*layer.InputDepth),
+		}
+		for j := range inVar.Vector {
+			inVar.Vector[j] = rand.NormFloat64()
+		}
+		expected := equiv.Apply(inVar).Output()
+		actual := layer.Apply(inVar).Output()
+		if len(actual) != len(expected) ||
+			actual.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-6 {
+			t.Errorf("test %d: expected %v but got %v", i, expected, actual)
+		}
+	}
+}
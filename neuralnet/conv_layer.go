@@ -12,12 +12,43 @@ import (
 
 // ConvLayer is a convolutional layer for
 // a neural network.
+//
+// By default, a ConvLayer performs "valid" convolutions,
+// meaning that filters never go past the edges of the
+// input tensor.
+// Zero padding can be added around the input, either
+// explicitly or automatically via SamePadding.
 type ConvLayer struct {
 	FilterCount  int
 	FilterWidth  int
 	FilterHeight int
 	Stride       int
 
+	// XStride and YStride, if non-zero, override Stride
+	// for the horizontal and vertical directions.
+	XStride int
+	YStride int
+
+	// Dilation is the distance between the input entries
+	// covered by neighboring filter entries.
+	// A Dilation of 0 is treated like a Dilation of 1,
+	// which means that filters are not dilated.
+	Dilation int
+
+	// PaddingX and PaddingY are the number of zeros to
+	// add to each side of the input horizontally and
+	// vertically.
+	PaddingX int
+	PaddingY int
+
+	// SamePadding, if true, overrides PaddingX and
+	// PaddingY and pads the input so that the output's
+	// width and height are the input's width and height
+	// divided by the strides (rounded up).
+	// If an odd amount of padding is needed, the extra
+	// zeros are added to the right and bottom.
+	SamePadding bool
+
 	InputWidth  int
 	InputHeight int
 	InputDepth  int
@@ -54,19 +85,13 @@ func DeserializeConvLayer(data []byte) (*ConvLayer, error) {
 
 // OutputWidth computes the width of the output tensor.
 func (c *ConvLayer) OutputWidth() int {
-	w := 1 + (c.InputWidth-c.FilterWidth)/c.Stride
-	if w < 0 {
-		return 0
-	}
+	w, _ := c.outputSize()
 	return w
 }
 
 // OutputHeight computes the height of the output tensor.
 func (c *ConvLayer) OutputHeight() int {
-	h := 1 + (c.InputHeight-c.FilterHeight)/c.Stride
-	if h < 0 {
-		return 0
-	}
+	_, h := c.outputSize()
 	return h
 }
 
@@ -253,6 +278,49 @@ func (c *ConvLayer) convolveR(v autofunc.RVector, in, inR linalg.Vector, out *Te
 	}
 }
 
+func (c *ConvLayer) xStride() int {
+	if c.XStride != 0 {
+		return c.XStride
+	}
+	return c.Stride
+}
+
+func (c *ConvLayer) yStride() int {
+	if c.YStride != 0 {
+		return c.YStride
+	}
+	return c.Stride
+}
+
+func (c *ConvLayer) dilation() int {
+	if c.Dilation < 1 {
+		return 1
+	}
+	return c.Dilation
+}
+
+// padding computes the number of zeros to add to
+// each side of the input.
+func (c *ConvLayer) padding() (left, right, top, bottom int) {
+	if !c.SamePadding {
+		return c.PaddingX, c.PaddingX, c.PaddingY, c.PaddingY
+	}
+	left, right = samePadding(c.InputWidth, c.FilterWidth, c.xStride(), c.dilation())
+	top, bottom = samePadding(c.InputHeight, c.FilterHeight, c.yStride(), c.dilation())
+	return
+}
+
+func (c *ConvLayer) paddedSize() (width, height int) {
+	left, right, top, bottom := c.padding()
+	return c.InputWidth + left + right, c.InputHeight + top + bottom
+}
+
+func (c *ConvLayer) outputSize() (width, height int) {
+	paddedWidth, paddedHeight := c.paddedSize()
+	return dilatedColSize(paddedWidth, paddedHeight, c.FilterWidth, c.FilterHeight,
+		c.xStride(), c.yStride(), c.dilation())
+}
+
 func (c *ConvLayer) inputToTensor(in linalg.Vector) *Tensor3 {
 	return &Tensor3{
 		Width:  c.InputWidth,
@@ -262,16 +330,46 @@ func (c *ConvLayer) inputToTensor(in linalg.Vector) *Tensor3 {
 	}
 }
 
-func (c *ConvLayer) inputToMatrix(in linalg.Vector) blas64.General {
+// paddedInput pads an input tensor with zeros.
+func (c *ConvLayer) paddedInput(in linalg.Vector) *Tensor3 {
 	inTensor := c.inputToTensor(in)
+	left, _, top, _ := c.padding()
+	width, height := c.paddedSize()
+	if width == c.InputWidth && height == c.InputHeight {
+		return inTensor
+	}
+	res := NewTensor3(width, height, c.InputDepth)
+	res.MulAdd(left, top, inTensor, 1)
+	return res
+}
+
+func (c *ConvLayer) inputToMatrix(in linalg.Vector) blas64.General {
+	inTensor := c.paddedInput(in)
 	return blas64.General{
 		Rows:   c.OutputWidth() * c.OutputHeight(),
 		Cols:   c.FilterWidth * c.FilterHeight * c.InputDepth,
 		Stride: c.FilterWidth * c.FilterHeight * c.InputDepth,
-		Data:   inTensor.ToCol(c.FilterWidth, c.FilterHeight, c.Stride),
+		Data: inTensor.toColDilated(c.FilterWidth, c.FilterHeight, c.xStride(),
+			c.yStride(), c.dilation()),
 	}
 }
 
+// matrixToInput inverts inputToMatrix, summing the
+// entries of the matrix which correspond to the same
+// input entry, and writing the result to out.
+// Entries which correspond to padding are discarded.
+func (c *ConvLayer) matrixToInput(mat blas64.General, out linalg.Vector) {
+	width, height := c.paddedSize()
+	padded := newTensor3ColDilated(width, height, c.InputDepth, mat.Data,
+		c.FilterWidth, c.FilterHeight, c.xStride(), c.yStride(), c.dilation())
+	if width == c.InputWidth && height == c.InputHeight {
+		copy(out, padded.Data)
+		return
+	}
+	left, _, top, _ := c.padding()
+	padded.Crop(left, top, c.inputToTensor(out))
+}
+
 func (c *ConvLayer) outputToTensor(out linalg.Vector) *Tensor3 {
 	return &Tensor3{
 		Width:  c.OutputWidth(),
@@ -358,10 +456,7 @@ func (c *convLayerResult) propagateSingle(input, upstream, downstream linalg.Vec
 			Data:   c.Layer.FilterVar.Vector,
 		}
 		blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, upstreamMat, filterMat, 0, inDeriv)
-		flattened := NewTensor3Col(c.Layer.InputWidth, c.Layer.InputHeight,
-			c.Layer.InputDepth, inDeriv.Data, c.Layer.FilterWidth,
-			c.Layer.FilterHeight, c.Layer.Stride)
-		copy(downstream, flattened.Data)
+		c.Layer.matrixToInput(inDeriv, downstream)
 	}
 
 	if filterGrad, ok := grad[c.Layer.FilterVar]; ok {
@@ -494,20 +589,14 @@ func (c *convLayerRResult) propagateSingle(input, inputR, upstream, upstreamR, d
 			Data:   c.Layer.FilterVar.Vector,
 		}
 		blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, upstreamMat, filterMat, 0, inDeriv)
-		flattened := NewTensor3Col(c.Layer.InputWidth, c.Layer.InputHeight,
-			c.Layer.InputDepth, inDeriv.Data, c.Layer.FilterWidth,
-			c.Layer.FilterHeight, c.Layer.Stride)
-		copy(downstream, flattened.Data)
+		c.Layer.matrixToInput(inDeriv, downstream)
 
 		blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, upstreamMatR, filterMat, 0, inDeriv)
 		if c.FiltersR != nil {
 			filterMat.Data = c.FiltersR
 			blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, upstreamMat, filterMat, 1, inDeriv)
 		}
-		flattened = NewTensor3Col(c.Layer.InputWidth, c.Layer.InputHeight,
-			c.Layer.InputDepth, inDeriv.Data, c.Layer.FilterWidth,
-			c.Layer.FilterHeight, c.Layer.Stride)
-		copy(downstreamR, flattened.Data)
+		c.Layer.matrixToInput(inDeriv, downstreamR)
 	}
 
 	filterGrad, hasFilterGrad := grad[c.Layer.FilterVar]
@@ -540,3 +629,18 @@ func (c *convLayerRResult) propagateSingle(input, inputR, upstream, upstreamR, d
 		blas64.Gemm(blas.Trans, blas.NoTrans, 1, upstreamMat, inMatrixR, 1, destMat)
 	}
 }
+
+// samePadding computes the padding needed on either side
+// of an input so that a convolution's output size is
+// the input size divided by the stride (rounded up).
+func samePadding(inSize, filterSize, stride, dilation int) (before, after int) {
+	outSize := (inSize + stride - 1) / stride
+	spanSize := (filterSize-1)*dilation + 1
+	total := (outSize-1)*stride + spanSize - inSize
+	if total < 0 {
+		total = 0
+	}
+	before = total / 2
+	after = total - before
+	return
+}
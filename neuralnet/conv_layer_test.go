@@ -14,13 +14,27 @@ import (
 
 func TestConvDimensions(t *testing.T) {
 	layers := []*ConvLayer{
-		{1, 3, 3, 1, 9, 9, 1, nil, nil, nil},
-		{5, 4, 7, 2, 17, 56, 18, nil, nil, nil},
+		{FilterCount: 1, FilterWidth: 3, FilterHeight: 3, Stride: 1,
+			InputWidth: 9, InputHeight: 9, InputDepth: 1},
+		{FilterCount: 5, FilterWidth: 4, FilterHeight: 7, Stride: 2,
+			InputWidth: 17, InputHeight: 56, InputDepth: 18},
+		{FilterCount: 1, FilterWidth: 3, FilterHeight: 3, Stride: 1,
+			SamePadding: true, InputWidth: 9, InputHeight: 9, InputDepth: 1},
+		{FilterCount: 1, FilterWidth: 4, FilterHeight: 3, XStride: 2, YStride: 1,
+			SamePadding: true, InputWidth: 9, InputHeight: 8, InputDepth: 1},
+		{FilterCount: 1, FilterWidth: 3, FilterHeight: 3, Stride: 1, Dilation: 2,
+			InputWidth: 9, InputHeight: 9, InputDepth: 1},
+		{FilterCount: 1, FilterWidth: 3, FilterHeight: 3, Stride: 2, PaddingX: 1,
+			PaddingY: 2, InputWidth: 9, InputHeight: 9, InputDepth: 1},
 	}
 
 	outputDims := [][]int{
 		{7, 7},
 		{7, 25},
+		{9, 9},
+		{5, 8},
+		{5, 5},
+		{5, 6},
 	}
 
 	for i, layer := range layers {
@@ -240,6 +254,273 @@ func TestConvLayerBatchR(t *testing.T) {
 	testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec), n, params)
 }
 
+func TestConvLayerPadding(t *testing.T) {
+	layer := &ConvLayer{
+		FilterCount:  2,
+		FilterWidth:  3,
+		FilterHeight: 2,
+		Stride:       2,
+		PaddingX:     2,
+		PaddingY:     1,
+		InputWidth:   5,
+		InputHeight:  4,
+		InputDepth:   3,
+	}
+	layer.Randomize()
+	border := &BorderLayer{
+		InputWidth:   5,
+		InputHeight:  4,
+		InputDepth:   3,
+		LeftBorder:   2,
+		RightBorder:  2,
+		TopBorder:    1,
+		BottomBorder: 1,
+	}
+	unpadded := &ConvLayer{
+		FilterCount:  2,
+		FilterWidth:  3,
+		FilterHeight: 2,
+		Stride:       2,
+		InputWidth:   9,
+		InputHeight:  6,
+		InputDepth:   3,
+		Filters:      layer.Filters,
+		Biases:       layer.Biases,
+		FilterVar:    layer.FilterVar,
+	}
+	testConvEquivalence(t, layer, border, unpadded)
+}
+
+func TestConvLayerDilation(t *testing.T) {
+	layer := &ConvLayer{
+		FilterCount:  2,
+		FilterWidth:  2,
+		FilterHeight: 3,
+		XStride:      1,
+		YStride:      2,
+		Dilation:     2,
+		InputWidth:   7,
+		InputHeight:  8,
+		InputDepth:   2,
+	}
+	layer.Randomize()
+
+	// A dilated filter is equivalent to a larger
+	// filter with zeros between its entries.
+	undilated := &ConvLayer{
+		FilterCount:  2,
+		FilterWidth:  3,
+		FilterHeight: 5,
+		XStride:      1,
+		YStride:      2,
+		InputWidth:   7,
+		InputHeight:  8,
+		InputDepth:   2,
+	}
+	undilated.Randomize()
+	copy(undilated.Biases.Vector, layer.Biases.Vector)
+	for i, filter := range layer.Filters {
+		bigFilter := undilated.Filters[i]
+		bigFilter.Reset()
+		for y := 0; y < filter.Height; y++ {
+			for x := 0; x < filter.Width; x++ {
+				for z := 0; z < filter.Depth; z++ {
+					bigFilter.Set(x*2, y*2, z, filter.Get(x, y, z))
+				}
+			}
+		}
+	}
+
+	input := make(linalg.Vector, 7*8*2)
+	for i := range input {
+		input[i] = rand.NormFloat64()
+	}
+	inVar := &autofunc.Variable{Vector: input}
+	expected := undilated.Apply(inVar).Output()
+	actual := layer.Apply(inVar).Output()
+	if len(expected) != len(actual) {
+		t.Fatalf("expected output size %d but got %d", len(expected), len(actual))
+	}
+	if actual.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-5 {
+		t.Errorf("expected output %v but got %v", expected, actual)
+	}
+}
+
+func TestConvLayerSamePadding(t *testing.T) {
+	layer := &ConvLayer{
+		FilterCount:  2,
+		FilterWidth:  4,
+		FilterHeight: 3,
+		XStride:      2,
+		YStride:      1,
+		SamePadding:  true,
+		InputWidth:   7,
+		InputHeight:  5,
+		InputDepth:   2,
+	}
+	layer.Randomize()
+
+	// The width needs 3 zeros of padding: 1 on the left
+	// and 2 on the right.
+	explicit := &ConvLayer{
+		FilterCount:  2,
+		FilterWidth:  4,
+		FilterHeight: 3,
+		XStride:      2,
+		YStride:      1,
+		InputWidth:   10,
+		InputHeight:  7,
+		InputDepth:   2,
+		Filters:      layer.Filters,
+		Biases:       layer.Biases,
+		FilterVar:    layer.FilterVar,
+	}
+	border := &BorderLayer{
+		InputWidth:   7,
+		InputHeight:  5,
+		InputDepth:   2,
+		LeftBorder:   1,
+		RightBorder:  2,
+		TopBorder:    1,
+		BottomBorder: 1,
+	}
+	if layer.OutputWidth() != 4 || layer.OutputHeight() != 5 {
+		t.Fatalf("unexpected output size %dx%d", layer.OutputWidth(),
+			layer.OutputHeight())
+	}
+	testConvEquivalence(t, layer, border, explicit)
+}
+
+func TestConvLayerExtendedRProp(t *testing.T) {
+	layer := &ConvLayer{
+		FilterCount:  3,
+		FilterWidth:  2,
+		FilterHeight: 3,
+		XStride:      2,
+		YStride:      1,
+		Dilation:     2,
+		PaddingX:     1,
+		PaddingY:     2,
+		InputWidth:   5,
+		InputHeight:  4,
+		InputDepth:   2,
+	}
+	layer.Randomize()
+
+	input := make(linalg.Vector, 5*4*2)
+	for i := range input {
+		input[i] = rand.Float64()*2 - 1
+	}
+	inVar := &autofunc.Variable{Vector: input}
+
+	variables := append(layer.Parameters(), inVar)
+	rVector := autofunc.RVector{}
+	for _, variable := range variables {
+		rVector[variable] = make(linalg.Vector, len(variable.Vector))
+		for i := range rVector[variable] {
+			rVector[variable][i] = rand.Float64()*2 - 1
+		}
+	}
+	funcTest := &functest.RFuncTest{
+		F:     layer,
+		Vars:  variables,
+		Input: inVar,
+		RV:    rVector,
+	}
+	funcTest.Run(t)
+}
+
+func TestConvLayerLegacyDeserialize(t *testing.T) {
+	data := []byte(`{"FilterCount":1,"FilterWidth":2,"FilterHeight":2,"Stride":2,` +
+		`"InputWidth":4,"InputHeight":4,"InputDepth":1,` +
+		`"Filters":[{"Width":2,"Height":2,"Depth":1,"Data":[1,2,3,4]}],` +
+		`"Biases":{"Vector":[0.5]}}`)
+	layer, err := DeserializeConvLayer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layer.OutputWidth() != 2 || layer.OutputHeight() != 2 {
+		t.Fatalf("unexpected output size %dx%d", layer.OutputWidth(),
+			layer.OutputHeight())
+	}
+	input := &autofunc.Variable{Vector: linalg.Vector{
+		1, 0, 0, 1,
+		0, 0, 1, 0,
+		2, 0, 0, 0,
+		0, 0, 0, 1,
+	}}
+	expected := []float64{1.5, 5.5, 2.5, 4.5}
+	actual := layer.Apply(input).Output()
+	for i, x := range expected {
+		if math.Abs(actual[i]-x) > 1e-6 {
+			t.Errorf("output %d: expected %f got %f", i, x, actual[i])
+		}
+	}
+}
+
+func testConvEquivalence(t *testing.T, layer *ConvLayer, border *BorderLayer,
+	expectedLayer *ConvLayer) {
+	inSize := layer.InputWidth * layer.InputHeight * layer.InputDepth
+	input := make(linalg.Vector, inSize)
+	inputR := make(linalg.Vector, inSize)
+	for i := range input {
+		input[i] = rand.NormFloat64()
+		inputR[i] = rand.NormFloat64()
+	}
+	inVar := &autofunc.Variable{Vector: input}
+	params := append(layer.Parameters(), inVar)
+	rVec := autofunc.RVector{inVar: inputR}
+	for _, param := range layer.Parameters() {
+		rVec[param] = make(linalg.Vector, len(param.Vector))
+		for i := range rVec[param] {
+			rVec[param][i] = rand.NormFloat64()
+		}
+	}
+
+	var expectedIn autofunc.RResult = autofunc.NewRVariable(inVar, rVec)
+	if border != nil {
+		expectedIn = border.ApplyR(expectedIn)
+	}
+	expected := expectedLayer.ApplyR(rVec, expectedIn)
+	actual := layer.ApplyR(rVec, autofunc.NewRVariable(inVar, rVec))
+	if len(expected.Output()) != len(actual.Output()) {
+		t.Fatalf("expected output size %d but got %d", len(expected.Output()),
+			len(actual.Output()))
+	}
+	if diff := actual.Output().Copy().Scale(-1).Add(expected.Output()).MaxAbs(); diff > 1e-5 {
+		t.Errorf("expected output %v but got %v", expected.Output(), actual.Output())
+	}
+	if diff := actual.ROutput().Copy().Scale(-1).Add(expected.ROutput()).MaxAbs(); diff > 1e-5 {
+		t.Errorf("expected r-output %v but got %v", expected.ROutput(), actual.ROutput())
+	}
+
+	upstream := make(linalg.Vector, len(expected.Output()))
+	upstreamR := make(linalg.Vector, len(expected.Output()))
+	for i := range upstream {
+		upstream[i] = rand.NormFloat64()
+		upstreamR[i] = rand.NormFloat64()
+	}
+	expectedGrad := autofunc.NewGradient(params)
+	actualGrad := autofunc.NewGradient(params)
+	expectedRGrad := autofunc.NewRGradient(params)
+	actualRGrad := autofunc.NewRGradient(params)
+	expected.PropagateRGradient(upstream.Copy(), upstreamR.Copy(), expectedRGrad,
+		expectedGrad)
+	actual.PropagateRGradient(upstream, upstreamR, actualRGrad, actualGrad)
+	for i, param := range params {
+		diff := actualGrad[param].Copy().Scale(-1).Add(expectedGrad[param]).MaxAbs()
+		if diff > 1e-5 {
+			t.Errorf("param %d: expected gradient %v but got %v", i,
+				expectedGrad[param], actualGrad[param])
+		}
+		diff = actualRGrad[param].Copy().Scale(-1).Add(expectedRGrad[param]).MaxAbs()
+		if diff > 1e-5 {
+			t.Errorf("param %d: expected r-gradient %v but got %v", i,
+				expectedRGrad[param], actualRGrad[param])
+		}
+	}
+}
+
 func BenchmarkShallowConvLayer(b *testing.B) {
 	benchmarkConvLayer(b, &ConvLayer{
 		FilterCount:  48,
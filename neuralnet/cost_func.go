@@ -1,6 +1,7 @@
 package neuralnet
 
 import (
+	"math"
 	"sync"
 
 	"github.com/unixpickle/autofunc"
@@ -20,6 +21,80 @@ type CostFunc interface {
 		actual autofunc.RResult) autofunc.RResult
 }
 
+// A SeparableCost is a CostFunc which can report whether
+// or not it is separable.
+// A cost is separable if its value for several outputs
+// concatenated together is the sum of its values for
+// the individual outputs.
+//
+// BatchRGradienter applies CostFuncs to the concatenated
+// outputs of entire batches, unless they implement
+// SeparableCost and are not separable, in which case
+// they are applied to each sample separately.
+type SeparableCost interface {
+	CostFunc
+	Separable() bool
+}
+
+func costSeparable(c CostFunc) bool {
+	s, ok := c.(SeparableCost)
+	return !ok || s.Separable()
+}
+
+// batchCost applies a CostFunc to the concatenated
+// outputs of n samples.
+//
+// The penalty of a RegularizingCost is only added once,
+// even if its wrapped CostFunc is applied per sample.
+func batchCost(c CostFunc, x linalg.Vector, a autofunc.Result, n int) autofunc.Result {
+	if n == 1 || costSeparable(c) {
+		return c.Cost(x, a)
+	}
+	if r, ok := c.(*RegularizingCost); ok {
+		return r.addPenalty(batchCost(r.CostFunc, x, a, n))
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		xSize := len(x) / n
+		aSize := len(a.Output()) / n
+		var sum autofunc.Result
+		for i := 0; i < n; i++ {
+			cost := c.Cost(x[i*xSize:(i+1)*xSize], autofunc.Slice(a, i*aSize, (i+1)*aSize))
+			if sum == nil {
+				sum = cost
+			} else {
+				sum = autofunc.Add(sum, cost)
+			}
+		}
+		return sum
+	})
+}
+
+// batchCostR is like batchCost, but for RResults.
+func batchCostR(v autofunc.RVector, c CostFunc, x linalg.Vector, a autofunc.RResult,
+	n int) autofunc.RResult {
+	if n == 1 || costSeparable(c) {
+		return c.CostR(v, x, a)
+	}
+	if r, ok := c.(*RegularizingCost); ok {
+		return r.addPenaltyR(v, batchCostR(v, r.CostFunc, x, a, n))
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		xSize := len(x) / n
+		aSize := len(a.Output()) / n
+		var sum autofunc.RResult
+		for i := 0; i < n; i++ {
+			cost := c.CostR(v, x[i*xSize:(i+1)*xSize],
+				autofunc.SliceR(a, i*aSize, (i+1)*aSize))
+			if sum == nil {
+				sum = cost
+			} else {
+				sum = autofunc.AddR(sum, cost)
+			}
+		}
+		return sum
+	})
+}
+
 // TotalCost returns the total cost of a layer on a
 // set of VectorSamples.
 // The elements of s must be VectorSamples.
@@ -30,7 +105,7 @@ func TotalCost(c CostFunc, layer autofunc.Func, s sgd.SampleSet) float64 {
 		vs := sample.(VectorSample)
 		inVar := &autofunc.Variable{vs.Input}
 		result := layer.Apply(inVar)
-		costOut := c.Cost(vs.Output, result)
+		costOut := vs.costFunc(c).Cost(vs.maskedOutput(), result)
 		totalCost += costOut.Output()[0]
 	}
 	return totalCost
@@ -102,37 +177,115 @@ func (m *meanSquaredResult) PropagateGradient(upstream linalg.Vector, grad autof
 
 // CrossEntropyCost computes the cost using the
 // definition of cross entropy.
-type CrossEntropyCost struct{}
+//
+// If Smoothing is non-zero, label smoothing is applied
+// to the desired outputs, moving each one towards 1/2 by
+// replacing x with x*(1-Smoothing) + Smoothing/2.
+type CrossEntropyCost struct {
+	Smoothing float64
+}
 
-func (_ CrossEntropyCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+func (c CrossEntropyCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
 	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
-		xVar := &autofunc.Variable{x}
-		logA := autofunc.Log{}.Apply(a)
-		oneMinusA := autofunc.AddScaler(autofunc.Scale(a, -1), 1)
-		oneMinusX := autofunc.AddScaler(autofunc.Scale(xVar, -1), 1)
-		log1A := autofunc.Log{}.Apply(oneMinusA)
-
-		errorVec := autofunc.Add(autofunc.Mul(xVar, logA),
-			autofunc.Mul(oneMinusX, log1A))
-		return autofunc.Scale(autofunc.SumAll(errorVec), -1)
+		return autofunc.Scale(autofunc.SumAll(crossEntropyTerms(smoothLabels(x,
+			c.Smoothing), a)), -1)
 	})
 }
 
-func (_ CrossEntropyCost) CostR(v autofunc.RVector, x linalg.Vector,
+func (c CrossEntropyCost) CostR(v autofunc.RVector, x linalg.Vector,
 	a autofunc.RResult) autofunc.RResult {
 	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
-		xVar := autofunc.NewRVariable(&autofunc.Variable{x}, autofunc.RVector{})
-		logA := autofunc.Log{}.ApplyR(v, a)
-		oneMinusA := autofunc.AddScalerR(autofunc.ScaleR(a, -1), 1)
-		oneMinusX := autofunc.AddScalerR(autofunc.ScaleR(xVar, -1), 1)
-		log1A := autofunc.Log{}.ApplyR(v, oneMinusA)
-
-		errorVec := autofunc.AddR(autofunc.MulR(xVar, logA),
-			autofunc.MulR(oneMinusX, log1A))
-		return autofunc.ScaleR(autofunc.SumAllR(errorVec), -1)
+		return autofunc.ScaleR(autofunc.SumAllR(crossEntropyTermsR(v,
+			smoothLabels(x, c.Smoothing), a)), -1)
 	})
 }
 
+// WeightedCrossEntropyCost is like CrossEntropyCost,
+// except that the cross entropy term for each component
+// is scaled by the corresponding entry in Weights.
+//
+// This can be used to compensate for imbalanced classes
+// by giving rare classes larger weights.
+//
+// If the output is longer than Weights, as happens when
+// BatchRGradienter concatenates the outputs of several
+// samples, Weights is repeated to cover it.
+type WeightedCrossEntropyCost struct {
+	Weights linalg.Vector
+
+	// Smoothing is used as it is in CrossEntropyCost.
+	Smoothing float64
+}
+
+func (w WeightedCrossEntropyCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	weights := w.tiledWeights(len(x))
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		weightVar := &autofunc.Variable{weights}
+		errorVec := crossEntropyTerms(smoothLabels(x, w.Smoothing), a)
+		return autofunc.Scale(autofunc.SumAll(autofunc.Mul(weightVar, errorVec)), -1)
+	})
+}
+
+func (w WeightedCrossEntropyCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	weights := w.tiledWeights(len(x))
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		weightVar := autofunc.NewRVariable(&autofunc.Variable{weights},
+			autofunc.RVector{})
+		errorVec := crossEntropyTermsR(v, smoothLabels(x, w.Smoothing), a)
+		return autofunc.ScaleR(autofunc.SumAllR(autofunc.MulR(weightVar, errorVec)), -1)
+	})
+}
+
+// tiledWeights repeats w.Weights to fill an output of
+// the given size.
+func (w WeightedCrossEntropyCost) tiledWeights(size int) linalg.Vector {
+	if len(w.Weights) == size {
+		return w.Weights
+	} else if len(w.Weights) == 0 || size%len(w.Weights) != 0 {
+		panic("output size must be a multiple of weight count")
+	}
+	res := make(linalg.Vector, 0, size)
+	for len(res) < size {
+		res = append(res, w.Weights...)
+	}
+	return res
+}
+
+// crossEntropyTerms computes x*log(a) + (1-x)*log(1-a)
+// for each component.
+func crossEntropyTerms(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	xVar := &autofunc.Variable{x}
+	logA := autofunc.Log{}.Apply(a)
+	oneMinusA := autofunc.AddScaler(autofunc.Scale(a, -1), 1)
+	oneMinusX := autofunc.AddScaler(autofunc.Scale(xVar, -1), 1)
+	log1A := autofunc.Log{}.Apply(oneMinusA)
+	return autofunc.Add(autofunc.Mul(xVar, logA), autofunc.Mul(oneMinusX, log1A))
+}
+
+func crossEntropyTermsR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	xVar := autofunc.NewRVariable(&autofunc.Variable{x}, autofunc.RVector{})
+	logA := autofunc.Log{}.ApplyR(v, a)
+	oneMinusA := autofunc.AddScalerR(autofunc.ScaleR(a, -1), 1)
+	oneMinusX := autofunc.AddScalerR(autofunc.ScaleR(xVar, -1), 1)
+	log1A := autofunc.Log{}.ApplyR(v, oneMinusA)
+	return autofunc.AddR(autofunc.MulR(xVar, logA), autofunc.MulR(oneMinusX, log1A))
+}
+
+// smoothLabels applies label smoothing to a vector of
+// desired outputs.
+func smoothLabels(x linalg.Vector, smoothing float64) linalg.Vector {
+	if smoothing == 0 {
+		return x
+	}
+	res := make(linalg.Vector, len(x))
+	for i, val := range x {
+		res[i] = val*(1-smoothing) + smoothing/2
+	}
+	return res
+}
+
 // DotCost simply computes the negative of the dot
 // product of the actual and expected vectors.
 // This is equivalent to cross entropy cost when
@@ -155,27 +308,31 @@ func (_ DotCost) CostR(v autofunc.RVector, x linalg.Vector,
 // result.
 // This is more numerically stable than feeding the
 // output of a sigmoid to a cross-entropy loss.
-type SigmoidCECost struct{}
+//
+// Smoothing is used as it is in CrossEntropyCost.
+type SigmoidCECost struct {
+	Smoothing float64
+}
 
-func (_ SigmoidCECost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+func (s SigmoidCECost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
 	logsig := autofunc.LogSigmoid{}
 	log := logsig.Apply(a)
 	invLog := logsig.Apply(autofunc.Scale(a, -1))
 
-	xVar := &autofunc.Variable{x}
+	xVar := &autofunc.Variable{smoothLabels(x, s.Smoothing)}
 	oneMinusX := autofunc.AddScaler(autofunc.Scale(xVar, -1), 1)
 
 	sums := autofunc.Add(autofunc.Mul(xVar, log), autofunc.Mul(oneMinusX, invLog))
 	return autofunc.Scale(autofunc.SumAll(sums), -1)
 }
 
-func (_ SigmoidCECost) CostR(v autofunc.RVector, x linalg.Vector,
+func (s SigmoidCECost) CostR(v autofunc.RVector, x linalg.Vector,
 	a autofunc.RResult) autofunc.RResult {
 	logsig := autofunc.LogSigmoid{}
 	log := logsig.ApplyR(v, a)
 	invLog := logsig.ApplyR(v, autofunc.ScaleR(a, -1))
 
-	xVar := autofunc.NewRVariable(&autofunc.Variable{x}, v)
+	xVar := autofunc.NewRVariable(&autofunc.Variable{smoothLabels(x, s.Smoothing)}, v)
 	oneMinusX := autofunc.AddScalerR(autofunc.ScaleR(xVar, -1), 1)
 
 	sums := autofunc.AddR(autofunc.MulR(xVar, log), autofunc.MulR(oneMinusX, invLog))
@@ -194,9 +351,26 @@ type RegularizingCost struct {
 	CostFunc CostFunc
 }
 
+// Separable returns false if the wrapped CostFunc is a
+// SeparableCost which is not separable.
+// In that case, BatchRGradienter applies the wrapped
+// CostFunc to each sample separately but still adds the
+// penalty once per batch.
+func (r *RegularizingCost) Separable() bool {
+	return costSeparable(r.CostFunc)
+}
+
 func (r *RegularizingCost) Cost(a linalg.Vector, x autofunc.Result) autofunc.Result {
+	return r.addPenalty(r.CostFunc.Cost(a, x))
+}
+
+func (r *RegularizingCost) CostR(v autofunc.RVector, a linalg.Vector,
+	x autofunc.RResult) autofunc.RResult {
+	return r.addPenaltyR(v, r.CostFunc.CostR(v, a, x))
+}
+
+func (r *RegularizingCost) addPenalty(cost autofunc.Result) autofunc.Result {
 	regFunc := autofunc.SquaredNorm{}
-	cost := r.CostFunc.Cost(a, x)
 	for _, variable := range r.Variables {
 		norm := regFunc.Apply(variable)
 		cost = autofunc.Add(cost, autofunc.Scale(norm, r.Penalty))
@@ -204,13 +378,393 @@ func (r *RegularizingCost) Cost(a linalg.Vector, x autofunc.Result) autofunc.Res
 	return cost
 }
 
-func (r *RegularizingCost) CostR(v autofunc.RVector, a linalg.Vector,
-	x autofunc.RResult) autofunc.RResult {
+func (r *RegularizingCost) addPenaltyR(v autofunc.RVector,
+	cost autofunc.RResult) autofunc.RResult {
 	regFunc := autofunc.SquaredNorm{}
-	cost := r.CostFunc.CostR(v, a, x)
 	for _, variable := range r.Variables {
 		norm := regFunc.ApplyR(v, autofunc.NewRVariable(variable, v))
 		cost = autofunc.AddR(cost, autofunc.ScaleR(norm, r.Penalty))
 	}
 	return cost
 }
+
+// HuberCost computes the Huber loss, which is quadratic
+// for small errors and linear for large ones.
+// This makes it less sensitive to outliers than
+// MeanSquaredCost.
+//
+// Each component of a-x contributes d^2/2 if |d| is at
+// most Delta, or Delta*(|d|-Delta/2) otherwise.
+type HuberCost struct {
+	// Delta is the error at which the loss switches from
+	// quadratic to linear.
+	// If this is 0, a Delta of 1 is used.
+	Delta float64
+}
+
+func (h HuberCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return elementwiseCost(x, a, h.terms)
+}
+
+func (h HuberCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return elementwiseCostR(x, a, h.terms)
+}
+
+func (h HuberCost) terms(diff float64) (cost, deriv, deriv2 float64) {
+	delta := h.Delta
+	if delta == 0 {
+		delta = 1
+	} else if delta < 0 {
+		panic("delta must not be negative")
+	}
+	if math.Abs(diff) <= delta {
+		return diff * diff / 2, diff, 1
+	}
+	if diff < 0 {
+		return delta * (-diff - delta/2), -delta, 0
+	}
+	return delta * (diff - delta/2), delta, 0
+}
+
+// AbsCost computes the cost as the sum of the absolute
+// values of the components of a-x, where a is the actual
+// output and x is the desired output.
+type AbsCost struct{}
+
+func (_ AbsCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return elementwiseCost(x, a, absCostTerms)
+}
+
+func (_ AbsCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return elementwiseCostR(x, a, absCostTerms)
+}
+
+func absCostTerms(diff float64) (cost, deriv, deriv2 float64) {
+	if diff < 0 {
+		return -diff, -1, 0
+	}
+	return diff, 1, 0
+}
+
+// QuantileCost computes the quantile (or "pinball")
+// loss, which is minimized when the actual output is
+// the Tau quantile of the desired output's distribution.
+// For example, a Tau of 0.5 estimates the median, while
+// Tau values of 0.05 and 0.95 give a 90% prediction
+// interval.
+//
+// Each component contributes Tau*r if the residual r=x-a
+// is positive, or (Tau-1)*r otherwise.
+type QuantileCost struct {
+	Tau float64
+}
+
+func (q QuantileCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	return elementwiseCost(x, a, q.terms)
+}
+
+func (q QuantileCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	return elementwiseCostR(x, a, q.terms)
+}
+
+func (q QuantileCost) terms(diff float64) (cost, deriv, deriv2 float64) {
+	if diff < 0 {
+		return -q.Tau * diff, -q.Tau, 0
+	}
+	return (1 - q.Tau) * diff, 1 - q.Tau, 0
+}
+
+// costTerms computes the cost contributed by a single
+// component of a-x, along with its first and second
+// derivatives with respect to a.
+type costTerms func(diff float64) (cost, deriv, deriv2 float64)
+
+func elementwiseCost(x linalg.Vector, a autofunc.Result, f costTerms) autofunc.Result {
+	res := &elementwiseCostResult{
+		OutputVec: linalg.Vector{0},
+		Derivs:    make(linalg.Vector, len(x)),
+		Actual:    a,
+	}
+	for i, aVal := range a.Output() {
+		cost, deriv, _ := f(aVal - x[i])
+		res.OutputVec[0] += cost
+		res.Derivs[i] = deriv
+	}
+	return res
+}
+
+func elementwiseCostR(x linalg.Vector, a autofunc.RResult, f costTerms) autofunc.RResult {
+	res := &elementwiseCostRResult{
+		OutputVec:  linalg.Vector{0},
+		ROutputVec: linalg.Vector{0},
+		Derivs:     make(linalg.Vector, len(x)),
+		Derivs2:    make(linalg.Vector, len(x)),
+		Actual:     a,
+	}
+	aR := a.ROutput()
+	for i, aVal := range a.Output() {
+		cost, deriv, deriv2 := f(aVal - x[i])
+		res.OutputVec[0] += cost
+		res.ROutputVec[0] += deriv * aR[i]
+		res.Derivs[i] = deriv
+		res.Derivs2[i] = deriv2
+	}
+	return res
+}
+
+type elementwiseCostResult struct {
+	OutputVec linalg.Vector
+	Derivs    linalg.Vector
+	Actual    autofunc.Result
+}
+
+func (e *elementwiseCostResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *elementwiseCostResult) Constant(g autofunc.Gradient) bool {
+	return e.Actual.Constant(g)
+}
+
+func (e *elementwiseCostResult) PropagateGradient(upstream linalg.Vector,
+	grad autofunc.Gradient) {
+	if !e.Actual.Constant(grad) {
+		e.Actual.PropagateGradient(e.Derivs.Copy().Scale(upstream[0]), grad)
+	}
+}
+
+type elementwiseCostRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Derivs     linalg.Vector
+	Derivs2    linalg.Vector
+	Actual     autofunc.RResult
+}
+
+func (e *elementwiseCostRResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *elementwiseCostRResult) ROutput() linalg.Vector {
+	return e.ROutputVec
+}
+
+func (e *elementwiseCostRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return e.Actual.Constant(rg, g)
+}
+
+func (e *elementwiseCostRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if e.Actual.Constant(rgrad, grad) {
+		return
+	}
+	aR := e.Actual.ROutput()
+	downstream := e.Derivs.Copy().Scale(upstream[0])
+	downstreamR := e.Derivs.Copy().Scale(upstreamR[0])
+	for i, d2 := range e.Derivs2 {
+		downstreamR[i] += upstream[0] * d2 * aR[i]
+	}
+	e.Actual.PropagateRGradient(downstream, downstreamR, rgrad, grad)
+}
+
+// MultiHingeCost computes the multi-class hinge loss
+// proposed by Crammer and Singer.
+// The desired output should be a one-hot vector, and
+// the actual output a vector of class scores.
+//
+// The cost is max(0, 1 + a[j] - a[y]), where y is the
+// desired class and j is the highest scoring class
+// other than y.
+// Thus, the cost is zero once the desired class scores
+// higher than every other class by a margin of 1.
+type MultiHingeCost struct{}
+
+// Separable returns false, since the hinge is computed
+// from the scores of every class at once.
+func (_ MultiHingeCost) Separable() bool {
+	return false
+}
+
+func (_ MultiHingeCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	correct, rival, cost := multiHingeTerms(x, a.Output())
+	return &multiHingeResult{
+		OutputVec: linalg.Vector{cost},
+		Correct:   correct,
+		Rival:     rival,
+		Actual:    a,
+	}
+}
+
+func (_ MultiHingeCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	correct, rival, cost := multiHingeTerms(x, a.Output())
+	res := &multiHingeRResult{
+		OutputVec:  linalg.Vector{cost},
+		ROutputVec: linalg.Vector{0},
+		Correct:    correct,
+		Rival:      rival,
+		Actual:     a,
+	}
+	if cost > 0 {
+		aR := a.ROutput()
+		res.ROutputVec[0] = aR[rival] - aR[correct]
+	}
+	return res
+}
+
+// multiHingeTerms finds the desired class, the highest
+// scoring other class, and the resulting hinge loss.
+func multiHingeTerms(x, a linalg.Vector) (correct, rival int, cost float64) {
+	correct = 0
+	for i, val := range x {
+		if val > x[correct] {
+			correct = i
+		}
+	}
+	rival = -1
+	for i, val := range a {
+		if i != correct && (rival < 0 || val > a[rival]) {
+			rival = i
+		}
+	}
+	if rival < 0 {
+		return correct, rival, 0
+	}
+	return correct, rival, math.Max(0, 1+a[rival]-a[correct])
+}
+
+type multiHingeResult struct {
+	OutputVec linalg.Vector
+	Correct   int
+	Rival     int
+	Actual    autofunc.Result
+}
+
+func (m *multiHingeResult) Output() linalg.Vector {
+	return m.OutputVec
+}
+
+func (m *multiHingeResult) Constant(g autofunc.Gradient) bool {
+	return m.Actual.Constant(g)
+}
+
+func (m *multiHingeResult) PropagateGradient(upstream linalg.Vector,
+	grad autofunc.Gradient) {
+	if m.Actual.Constant(grad) {
+		return
+	}
+	downstream := make(linalg.Vector, len(m.Actual.Output()))
+	if m.OutputVec[0] > 0 {
+		downstream[m.Rival] = upstream[0]
+		downstream[m.Correct] = -upstream[0]
+	}
+	m.Actual.PropagateGradient(downstream, grad)
+}
+
+type multiHingeRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Correct    int
+	Rival      int
+	Actual     autofunc.RResult
+}
+
+func (m *multiHingeRResult) Output() linalg.Vector {
+	return m.OutputVec
+}
+
+func (m *multiHingeRResult) ROutput() linalg.Vector {
+	return m.ROutputVec
+}
+
+func (m *multiHingeRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return m.Actual.Constant(rg, g)
+}
+
+func (m *multiHingeRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if m.Actual.Constant(rgrad, grad) {
+		return
+	}
+	downstream := make(linalg.Vector, len(m.Actual.Output()))
+	downstreamR := make(linalg.Vector, len(m.Actual.Output()))
+	if m.OutputVec[0] > 0 {
+		downstream[m.Rival] = upstream[0]
+		downstream[m.Correct] = -upstream[0]
+		downstreamR[m.Rival] = upstreamR[0]
+		downstreamR[m.Correct] = -upstreamR[0]
+	}
+	m.Actual.PropagateRGradient(downstream, downstreamR, rgrad, grad)
+}
+
+// FocalCost computes the focal loss, which scales down
+// the cross entropy of outputs that are already close to
+// their desired values so that training focuses on hard
+// examples.
+//
+// Like SigmoidCECost, FocalCost applies a sigmoid to the
+// actual output before computing the loss.
+// With p=sigmoid(a), each component contributes
+//
+//	-Alpha*x*(1-p)^Gamma*log(p) - (1-Alpha)*(1-x)*p^Gamma*log(1-p)
+//
+// If Alpha is 0, the Alpha and (1-Alpha) coefficients
+// are omitted, so that positive and negative labels are
+// weighted equally.
+// If Gamma is also 0, the cost is equivalent to
+// SigmoidCECost.
+type FocalCost struct {
+	Gamma float64
+	Alpha float64
+}
+
+func (f FocalCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	posCoeff, negCoeff := f.coefficients(x)
+	logsig := autofunc.LogSigmoid{}
+	return autofunc.Pool(logsig.Apply(a), func(logP autofunc.Result) autofunc.Result {
+		return autofunc.Pool(logsig.Apply(autofunc.Scale(a, -1)),
+			func(logQ autofunc.Result) autofunc.Result {
+				pPow := autofunc.Exp{}.Apply(autofunc.Scale(logP, f.Gamma))
+				qPow := autofunc.Exp{}.Apply(autofunc.Scale(logQ, f.Gamma))
+				pos := autofunc.Mul(&autofunc.Variable{posCoeff}, autofunc.Mul(qPow, logP))
+				neg := autofunc.Mul(&autofunc.Variable{negCoeff}, autofunc.Mul(pPow, logQ))
+				return autofunc.Scale(autofunc.SumAll(autofunc.Add(pos, neg)), -1)
+			})
+	})
+}
+
+func (f FocalCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	posCoeff, negCoeff := f.coefficients(x)
+	posVar := autofunc.NewRVariable(&autofunc.Variable{posCoeff}, autofunc.RVector{})
+	negVar := autofunc.NewRVariable(&autofunc.Variable{negCoeff}, autofunc.RVector{})
+	logsig := autofunc.LogSigmoid{}
+	return autofunc.PoolR(logsig.ApplyR(v, a), func(logP autofunc.RResult) autofunc.RResult {
+		return autofunc.PoolR(logsig.ApplyR(v, autofunc.ScaleR(a, -1)),
+			func(logQ autofunc.RResult) autofunc.RResult {
+				pPow := autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(logP, f.Gamma))
+				qPow := autofunc.Exp{}.ApplyR(v, autofunc.ScaleR(logQ, f.Gamma))
+				pos := autofunc.MulR(posVar, autofunc.MulR(qPow, logP))
+				neg := autofunc.MulR(negVar, autofunc.MulR(pPow, logQ))
+				return autofunc.ScaleR(autofunc.SumAllR(autofunc.AddR(pos, neg)), -1)
+			})
+	})
+}
+
+// coefficients computes the constant coefficients for
+// the positive and negative terms of each component.
+func (f FocalCost) coefficients(x linalg.Vector) (pos, neg linalg.Vector) {
+	pos = x.Copy()
+	neg = x.Copy().Scale(-1)
+	for i := range neg {
+		neg[i]++
+	}
+	if f.Alpha != 0 {
+		pos.Scale(f.Alpha)
+		neg.Scale(1 - f.Alpha)
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package neuralnet
 
 import (
+	"math"
 	"math/rand"
 	"testing"
 
@@ -53,3 +54,190 @@ func TestMeanSquaredCostRGradient(t *testing.T) {
 	}
 	funcTest.Run(t)
 }
+
+type costTestFunc struct {
+	Cost     CostFunc
+	Expected linalg.Vector
+}
+
+func (c costTestFunc) Apply(in autofunc.Result) autofunc.Result {
+	return c.Cost.Cost(c.Expected, in)
+}
+
+func (c costTestFunc) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return c.Cost.CostR(v, c.Expected, in)
+}
+
+func TestRobustCostOutputs(t *testing.T) {
+	expected := linalg.Vector{1, -2, 0.5}
+	actual := &autofunc.Variable{Vector: []float64{1.5, 1, -0.5}}
+	costs := []CostFunc{HuberCost{Delta: 1}, HuberCost{}, AbsCost{},
+		QuantileCost{Tau: 0.25}}
+	outputs := []float64{
+		0.125 + 2.5 + 0.5,
+		0.125 + 2.5 + 0.5,
+		0.5 + 3 + 1,
+		0.75*0.5 + 0.75*3 + 0.25*1,
+	}
+	for i, cost := range costs {
+		out := cost.Cost(expected, actual).Output()[0]
+		if math.Abs(out-outputs[i]) > 1e-8 {
+			t.Errorf("cost %d: expected %f but got %f", i, outputs[i], out)
+		}
+		rv := autofunc.RVector{}
+		outR := cost.CostR(rv, expected, autofunc.NewRVariable(actual, rv)).Output()[0]
+		if math.Abs(outR-outputs[i]) > 1e-8 {
+			t.Errorf("cost %d: expected R output %f but got %f", i, outputs[i], outR)
+		}
+	}
+}
+
+func TestRobustCostGradients(t *testing.T) {
+	costs := []CostFunc{HuberCost{Delta: 0.5}, AbsCost{}, QuantileCost{Tau: 0.8}}
+	for _, cost := range costs {
+		actual := &autofunc.Variable{make(linalg.Vector, 10)}
+		expected := make(linalg.Vector, len(actual.Vector))
+		rVector := autofunc.RVector{actual: make(linalg.Vector, len(expected))}
+		for i := range expected {
+			expected[i] = rand.Float64()*2 - 1
+			actual.Vector[i] = rand.Float64()*2 - 1
+			rVector[actual][i] = rand.Float64()
+		}
+		funcTest := &functest.RFuncTest{
+			F:     costTestFunc{cost, expected},
+			Vars:  []*autofunc.Variable{actual},
+			Input: actual,
+			RV:    rVector,
+		}
+		funcTest.Run(t)
+	}
+}
+
+func TestWeightedCrossEntropyOutput(t *testing.T) {
+	expected := linalg.Vector{1, 0, 0}
+	actual := &autofunc.Variable{Vector: []float64{0.7, 0.2, 0.4}}
+	cost := WeightedCrossEntropyCost{Weights: []float64{2, 0.5, 3}}
+	out := cost.Cost(expected, actual).Output()[0]
+	expOut := -(2*math.Log(0.7) + 0.5*math.Log(0.8) + 3*math.Log(0.6))
+	if math.Abs(out-expOut) > 1e-8 {
+		t.Errorf("expected %f but got %f", expOut, out)
+	}
+}
+
+func TestLabelSmoothingOutput(t *testing.T) {
+	expected := linalg.Vector{1, 0}
+	smoothed := &autofunc.Variable{Vector: []float64{0.95, 0.05}}
+	logits := &autofunc.Variable{Vector: []float64{0.3, -1.2}}
+	probs := &autofunc.Variable{Vector: []float64{
+		1 / (1 + math.Exp(-0.3)),
+		1 / (1 + math.Exp(1.2)),
+	}}
+
+	ceOut := CrossEntropyCost{Smoothing: 0.1}.Cost(expected, probs).Output()[0]
+	ceExp := CrossEntropyCost{}.Cost(smoothed.Vector, probs).Output()[0]
+	if math.Abs(ceOut-ceExp) > 1e-8 {
+		t.Errorf("cross entropy: expected %f but got %f", ceExp, ceOut)
+	}
+
+	sigOut := SigmoidCECost{Smoothing: 0.1}.Cost(expected, logits).Output()[0]
+	if math.Abs(sigOut-ceExp) > 1e-8 {
+		t.Errorf("sigmoid cross entropy: expected %f but got %f", ceExp, sigOut)
+	}
+}
+
+func TestCrossEntropyVariantGradients(t *testing.T) {
+	weights := make(linalg.Vector, 10)
+	for i := range weights {
+		weights[i] = rand.Float64() * 3
+	}
+	costs := []CostFunc{
+		CrossEntropyCost{Smoothing: 0.2},
+		SigmoidCECost{Smoothing: 0.1},
+		WeightedCrossEntropyCost{Weights: weights},
+		WeightedCrossEntropyCost{Weights: weights, Smoothing: 0.1},
+	}
+	for _, cost := range costs {
+		actual := &autofunc.Variable{make(linalg.Vector, 10)}
+		expected := make(linalg.Vector, len(actual.Vector))
+		rVector := autofunc.RVector{actual: make(linalg.Vector, len(expected))}
+		for i := range expected {
+			expected[i] = float64(rand.Intn(2))
+			actual.Vector[i] = rand.Float64()*0.8 + 0.1
+			rVector[actual][i] = rand.Float64()
+		}
+		funcTest := &functest.RFuncTest{
+			F:     costTestFunc{cost, expected},
+			Vars:  []*autofunc.Variable{actual},
+			Input: actual,
+			RV:    rVector,
+		}
+		funcTest.Run(t)
+	}
+}
+
+func TestMultiHingeOutput(t *testing.T) {
+	expected := linalg.Vector{0, 1, 0}
+	inputs := []linalg.Vector{
+		{0.5, 1, 0.7},
+		{-1, 2, 0.9},
+		{3, 1, -2},
+	}
+	outputs := []float64{0.7, 0, 3}
+	for i, input := range inputs {
+		actual := &autofunc.Variable{Vector: input}
+		out := MultiHingeCost{}.Cost(expected, actual).Output()[0]
+		if math.Abs(out-outputs[i]) > 1e-8 {
+			t.Errorf("input %d: expected %f but got %f", i, outputs[i], out)
+		}
+	}
+}
+
+func TestFocalCostOutput(t *testing.T) {
+	expected := linalg.Vector{1, 0, 1}
+	actual := &autofunc.Variable{Vector: []float64{0.3, -0.5, 2}}
+
+	out := FocalCost{}.Cost(expected, actual).Output()[0]
+	expOut := SigmoidCECost{}.Cost(expected, actual).Output()[0]
+	if math.Abs(out-expOut) > 1e-8 {
+		t.Errorf("expected %f but got %f", expOut, out)
+	}
+
+	out = FocalCost{Gamma: 2, Alpha: 0.25}.Cost(expected, actual).Output()[0]
+	expOut = 0
+	for i, a := range actual.Vector {
+		p := 1 / (1 + math.Exp(-a))
+		if expected[i] == 1 {
+			expOut -= 0.25 * math.Pow(1-p, 2) * math.Log(p)
+		} else {
+			expOut -= 0.75 * math.Pow(p, 2) * math.Log(1-p)
+		}
+	}
+	if math.Abs(out-expOut) > 1e-8 {
+		t.Errorf("expected %f but got %f", expOut, out)
+	}
+}
+
+func TestClassifierCostGradients(t *testing.T) {
+	costs := []CostFunc{
+		MultiHingeCost{},
+		FocalCost{Gamma: 2},
+		FocalCost{Gamma: 0.5, Alpha: 0.25},
+	}
+	for _, cost := range costs {
+		actual := &autofunc.Variable{make(linalg.Vector, 10)}
+		expected := make(linalg.Vector, len(actual.Vector))
+		expected[rand.Intn(len(expected))] = 1
+		rVector := autofunc.RVector{actual: make(linalg.Vector, len(expected))}
+		for i := range expected {
+			actual.Vector[i] = rand.NormFloat64()
+			rVector[actual][i] = rand.Float64()
+		}
+		funcTest := &functest.RFuncTest{
+			F:     costTestFunc{cost, expected},
+			Vars:  []*autofunc.Variable{actual},
+			Input: actual,
+			RV:    rVector,
+		}
+		funcTest.Run(t)
+	}
+}
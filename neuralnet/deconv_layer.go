@@ -0,0 +1,449 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas64"
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// DeconvLayer is a transposed convolutional layer
+// (sometimes called a deconvolutional layer) for a
+// neural network.
+// It increases the width and height of its input by
+// "painting" a filter into the output for each of its
+// input entries.
+//
+// A DeconvLayer computes the transpose of a ConvLayer
+// which has FilterCount input channels, InputDepth
+// filters, and the same filter dimensions and stride.
+// As a result, there is one filter per input channel,
+// and each filter has a depth of FilterCount.
+type DeconvLayer struct {
+	FilterCount  int
+	FilterWidth  int
+	FilterHeight int
+	Stride       int
+
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+
+	Filters []*Tensor3
+	Biases  *autofunc.Variable
+
+	// FilterVar must contain the data for all of the
+	// filters in Filters, arranged one after the other.
+	// The array behind the slice in FilterVar should
+	// be re-used in Filters.
+	FilterVar *autofunc.Variable `json:"-"`
+}
+
+// DeserializeDeconvLayer deserializes a DeconvLayer.
+func DeserializeDeconvLayer(data []byte) (*DeconvLayer, error) {
+	var d DeconvLayer
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+
+	filterSize := d.filterSize()
+	weightSlice := make(linalg.Vector, d.InputDepth*filterSize)
+	for i, x := range d.Filters {
+		subSlice := weightSlice[i*filterSize : (i+1)*filterSize]
+		copy(subSlice, x.Data)
+		x.Data = subSlice
+	}
+	d.FilterVar = &autofunc.Variable{Vector: weightSlice}
+
+	return &d, nil
+}
+
+// OutputWidth computes the width of the output tensor.
+func (d *DeconvLayer) OutputWidth() int {
+	return (d.InputWidth-1)*d.Stride + d.FilterWidth
+}
+
+// OutputHeight computes the height of the output tensor.
+func (d *DeconvLayer) OutputHeight() int {
+	return (d.InputHeight-1)*d.Stride + d.FilterHeight
+}
+
+// OutputDepth returns the depth of the output tensor.
+func (d *DeconvLayer) OutputDepth() int {
+	return d.FilterCount
+}
+
+// Randomize randomly initializes the layer's
+// filters and biases.
+// This will allocate d.Filters, d.Biases, and
+// d.FilterVar if needed.
+func (d *DeconvLayer) Randomize() {
+	if d.Filters == nil {
+		filterSize := d.filterSize()
+		d.FilterVar = &autofunc.Variable{
+			Vector: make(linalg.Vector, d.InputDepth*filterSize),
+		}
+		for i := 0; i < d.InputDepth; i++ {
+			filter := &Tensor3{
+				Width:  d.FilterWidth,
+				Height: d.FilterHeight,
+				Depth:  d.FilterCount,
+				Data:   d.FilterVar.Vector[i*filterSize : (i+1)*filterSize],
+			}
+			d.Filters = append(d.Filters, filter)
+		}
+	}
+	if d.Biases == nil {
+		biasVec := make(linalg.Vector, d.FilterCount)
+		d.Biases = &autofunc.Variable{Vector: biasVec}
+	}
+
+	// Each output is a sum over roughly this many inputs.
+	fanIn := d.InputDepth * d.FilterWidth * d.FilterHeight / (d.Stride * d.Stride)
+	if fanIn < 1 {
+		fanIn = 1
+	}
+	weightCoeff := math.Sqrt(3.0 / float64(fanIn))
+	for i := range d.FilterVar.Vector {
+		d.FilterVar.Vector[i] = weightCoeff * ((rand.Float64() * 2) - 1)
+	}
+	for i := range d.Biases.Vector {
+		d.Biases.Vector[i] = (rand.Float64() * 2) - 1
+	}
+}
+
+// Parameters returns a slice containing the bias
+// and filter variables.
+func (d *DeconvLayer) Parameters() []*autofunc.Variable {
+	if d.Filters == nil || d.Biases == nil || d.FilterVar == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{d.Biases, d.FilterVar}
+}
+
+// Apply computes transposed convolutions on the input.
+// The result is only valid as long as the DeconvLayer
+// that produced it (d, in this case) is not modified.
+func (d *DeconvLayer) Apply(in autofunc.Result) autofunc.Result {
+	return d.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for autofunc.RResults.
+func (d *DeconvLayer) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return d.BatchR(v, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (d *DeconvLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	d.checkInput(in.Output(), n)
+	outSize := d.OutputWidth() * d.OutputHeight() * d.OutputDepth()
+	inSize := d.InputWidth * d.InputHeight * d.InputDepth
+	res := &deconvLayerResult{
+		OutputVec: make(linalg.Vector, outSize*n),
+		Input:     in,
+		N:         n,
+		Layer:     d,
+	}
+	for i := 0; i < n; i++ {
+		subIn := in.Output()[i*inSize : (i+1)*inSize]
+		subOut := res.OutputVec[i*outSize : (i+1)*outSize]
+		d.deconvolve(subIn, d.FilterVar.Vector, subOut)
+		d.addBiases(d.Biases.Vector, subOut)
+	}
+	return res
+}
+
+// BatchR is like Batch, but for RResults.
+func (d *DeconvLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	d.checkInput(in.Output(), n)
+	outSize := d.OutputWidth() * d.OutputHeight() * d.OutputDepth()
+	inSize := d.InputWidth * d.InputHeight * d.InputDepth
+	res := &deconvLayerRResult{
+		OutputVec:  make(linalg.Vector, outSize*n),
+		ROutputVec: make(linalg.Vector, outSize*n),
+		Input:      in,
+		FiltersR:   rv[d.FilterVar],
+		N:          n,
+		Layer:      d,
+	}
+	biasesR := rv[d.Biases]
+	for i := 0; i < n; i++ {
+		subIn := in.Output()[i*inSize : (i+1)*inSize]
+		subOut := res.OutputVec[i*outSize : (i+1)*outSize]
+		d.deconvolve(subIn, d.FilterVar.Vector, subOut)
+		d.addBiases(d.Biases.Vector, subOut)
+
+		subInR := in.ROutput()[i*inSize : (i+1)*inSize]
+		subOutR := res.ROutputVec[i*outSize : (i+1)*outSize]
+		d.deconvolve(subInR, d.FilterVar.Vector, subOutR)
+		if res.FiltersR != nil {
+			d.deconvolve(subIn, res.FiltersR, subOutR)
+		}
+		if biasesR != nil {
+			d.addBiases(biasesR, subOutR)
+		}
+	}
+	return res
+}
+
+// Serialize serializes the layer.
+func (d *DeconvLayer) Serialize() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (d *DeconvLayer) SerializerType() string {
+	return serializerTypeDeconvLayer
+}
+
+func (d *DeconvLayer) checkInput(in linalg.Vector, n int) {
+	if d.Filters == nil || d.Biases == nil || d.FilterVar == nil {
+		panic(uninitPanicMessage)
+	}
+	if len(in) != n*d.InputWidth*d.InputHeight*d.InputDepth {
+		panic("invalid input size")
+	}
+}
+
+func (d *DeconvLayer) filterSize() int {
+	return d.FilterWidth * d.FilterHeight * d.FilterCount
+}
+
+// deconvolve adds the deconvolution of in (without
+// biases) to out.
+func (d *DeconvLayer) deconvolve(in, filters, out linalg.Vector) {
+	colMat := d.patchMatrix(make(linalg.Vector, len(in)/d.InputDepth*d.filterSize()))
+	blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, d.inputMatrix(in),
+		d.filterMatrix(filters), 0, colMat)
+	flattened := NewTensor3Col(d.OutputWidth(), d.OutputHeight(), d.OutputDepth(),
+		colMat.Data, d.FilterWidth, d.FilterHeight, d.Stride)
+	linalg.Vector(out).Add(flattened.Data)
+}
+
+func (d *DeconvLayer) addBiases(biases, out linalg.Vector) {
+	biasVec := blas64.Vector{Inc: 1, Data: biases}
+	for i := 0; i < len(out); i += d.FilterCount {
+		outVec := blas64.Vector{Inc: 1, Data: out[i : i+d.FilterCount]}
+		blas64.Axpy(d.FilterCount, 1, biasVec, outVec)
+	}
+}
+
+// inputMatrix turns an input tensor into a matrix with
+// one row per spatial input position.
+func (d *DeconvLayer) inputMatrix(in linalg.Vector) blas64.General {
+	return blas64.General{
+		Rows:   d.InputWidth * d.InputHeight,
+		Cols:   d.InputDepth,
+		Stride: d.InputDepth,
+		Data:   in,
+	}
+}
+
+func (d *DeconvLayer) filterMatrix(filters linalg.Vector) blas64.General {
+	return blas64.General{
+		Rows:   d.InputDepth,
+		Cols:   d.filterSize(),
+		Stride: d.filterSize(),
+		Data:   filters,
+	}
+}
+
+// patchMatrix creates a matrix with one row per
+// spatial input position, where each row is an
+// output patch.
+func (d *DeconvLayer) patchMatrix(data linalg.Vector) blas64.General {
+	return blas64.General{
+		Rows:   d.InputWidth * d.InputHeight,
+		Cols:   d.filterSize(),
+		Stride: d.filterSize(),
+		Data:   data,
+	}
+}
+
+// upstreamPatches converts an upstream gradient into a
+// matrix of output patches.
+func (d *DeconvLayer) upstreamPatches(upstream linalg.Vector) blas64.General {
+	tensor := &Tensor3{
+		Width:  d.OutputWidth(),
+		Height: d.OutputHeight(),
+		Depth:  d.OutputDepth(),
+		Data:   upstream,
+	}
+	return d.patchMatrix(tensor.ToCol(d.FilterWidth, d.FilterHeight, d.Stride))
+}
+
+// propagateBiases adds the bias gradient for upstream
+// to biasGrad.
+func (d *DeconvLayer) propagateBiases(upstream, biasGrad linalg.Vector) {
+	biasGradVec := blas64.Vector{Inc: 1, Data: biasGrad}
+	for i := 0; i < len(upstream); i += d.FilterCount {
+		row := blas64.Vector{Inc: 1, Data: upstream[i : i+d.FilterCount]}
+		blas64.Axpy(d.FilterCount, 1, row, biasGradVec)
+	}
+}
+
+type deconvLayerResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	N         int
+	Layer     *DeconvLayer
+}
+
+func (d *deconvLayerResult) Output() linalg.Vector {
+	return d.OutputVec
+}
+
+func (d *deconvLayerResult) Constant(g autofunc.Gradient) bool {
+	if !d.Layer.Biases.Constant(g) {
+		return false
+	}
+	if !d.Input.Constant(g) {
+		return false
+	}
+	return d.Layer.FilterVar.Constant(g)
+}
+
+func (d *deconvLayerResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	layer := d.Layer
+	if biasGrad, ok := grad[layer.Biases]; ok {
+		layer.propagateBiases(upstream, biasGrad)
+	}
+
+	filterGrad, hasFilterGrad := grad[layer.FilterVar]
+	inputConstant := d.Input.Constant(grad)
+	if !hasFilterGrad && inputConstant {
+		return
+	}
+
+	var inputDownstream linalg.Vector
+	if !inputConstant {
+		inputDownstream = make(linalg.Vector, len(d.Input.Output()))
+	}
+
+	subUpstreamSize := len(upstream) / d.N
+	subInputSize := len(d.Input.Output()) / d.N
+	filterMat := layer.filterMatrix(layer.FilterVar.Vector)
+	for i := 0; i < d.N; i++ {
+		subUpstream := upstream[i*subUpstreamSize : (i+1)*subUpstreamSize]
+		patches := layer.upstreamPatches(subUpstream)
+		if inputDownstream != nil {
+			subDown := inputDownstream[i*subInputSize : (i+1)*subInputSize]
+			blas64.Gemm(blas.NoTrans, blas.Trans, 1, patches, filterMat, 0,
+				layer.inputMatrix(subDown))
+		}
+		if hasFilterGrad {
+			subInput := d.Input.Output()[i*subInputSize : (i+1)*subInputSize]
+			blas64.Gemm(blas.Trans, blas.NoTrans, 1, layer.inputMatrix(subInput),
+				patches, 1, layer.filterMatrix(filterGrad))
+		}
+	}
+
+	if !inputConstant {
+		d.Input.PropagateGradient(inputDownstream, grad)
+	}
+}
+
+type deconvLayerRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	FiltersR   linalg.Vector
+	N          int
+	Layer      *DeconvLayer
+}
+
+func (d *deconvLayerRResult) Output() linalg.Vector {
+	return d.OutputVec
+}
+
+func (d *deconvLayerRResult) ROutput() linalg.Vector {
+	return d.ROutputVec
+}
+
+func (d *deconvLayerRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	if !d.Layer.Biases.Constant(g) {
+		return false
+	} else if _, ok := rg[d.Layer.Biases]; ok {
+		return false
+	}
+
+	if !d.Layer.FilterVar.Constant(g) {
+		return false
+	} else if _, ok := rg[d.Layer.FilterVar]; ok {
+		return false
+	}
+
+	return d.Input.Constant(rg, g)
+}
+
+func (d *deconvLayerRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if grad == nil {
+		grad = autofunc.Gradient{}
+	}
+	layer := d.Layer
+
+	if biasGrad, ok := grad[layer.Biases]; ok {
+		layer.propagateBiases(upstream, biasGrad)
+	}
+	if biasRGrad, ok := rgrad[layer.Biases]; ok {
+		layer.propagateBiases(upstreamR, biasRGrad)
+	}
+
+	filterGrad, hasFilterGrad := grad[layer.FilterVar]
+	filterRGrad, hasFilterRGrad := rgrad[layer.FilterVar]
+	inputConstant := d.Input.Constant(rgrad, grad)
+	if !hasFilterGrad && !hasFilterRGrad && inputConstant {
+		return
+	}
+
+	var inputDownstream, inputDownstreamR linalg.Vector
+	if !inputConstant {
+		inputDownstream = make(linalg.Vector, len(d.Input.Output()))
+		inputDownstreamR = make(linalg.Vector, len(d.Input.Output()))
+	}
+
+	subUpstreamSize := len(upstream) / d.N
+	subInputSize := len(d.Input.Output()) / d.N
+	filterMat := layer.filterMatrix(layer.FilterVar.Vector)
+	for i := 0; i < d.N; i++ {
+		subUpstream := upstream[i*subUpstreamSize : (i+1)*subUpstreamSize]
+		subUpstreamR := upstreamR[i*subUpstreamSize : (i+1)*subUpstreamSize]
+		patches := layer.upstreamPatches(subUpstream)
+		patchesR := layer.upstreamPatches(subUpstreamR)
+		subInput := layer.inputMatrix(d.Input.Output()[i*subInputSize : (i+1)*subInputSize])
+		subInputR := layer.inputMatrix(d.Input.ROutput()[i*subInputSize : (i+1)*subInputSize])
+
+		if inputDownstream != nil {
+			subDown := inputDownstream[i*subInputSize : (i+1)*subInputSize]
+			subDownR := inputDownstreamR[i*subInputSize : (i+1)*subInputSize]
+			blas64.Gemm(blas.NoTrans, blas.Trans, 1, patches, filterMat, 0,
+				layer.inputMatrix(subDown))
+			blas64.Gemm(blas.NoTrans, blas.Trans, 1, patchesR, filterMat, 0,
+				layer.inputMatrix(subDownR))
+			if d.FiltersR != nil {
+				blas64.Gemm(blas.NoTrans, blas.Trans, 1, patches,
+					layer.filterMatrix(d.FiltersR), 1, layer.inputMatrix(subDownR))
+			}
+		}
+		if hasFilterGrad {
+			blas64.Gemm(blas.Trans, blas.NoTrans, 1, subInput, patches, 1,
+				layer.filterMatrix(filterGrad))
+		}
+		if hasFilterRGrad {
+			destMat := layer.filterMatrix(filterRGrad)
+			blas64.Gemm(blas.Trans, blas.NoTrans, 1, subInputR, patches, 1, destMat)
+			blas64.Gemm(blas.Trans, blas.NoTrans, 1, subInput, patchesR, 1, destMat)
+		}
+	}
+
+	if !inputConstant {
+		d.Input.PropagateRGradient(inputDownstream, inputDownstreamR, rgrad, grad)
+	}
+}
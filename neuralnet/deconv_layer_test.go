@@ -0,0 +1,198 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestDeconvDimensions(t *testing.T) {
+	layers := []*DeconvLayer{
+		{FilterCount: 1, FilterWidth: 3, FilterHeight: 3, Stride: 1,
+			InputWidth: 7, InputHeight: 7, InputDepth: 1},
+		{FilterCount: 5, FilterWidth: 4, FilterHeight: 7, Stride: 2,
+			InputWidth: 7, InputHeight: 25, InputDepth: 18},
+	}
+	outputDims := [][]int{
+		{9, 9, 1},
+		{16, 55, 5},
+	}
+	for i, layer := range layers {
+		exp := outputDims[i]
+		if layer.OutputWidth() != exp[0] || layer.OutputHeight() != exp[1] ||
+			layer.OutputDepth() != exp[2] {
+			t.Errorf("test %d gave %d,%d,%d output (expected %d,%d,%d)", i,
+				layer.OutputWidth(), layer.OutputHeight(), layer.OutputDepth(),
+				exp[0], exp[1], exp[2])
+		}
+	}
+}
+
+func TestDeconvTranspose(t *testing.T) {
+	conv := &ConvLayer{
+		FilterCount:  3,
+		FilterWidth:  3,
+		FilterHeight: 2,
+		Stride:       2,
+		InputWidth:   9,
+		InputHeight:  6,
+		InputDepth:   2,
+	}
+	conv.Randomize()
+	for i := range conv.Biases.Vector {
+		conv.Biases.Vector[i] = 0
+	}
+	deconv := &DeconvLayer{
+		FilterCount:  conv.InputDepth,
+		FilterWidth:  conv.FilterWidth,
+		FilterHeight: conv.FilterHeight,
+		Stride:       conv.Stride,
+		InputWidth:   conv.OutputWidth(),
+		InputHeight:  conv.OutputHeight(),
+		InputDepth:   conv.OutputDepth(),
+	}
+	deconv.Randomize()
+	copy(deconv.FilterVar.Vector, conv.FilterVar.Vector)
+	for i := range deconv.Biases.Vector {
+		deconv.Biases.Vector[i] = 0
+	}
+
+	if deconv.OutputWidth() != conv.InputWidth ||
+		deconv.OutputHeight() != conv.InputHeight {
+		t.Fatal("unexpected output dimensions")
+	}
+
+	convIn := make(linalg.Vector, conv.InputWidth*conv.InputHeight*conv.InputDepth)
+	for i := range convIn {
+		convIn[i] = rand.NormFloat64()
+	}
+	deconvIn := make(linalg.Vector, deconv.InputWidth*deconv.InputHeight*
+		deconv.InputDepth)
+	for i := range deconvIn {
+		deconvIn[i] = rand.NormFloat64()
+	}
+
+	convOut := conv.Apply(&autofunc.Variable{Vector: convIn}).Output()
+	deconvOut := deconv.Apply(&autofunc.Variable{Vector: deconvIn}).Output()
+
+	expected := convOut.Dot(deconvIn)
+	actual := convIn.Dot(deconvOut)
+	if math.Abs(actual-expected) > 1e-6 {
+		t.Errorf("expected inner product %f but got %f", expected, actual)
+	}
+}
+
+func TestDeconvLayerRProp(t *testing.T) {
+	layer := &DeconvLayer{
+		FilterCount:  4,
+		FilterWidth:  2,
+		FilterHeight: 3,
+		Stride:       2,
+		InputWidth:   3,
+		InputHeight:  4,
+		InputDepth:   2,
+	}
+	layer.Randomize()
+
+	input := make(linalg.Vector, 3*4*2)
+	for i := range input {
+		input[i] = rand.Float64()*2 - 1
+	}
+	inVar := &autofunc.Variable{Vector: input}
+
+	variables := append(layer.Parameters(), inVar)
+	rVector := autofunc.RVector{}
+	for _, variable := range variables {
+		rVector[variable] = make(linalg.Vector, len(variable.Vector))
+		for i := range rVector[variable] {
+			rVector[variable][i] = rand.Float64()*2 - 1
+		}
+	}
+	funcTest := &functest.RFuncTest{
+		F:     layer,
+		Vars:  variables,
+		Input: inVar,
+		RV:    rVector,
+	}
+	funcTest.Run(t)
+}
+
+func TestDeconvLayerBatch(t *testing.T) {
+	layer := &DeconvLayer{
+		FilterCount:  3,
+		FilterWidth:  4,
+		FilterHeight: 2,
+		Stride:       3,
+		InputWidth:   5,
+		InputHeight:  6,
+		InputDepth:   4,
+	}
+	layer.Randomize()
+
+	n := 3
+	batchInput := make(linalg.Vector, n*layer.InputWidth*layer.InputHeight*layer.InputDepth)
+	for i := range batchInput {
+		batchInput[i] = rand.NormFloat64()
+	}
+	batchRes := &autofunc.Variable{Vector: batchInput}
+
+	params := []*autofunc.Variable{batchRes, layer.Biases, layer.FilterVar}
+	testBatcher(t, layer, batchRes, n, params)
+
+	rVec := autofunc.RVector{}
+	for _, param := range params {
+		vec := make(linalg.Vector, len(param.Vector))
+		for i := range vec {
+			vec[i] = rand.NormFloat64()
+		}
+		rVec[param] = vec
+	}
+	testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec), n, params)
+}
+
+func TestDeconvLayerSerialize(t *testing.T) {
+	layer := &DeconvLayer{
+		FilterCount:  3,
+		FilterWidth:  2,
+		FilterHeight: 2,
+		Stride:       2,
+		InputWidth:   4,
+		InputHeight:  3,
+		InputDepth:   2,
+	}
+	layer.Randomize()
+
+	data, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := serializer.GetDeserializer(layer.SerializerType())(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := l.(*DeconvLayer)
+	if !ok {
+		t.Fatalf("decoded layer was a %T", l)
+	}
+
+	if len(newLayer.Filters) != len(layer.Filters) {
+		t.Fatalf("expected %d filters but got %d", len(layer.Filters),
+			len(newLayer.Filters))
+	}
+	for i, param := range layer.Parameters() {
+		actual := newLayer.Parameters()[i].Vector
+		if param.Vector.Copy().Scale(-1).Add(actual).MaxAbs() > 1e-6 {
+			t.Errorf("parameter %d does not match", i)
+		}
+	}
+
+	newLayer.FilterVar.Vector[0] = 1337
+	if newLayer.Filters[0].Data[0] != 1337 {
+		t.Error("filters are not backed by FilterVar")
+	}
+}
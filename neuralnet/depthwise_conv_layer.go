@@ -0,0 +1,435 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+
+	"github.com/gonum/blas/blas64"
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// DepthwiseConvLayer is a convolutional layer which
+// convolves each depth layer of its input with a
+// separate two-dimensional filter.
+// Thus, the output has the same depth as the input.
+//
+// A depthwise convolution followed by a pointwise
+// convolution (see NewPointwiseConvLayer) is known as a
+// depthwise-separable convolution, which is much cheaper
+// than an equivalent ConvLayer.
+//
+// The strides, dilation, and padding behave as they do
+// for ConvLayer.
+type DepthwiseConvLayer struct {
+	FilterWidth  int
+	FilterHeight int
+	Stride       int
+
+	XStride     int
+	YStride     int
+	Dilation    int
+	PaddingX    int
+	PaddingY    int
+	SamePadding bool
+
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+
+	// Filters stores the filters for all of the depth
+	// layers as one FilterWidth by FilterHeight by
+	// InputDepth tensor, using the Tensor3 layout.
+	Filters *autofunc.Variable
+
+	Biases *autofunc.Variable
+}
+
+// NewPointwiseConvLayer creates a randomized ConvLayer
+// with 1x1 filters, which mixes the depth layers of each
+// position in an input tensor independently.
+func NewPointwiseConvLayer(width, height, inDepth, outDepth int) *ConvLayer {
+	res := &ConvLayer{
+		FilterCount:  outDepth,
+		FilterWidth:  1,
+		FilterHeight: 1,
+		Stride:       1,
+		InputWidth:   width,
+		InputHeight:  height,
+		InputDepth:   inDepth,
+	}
+	res.Randomize()
+	return res
+}
+
+// DeserializeDepthwiseConvLayer deserializes a
+// DepthwiseConvLayer.
+func DeserializeDepthwiseConvLayer(d []byte) (*DepthwiseConvLayer, error) {
+	var res DepthwiseConvLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// OutputWidth computes the width of the output tensor.
+func (d *DepthwiseConvLayer) OutputWidth() int {
+	return d.geometry().OutputWidth()
+}
+
+// OutputHeight computes the height of the output tensor.
+func (d *DepthwiseConvLayer) OutputHeight() int {
+	return d.geometry().OutputHeight()
+}
+
+// OutputDepth returns the depth of the output tensor,
+// which is the same as the input depth.
+func (d *DepthwiseConvLayer) OutputDepth() int {
+	return d.InputDepth
+}
+
+// Randomize randomly initializes the layer's filters and
+// biases.
+// This will allocate d.Filters and d.Biases if needed.
+func (d *DepthwiseConvLayer) Randomize() {
+	if d.Filters == nil {
+		d.Filters = &autofunc.Variable{
+			Vector: make(linalg.Vector, d.FilterWidth*d.FilterHeight*d.InputDepth),
+		}
+	}
+	if d.Biases == nil {
+		d.Biases = &autofunc.Variable{Vector: make(linalg.Vector, d.InputDepth)}
+	}
+	coeff := math.Sqrt(3.0 / float64(d.FilterWidth*d.FilterHeight))
+	for i := range d.Filters.Vector {
+		d.Filters.Vector[i] = coeff * ((rand.Float64() * 2) - 1)
+	}
+	for i := range d.Biases.Vector {
+		d.Biases.Vector[i] = (rand.Float64() * 2) - 1
+	}
+}
+
+// Parameters returns a slice containing the bias
+// and filter variables.
+func (d *DepthwiseConvLayer) Parameters() []*autofunc.Variable {
+	if d.Filters == nil || d.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{d.Biases, d.Filters}
+}
+
+// Apply computes convolutions on the input.
+func (d *DepthwiseConvLayer) Apply(in autofunc.Result) autofunc.Result {
+	return d.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for autofunc.RResults.
+func (d *DepthwiseConvLayer) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return d.BatchR(v, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (d *DepthwiseConvLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	d.checkInput(in.Output(), n)
+	geom := d.geometry()
+	res := &depthwiseConvResult{
+		OutputVec: make(linalg.Vector, n*d.outputSize()),
+		Input:     in,
+		N:         n,
+		Layer:     d,
+	}
+	d.forEachSample(in.Output(), res.OutputVec, func(subIn, subOut linalg.Vector) {
+		d.convolve(geom.inputToMatrix(subIn).Data, d.Filters.Vector, subOut)
+		d.addBiases(d.Biases.Vector, subOut)
+	})
+	return res
+}
+
+// BatchR is like Batch, but for RResults.
+func (d *DepthwiseConvLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	d.checkInput(in.Output(), n)
+	geom := d.geometry()
+	res := &depthwiseConvRResult{
+		OutputVec:  make(linalg.Vector, n*d.outputSize()),
+		ROutputVec: make(linalg.Vector, n*d.outputSize()),
+		Input:      in,
+		FiltersR:   rv[d.Filters],
+		N:          n,
+		Layer:      d,
+	}
+	d.forEachSample(in.Output(), res.OutputVec, func(subIn, subOut linalg.Vector) {
+		d.convolve(geom.inputToMatrix(subIn).Data, d.Filters.Vector, subOut)
+		d.addBiases(d.Biases.Vector, subOut)
+	})
+	d.forEachSample(in.ROutput(), res.ROutputVec, func(subInR, subOutR linalg.Vector) {
+		d.convolve(geom.inputToMatrix(subInR).Data, d.Filters.Vector, subOutR)
+	})
+	if res.FiltersR != nil {
+		d.forEachSample(in.Output(), res.ROutputVec, func(subIn, subOutR linalg.Vector) {
+			d.convolve(geom.inputToMatrix(subIn).Data, res.FiltersR, subOutR)
+		})
+	}
+	if biasesR, ok := rv[d.Biases]; ok {
+		d.forEachSample(in.Output(), res.ROutputVec, func(_, subOutR linalg.Vector) {
+			d.addBiases(biasesR, subOutR)
+		})
+	}
+	return res
+}
+
+// Serialize serializes the layer.
+func (d *DepthwiseConvLayer) Serialize() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (d *DepthwiseConvLayer) SerializerType() string {
+	return serializerTypeDepthwiseConvLayer
+}
+
+// geometry creates a ConvLayer with the same input and
+// output shapes as d, for use in computing im2col
+// matrices.
+func (d *DepthwiseConvLayer) geometry() *ConvLayer {
+	return &ConvLayer{
+		FilterCount:  d.InputDepth,
+		FilterWidth:  d.FilterWidth,
+		FilterHeight: d.FilterHeight,
+		Stride:       d.Stride,
+		XStride:      d.XStride,
+		YStride:      d.YStride,
+		Dilation:     d.Dilation,
+		PaddingX:     d.PaddingX,
+		PaddingY:     d.PaddingY,
+		SamePadding:  d.SamePadding,
+		InputWidth:   d.InputWidth,
+		InputHeight:  d.InputHeight,
+		InputDepth:   d.InputDepth,
+	}
+}
+
+func (d *DepthwiseConvLayer) checkInput(in linalg.Vector, n int) {
+	if d.Filters == nil || d.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	if len(in) != n*d.InputWidth*d.InputHeight*d.InputDepth {
+		panic("invalid input size")
+	}
+}
+
+func (d *DepthwiseConvLayer) outputSize() int {
+	return d.OutputWidth() * d.OutputHeight() * d.OutputDepth()
+}
+
+// forEachSample calls f with the input and output
+// vectors for each sample in a batch.
+func (d *DepthwiseConvLayer) forEachSample(in, out linalg.Vector,
+	f func(subIn, subOut linalg.Vector)) {
+	inSize := d.InputWidth * d.InputHeight * d.InputDepth
+	outSize := d.outputSize()
+	n := len(out) / outSize
+	for i := 0; i < n; i++ {
+		f(in[i*inSize:(i+1)*inSize], out[i*outSize:(i+1)*outSize])
+	}
+}
+
+// convolve adds the depthwise convolution of an im2col
+// matrix with some filters to out.
+func (d *DepthwiseConvLayer) convolve(col, filters, out linalg.Vector) {
+	rowSize := len(filters)
+	for pos := 0; pos*d.InputDepth < len(out); pos++ {
+		row := col[pos*rowSize : (pos+1)*rowSize]
+		outRow := out[pos*d.InputDepth : (pos+1)*d.InputDepth]
+		for k := 0; k < rowSize; k += d.InputDepth {
+			for c, x := range row[k : k+d.InputDepth] {
+				outRow[c] += x * filters[k+c]
+			}
+		}
+	}
+}
+
+// colGradient adds the gradient of an im2col matrix to
+// colGrad, given the upstream gradient.
+func (d *DepthwiseConvLayer) colGradient(upstream, filters, colGrad linalg.Vector) {
+	rowSize := len(filters)
+	for pos := 0; pos*d.InputDepth < len(upstream); pos++ {
+		row := colGrad[pos*rowSize : (pos+1)*rowSize]
+		upRow := upstream[pos*d.InputDepth : (pos+1)*d.InputDepth]
+		for k := 0; k < rowSize; k += d.InputDepth {
+			for c, u := range upRow {
+				row[k+c] += u * filters[k+c]
+			}
+		}
+	}
+}
+
+// filterGradient adds the gradient of the filters to
+// filterGrad, given the upstream gradient and an im2col
+// matrix.
+func (d *DepthwiseConvLayer) filterGradient(upstream, col, filterGrad linalg.Vector) {
+	rowSize := len(filterGrad)
+	for pos := 0; pos*d.InputDepth < len(upstream); pos++ {
+		row := col[pos*rowSize : (pos+1)*rowSize]
+		upRow := upstream[pos*d.InputDepth : (pos+1)*d.InputDepth]
+		for k := 0; k < rowSize; k += d.InputDepth {
+			for c, u := range upRow {
+				filterGrad[k+c] += u * row[k+c]
+			}
+		}
+	}
+}
+
+func (d *DepthwiseConvLayer) addBiases(biases, out linalg.Vector) {
+	biasVec := blas64.Vector{Inc: 1, Data: biases}
+	for i := 0; i < len(out); i += d.InputDepth {
+		outVec := blas64.Vector{Inc: 1, Data: out[i : i+d.InputDepth]}
+		blas64.Axpy(d.InputDepth, 1, biasVec, outVec)
+	}
+}
+
+func (d *DepthwiseConvLayer) biasGradient(upstream, biasGrad linalg.Vector) {
+	for i, x := range upstream {
+		biasGrad[i%d.InputDepth] += x
+	}
+}
+
+// inputGradient computes the gradient of one input
+// sample given an upstream gradient for it.
+func (d *DepthwiseConvLayer) inputGradient(geom *ConvLayer, filters, upstream,
+	downstream linalg.Vector) {
+	rowSize := len(filters)
+	rowCount := len(upstream) / d.InputDepth
+	colMat := blas64.General{
+		Rows:   rowCount,
+		Cols:   rowSize,
+		Stride: rowSize,
+		Data:   make(linalg.Vector, rowCount*rowSize),
+	}
+	d.colGradient(upstream, filters, colMat.Data)
+	geom.matrixToInput(colMat, downstream)
+}
+
+type depthwiseConvResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	N         int
+	Layer     *DepthwiseConvLayer
+}
+
+func (d *depthwiseConvResult) Output() linalg.Vector {
+	return d.OutputVec
+}
+
+func (d *depthwiseConvResult) Constant(g autofunc.Gradient) bool {
+	return d.Input.Constant(g) && d.Layer.Filters.Constant(g) &&
+		d.Layer.Biases.Constant(g)
+}
+
+func (d *depthwiseConvResult) PropagateGradient(upstream linalg.Vector,
+	grad autofunc.Gradient) {
+	layer := d.Layer
+	geom := layer.geometry()
+	input := d.Input.Output()
+
+	if biasGrad, ok := grad[layer.Biases]; ok {
+		layer.biasGradient(upstream, biasGrad)
+	}
+	if filterGrad, ok := grad[layer.Filters]; ok {
+		layer.forEachSample(input, upstream, func(subIn, subUp linalg.Vector) {
+			layer.filterGradient(subUp, geom.inputToMatrix(subIn).Data, filterGrad)
+		})
+	}
+
+	if d.Input.Constant(grad) {
+		return
+	}
+	downstream := make(linalg.Vector, len(input))
+	layer.forEachSample(downstream, upstream, func(subDown, subUp linalg.Vector) {
+		layer.inputGradient(geom, layer.Filters.Vector, subUp, subDown)
+	})
+	d.Input.PropagateGradient(downstream, grad)
+}
+
+type depthwiseConvRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	FiltersR   linalg.Vector
+	N          int
+	Layer      *DepthwiseConvLayer
+}
+
+func (d *depthwiseConvRResult) Output() linalg.Vector {
+	return d.OutputVec
+}
+
+func (d *depthwiseConvRResult) ROutput() linalg.Vector {
+	return d.ROutputVec
+}
+
+func (d *depthwiseConvRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	if !d.Layer.Biases.Constant(g) || !d.Layer.Filters.Constant(g) {
+		return false
+	}
+	if _, ok := rg[d.Layer.Biases]; ok {
+		return false
+	}
+	if _, ok := rg[d.Layer.Filters]; ok {
+		return false
+	}
+	return d.Input.Constant(rg, g)
+}
+
+func (d *depthwiseConvRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if grad == nil {
+		grad = autofunc.Gradient{}
+	}
+	layer := d.Layer
+	geom := layer.geometry()
+	input := d.Input.Output()
+	inputR := d.Input.ROutput()
+
+	if biasGrad, ok := grad[layer.Biases]; ok {
+		layer.biasGradient(upstream, biasGrad)
+	}
+	if biasRGrad, ok := rgrad[layer.Biases]; ok {
+		layer.biasGradient(upstreamR, biasRGrad)
+	}
+	if filterGrad, ok := grad[layer.Filters]; ok {
+		layer.forEachSample(input, upstream, func(subIn, subUp linalg.Vector) {
+			layer.filterGradient(subUp, geom.inputToMatrix(subIn).Data, filterGrad)
+		})
+	}
+	if filterRGrad, ok := rgrad[layer.Filters]; ok {
+		layer.forEachSample(input, upstreamR, func(subIn, subUpR linalg.Vector) {
+			layer.filterGradient(subUpR, geom.inputToMatrix(subIn).Data, filterRGrad)
+		})
+		layer.forEachSample(inputR, upstream, func(subInR, subUp linalg.Vector) {
+			layer.filterGradient(subUp, geom.inputToMatrix(subInR).Data, filterRGrad)
+		})
+	}
+
+	if d.Input.Constant(rgrad, grad) {
+		return
+	}
+	downstream := make(linalg.Vector, len(input))
+	downstreamR := make(linalg.Vector, len(input))
+	layer.forEachSample(downstream, upstream, func(subDown, subUp linalg.Vector) {
+		layer.inputGradient(geom, layer.Filters.Vector, subUp, subDown)
+	})
+	layer.forEachSample(downstreamR, upstreamR, func(subDownR, subUpR linalg.Vector) {
+		layer.inputGradient(geom, layer.Filters.Vector, subUpR, subDownR)
+	})
+	if d.FiltersR != nil {
+		partial := make(linalg.Vector, len(input))
+		layer.forEachSample(partial, upstream, func(subDown, subUp linalg.Vector) {
+			layer.inputGradient(geom, d.FiltersR, subUp, subDown)
+		})
+		downstreamR.Add(partial)
+	}
+	d.Input.PropagateRGradient(downstream, downstreamR, rgrad, grad)
+}
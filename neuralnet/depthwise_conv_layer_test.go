@@ -0,0 +1,74 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestDepthwiseConvOutput(t *testing.T) {
+	layers := []*DepthwiseConvLayer{
+		{FilterWidth: 3, FilterHeight: 2, Stride: 1, InputWidth: 6,
+			InputHeight: 5, InputDepth: 3},
+		{FilterWidth: 2, FilterHeight: 3, XStride: 2, YStride: 1, Dilation: 2,
+			SamePadding: true, InputWidth: 7, InputHeight: 6, InputDepth: 2},
+		{FilterWidth: 3, FilterHeight: 3, Stride: 2, PaddingX: 1, PaddingY: 2,
+			InputWidth: 5, InputHeight: 5, InputDepth: 4},
+	}
+	for i, layer := range layers {
+		layer.Randomize()
+		equiv := layer.geometry()
+		equiv.Randomize()
+		for j := range equiv.FilterVar.Vector {
+			equiv.FilterVar.Vector[j] = 0
+		}
+		copy(equiv.Biases.Vector, layer.Biases.Vector)
+		for c, filter := range equiv.Filters {
+			for y := 0; y < layer.FilterHeight; y++ {
+				for x := 0; x < layer.FilterWidth; x++ {
+					idx := (x+y*layer.FilterWidth)*layer.InputDepth + c
+					filter.Set(x, y, c, layer.Filters.Vector[idx])
+				}
+			}
+		}
+
+		inVar := &autofunc.Variable{
+			Vector: make(linalg.Vector, layer.InputWidth*layer.InputHeight*layer.InputDepth),
+		}
+		for j := range inVar.Vector {
+			inVar.Vector[j] = rand.NormFloat64()
+		}
+		expected := equiv.Apply(inVar).Output()
+		actual := layer.Apply(inVar).Output()
+		if len(actual) != len(expected) ||
+			actual.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-6 {
+			t.Errorf("test %d: expected %v but got %v", i, expected, actual)
+		}
+	}
+}
+
+func TestPointwiseConv(t *testing.T) {
+	layer := NewPointwiseConvLayer(3, 2, 4, 5)
+	if layer.OutputWidth() != 3 || layer.OutputHeight() != 2 || layer.OutputDepth() != 5 {
+		t.Fatalf("unexpected output shape %dx%dx%d", layer.OutputWidth(),
+			layer.OutputHeight(), layer.OutputDepth())
+	}
+	inVar := &autofunc.Variable{Vector: make(linalg.Vector, 3*2*4)}
+	for i := range inVar.Vector {
+		inVar.Vector[i] = rand.NormFloat64()
+	}
+	output := layer.Apply(inVar).Output()
+	for pos := 0; pos < 3*2; pos++ {
+		inVec := inVar.Vector[pos*4 : (pos+1)*4]
+		for i, filter := range layer.Filters {
+			expected := linalg.Vector(filter.Data).Dot(inVec) + layer.Biases.Vector[i]
+			if actual := output[pos*5+i]; math.Abs(actual-expected) > 1e-6 {
+				t.Errorf("position %d filter %d: expected %f but got %f", pos, i,
+					expected, actual)
+			}
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// EmbeddingLayer maps tokens from a vocabulary to learned
+// dense vectors.
+//
+// By default, each input is a vector of VocabSize values
+// (typically a one-hot vector), and the output is the
+// corresponding linear combination of embedding vectors.
+// Only the non-zero input components are visited, so a
+// one-hot input costs O(EmbeddingSize) rather than the
+// O(VocabSize*EmbeddingSize) of an equivalent DenseLayer.
+// Gradients are likewise only accumulated into the rows
+// of Vectors which were actually used.
+//
+// If IndexInput is set, each input is a single number
+// giving the index of a token in the vocabulary.
+// Indices must be integers in [0, VocabSize).
+// Indices are not differentiable, so no gradient is
+// propagated to the input in this mode.
+type EmbeddingLayer struct {
+	VocabSize     int
+	EmbeddingSize int
+	IndexInput    bool
+
+	// Vectors stores the embedding for each token in
+	// row-major order, one row per token.
+	Vectors *autofunc.Variable
+}
+
+// NewEmbeddingLayer creates a randomized EmbeddingLayer
+// which takes one-hot input vectors.
+func NewEmbeddingLayer(vocabSize, embeddingSize int) *EmbeddingLayer {
+	res := &EmbeddingLayer{
+		VocabSize:     vocabSize,
+		EmbeddingSize: embeddingSize,
+	}
+	res.Randomize()
+	return res
+}
+
+// DeserializeEmbeddingLayer deserializes an EmbeddingLayer.
+func DeserializeEmbeddingLayer(d []byte) (*EmbeddingLayer, error) {
+	var res EmbeddingLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Randomize sets every embedding component to a sample
+// from a standard normal distribution.
+//
+// This will create e.Vectors if it is nil.
+func (e *EmbeddingLayer) Randomize() {
+	if e.Vectors == nil {
+		e.Vectors = &autofunc.Variable{
+			Vector: make(linalg.Vector, e.VocabSize*e.EmbeddingSize),
+		}
+	}
+	for i := range e.Vectors.Vector {
+		e.Vectors.Vector[i] = rand.NormFloat64()
+	}
+}
+
+// Parameters returns a slice containing the embedding
+// matrix.
+func (e *EmbeddingLayer) Parameters() []*autofunc.Variable {
+	if e.Vectors == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{e.Vectors}
+}
+
+// Apply embeds a single input.
+func (e *EmbeddingLayer) Apply(in autofunc.Result) autofunc.Result {
+	return e.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (e *EmbeddingLayer) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return e.BatchR(rv, in, 1)
+}
+
+// Batch embeds each input in a batch.
+func (e *EmbeddingLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	e.checkInput(in.Output(), n)
+	return &embeddingResult{
+		OutputVec: e.combine(e.Vectors.Vector, in.Output(), n),
+		Input:     in,
+		N:         n,
+		Layer:     e,
+	}
+}
+
+// BatchR is like Batch, but for RResults.
+func (e *EmbeddingLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	e.checkInput(in.Output(), n)
+	res := &embeddingRResult{
+		OutputVec:  e.combine(e.Vectors.Vector, in.Output(), n),
+		ROutputVec: make(linalg.Vector, n*e.EmbeddingSize),
+		Input:      in,
+		VectorsR:   rv[e.Vectors],
+		N:          n,
+		Layer:      e,
+	}
+	if res.VectorsR != nil {
+		res.ROutputVec.Add(e.combine(res.VectorsR, in.Output(), n))
+	}
+	if !e.IndexInput {
+		res.ROutputVec.Add(e.combine(e.Vectors.Vector, in.ROutput(), n))
+	}
+	return res
+}
+
+// Serialize serializes the layer.
+func (e *EmbeddingLayer) Serialize() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (e *EmbeddingLayer) SerializerType() string {
+	return serializerTypeEmbeddingLayer
+}
+
+func (e *EmbeddingLayer) checkInput(in linalg.Vector, n int) {
+	if e.Vectors == nil {
+		panic(uninitPanicMessage)
+	}
+	if len(in) != n*e.inputSize() {
+		panic("invalid input size")
+	}
+}
+
+func (e *EmbeddingLayer) inputSize() int {
+	if e.IndexInput {
+		return 1
+	}
+	return e.VocabSize
+}
+
+// forEachEntry calls f for every non-zero coefficient
+// in a batch of inputs, giving the index of the input
+// in the batch and the vocabulary index of the token.
+func (e *EmbeddingLayer) forEachEntry(in linalg.Vector,
+	f func(sample, token int, coeff float64)) {
+	if e.IndexInput {
+		for sample, x := range in {
+			if x != math.Floor(x) {
+				panic("embedding index must be an integer")
+			} else if x < 0 || x >= float64(e.VocabSize) {
+				panic("embedding index out of range")
+			}
+			f(sample, int(x), 1)
+		}
+		return
+	}
+	for i, x := range in {
+		if x != 0 {
+			f(i/e.VocabSize, i%e.VocabSize, x)
+		}
+	}
+}
+
+// combine computes the linear combinations of the rows
+// of vectors specified by a batch of inputs.
+func (e *EmbeddingLayer) combine(vectors, in linalg.Vector, n int) linalg.Vector {
+	res := make(linalg.Vector, n*e.EmbeddingSize)
+	e.forEachEntry(in, func(sample, token int, coeff float64) {
+		out := res[sample*e.EmbeddingSize : (sample+1)*e.EmbeddingSize]
+		out.Add(e.row(vectors, token).Copy().Scale(coeff))
+	})
+	return res
+}
+
+// accumulate adds the gradient of the embedding matrix
+// to dest, only touching the rows used by the inputs.
+func (e *EmbeddingLayer) accumulate(dest, in, upstream linalg.Vector) {
+	e.forEachEntry(in, func(sample, token int, coeff float64) {
+		up := upstream[sample*e.EmbeddingSize : (sample+1)*e.EmbeddingSize]
+		e.row(dest, token).Add(up.Copy().Scale(coeff))
+	})
+}
+
+// inputGradient computes the gradient of the outputs
+// with respect to one-hot style inputs.
+func (e *EmbeddingLayer) inputGradient(vectors, upstream linalg.Vector,
+	n int) linalg.Vector {
+	res := make(linalg.Vector, n*e.VocabSize)
+	for sample := 0; sample < n; sample++ {
+		up := upstream[sample*e.EmbeddingSize : (sample+1)*e.EmbeddingSize]
+		for token := 0; token < e.VocabSize; token++ {
+			res[sample*e.VocabSize+token] = e.row(vectors, token).Dot(up)
+		}
+	}
+	return res
+}
+
+func (e *EmbeddingLayer) row(vectors linalg.Vector, token int) linalg.Vector {
+	return vectors[token*e.EmbeddingSize : (token+1)*e.EmbeddingSize]
+}
+
+type embeddingResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	N         int
+	Layer     *EmbeddingLayer
+}
+
+func (e *embeddingResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *embeddingResult) Constant(g autofunc.Gradient) bool {
+	if !e.Layer.Vectors.Constant(g) {
+		return false
+	}
+	return e.Layer.IndexInput || e.Input.Constant(g)
+}
+
+func (e *embeddingResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	layer := e.Layer
+	if vecGrad, ok := grad[layer.Vectors]; ok {
+		layer.accumulate(vecGrad, e.Input.Output(), upstream)
+	}
+	if layer.IndexInput || e.Input.Constant(grad) {
+		return
+	}
+	downstream := layer.inputGradient(layer.Vectors.Vector, upstream, e.N)
+	e.Input.PropagateGradient(downstream, grad)
+}
+
+type embeddingRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	VectorsR   linalg.Vector
+	N          int
+	Layer      *EmbeddingLayer
+}
+
+func (e *embeddingRResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *embeddingRResult) ROutput() linalg.Vector {
+	return e.ROutputVec
+}
+
+func (e *embeddingRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	if !e.Layer.Vectors.Constant(g) {
+		return false
+	}
+	if _, ok := rg[e.Layer.Vectors]; ok {
+		return false
+	}
+	return e.Layer.IndexInput || e.Input.Constant(rg, g)
+}
+
+func (e *embeddingRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if grad == nil {
+		grad = autofunc.Gradient{}
+	}
+	layer := e.Layer
+	input := e.Input.Output()
+
+	if vecGrad, ok := grad[layer.Vectors]; ok {
+		layer.accumulate(vecGrad, input, upstream)
+	}
+	if vecRGrad, ok := rgrad[layer.Vectors]; ok {
+		layer.accumulate(vecRGrad, input, upstreamR)
+		if !layer.IndexInput {
+			layer.accumulate(vecRGrad, e.Input.ROutput(), upstream)
+		}
+	}
+
+	if layer.IndexInput || e.Input.Constant(rgrad, grad) {
+		return
+	}
+
+	downstream := layer.inputGradient(layer.Vectors.Vector, upstream, e.N)
+	downstreamR := layer.inputGradient(layer.Vectors.Vector, upstreamR, e.N)
+	if e.VectorsR != nil {
+		downstreamR.Add(layer.inputGradient(e.VectorsR, upstream, e.N))
+	}
+	e.Input.PropagateRGradient(downstream, downstreamR, rgrad, grad)
+}
@@ -0,0 +1,130 @@
+package neuralnet
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestEmbeddingLayerOutput(t *testing.T) {
+	layer := NewEmbeddingLayer(4, 3)
+	dense := &DenseLayer{InputCount: 4, OutputCount: 3}
+	dense.Randomize()
+	for token := 0; token < 4; token++ {
+		for i := 0; i < 3; i++ {
+			dense.Weights.Data.Vector[i*4+token] = layer.Vectors.Vector[token*3+i]
+		}
+	}
+	for i := range dense.Biases.Var.Vector {
+		dense.Biases.Var.Vector[i] = 0
+	}
+
+	input := &autofunc.Variable{Vector: []float64{0, 0, 1, 0, 0.5, 0, 0, -2}}
+	expected := dense.Batch(input, 2).Output()
+	actual := layer.Batch(input, 2).Output()
+	if actual.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-6 {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+
+	layer.IndexInput = true
+	indices := &autofunc.Variable{Vector: []float64{3, 1}}
+	expected = append(layer.row(layer.Vectors.Vector, 3).Copy(),
+		layer.row(layer.Vectors.Vector, 1)...)
+	actual = layer.Batch(indices, 2).Output()
+	if actual.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-6 {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestEmbeddingLayerSparseGradient(t *testing.T) {
+	layer := NewEmbeddingLayer(5, 2)
+	layer.IndexInput = true
+	input := &autofunc.Variable{Vector: []float64{1, 3, 1}}
+	grad := autofunc.NewGradient(layer.Parameters())
+	out := layer.Batch(input, 3)
+	out.PropagateGradient([]float64{1, 2, 3, 4, 5, 6}, grad)
+
+	expected := linalg.Vector{0, 0, 6, 8, 0, 0, 3, 4, 0, 0}
+	actual := grad[layer.Vectors]
+	if actual.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-6 {
+		t.Errorf("expected gradient %v but got %v", expected, actual)
+	}
+}
+
+func TestEmbeddingLayerInvalidIndex(t *testing.T) {
+	layer := NewEmbeddingLayer(5, 2)
+	layer.IndexInput = true
+	for _, idx := range []float64{-0.5, 1.5, 5, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("index %f: expected panic", idx)
+				}
+			}()
+			layer.Apply(&autofunc.Variable{Vector: []float64{idx}})
+		}()
+	}
+}
+
+func TestEmbeddingLayerRProp(t *testing.T) {
+	layer := NewEmbeddingLayer(6, 3)
+	input := make(linalg.Vector, 6)
+	for i := range input {
+		input[i] = rand.NormFloat64()
+	}
+	inVar := &autofunc.Variable{Vector: input}
+	vars := append(layer.Parameters(), inVar)
+	funcTest := &functest.RFuncTest{
+		F:     layer,
+		Vars:  vars,
+		Input: inVar,
+		RV:    randomRVector(vars),
+	}
+	funcTest.Run(t)
+}
+
+func TestEmbeddingLayerBatch(t *testing.T) {
+	layer := NewEmbeddingLayer(6, 3)
+	n := 3
+	input := make(linalg.Vector, 6*n)
+	for i := range input {
+		if rand.Intn(2) == 0 {
+			input[i] = rand.NormFloat64()
+		}
+	}
+	inVar := &autofunc.Variable{Vector: input}
+	params := append(layer.Parameters(), inVar)
+	testBatcher(t, layer, inVar, n, params)
+	rv := randomRVector(params)
+	testRBatcher(t, rv, layer, autofunc.NewRVariable(inVar, rv), n, params)
+}
+
+func TestEmbeddingLayerSerialize(t *testing.T) {
+	layer := NewEmbeddingLayer(5, 4)
+	layer.IndexInput = true
+	data, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(layer.SerializerType())(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := decoded.(*EmbeddingLayer)
+	if !ok {
+		t.Fatalf("unexpected type: %T", decoded)
+	}
+	if newLayer.VocabSize != layer.VocabSize ||
+		newLayer.EmbeddingSize != layer.EmbeddingSize ||
+		newLayer.IndexInput != layer.IndexInput {
+		t.Errorf("expected %v but got %v", layer, newLayer)
+	}
+	diff := newLayer.Vectors.Vector.Copy().Scale(-1).Add(layer.Vectors.Vector)
+	if diff.MaxAbs() > 1e-6 {
+		t.Error("embedding vectors do not match")
+	}
+}
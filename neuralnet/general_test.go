@@ -109,3 +109,15 @@ func testRBatcher(t *testing.T, rv autofunc.RVector, b batchFuncR, in autofunc.R
 		}
 	})
 }
+
+func randomRVector(vars []*autofunc.Variable) autofunc.RVector {
+	res := autofunc.RVector{}
+	for _, v := range vars {
+		vec := make(linalg.Vector, len(v.Vector))
+		for i := range vec {
+			vec[i] = rand.NormFloat64()
+		}
+		res[v] = vec
+	}
+	return res
+}
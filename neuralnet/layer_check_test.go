@@ -0,0 +1,134 @@
+package neuralnet_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/neuralnet/nettest"
+)
+
+func TestAvgPoolingChecks(t *testing.T) {
+	layers := []*neuralnet.AvgPoolingLayer{
+		{XSpan: 3, YSpan: 2, XStride: 2, InputWidth: 8, InputHeight: 5,
+			InputDepth: 2},
+		{XSpan: 3, YSpan: 2, YStride: 1, InputWidth: 7, InputHeight: 4,
+			InputDepth: 3},
+	}
+	for i, layer := range layers {
+		test := &nettest.LayerTest{
+			Layer:     layer,
+			InputSize: layer.InputWidth * layer.InputHeight * layer.InputDepth,
+		}
+		t.Run(fmt.Sprint(i), test.Run)
+	}
+}
+
+func TestGlobalAvgPoolingChecks(t *testing.T) {
+	layer := &neuralnet.GlobalAvgPoolingLayer{InputWidth: 4, InputHeight: 3, InputDepth: 2}
+	test := &nettest.LayerTest{Layer: layer, InputSize: 4 * 3 * 2}
+	test.Run(t)
+}
+
+func TestUpsampleChecks(t *testing.T) {
+	for _, bilinear := range []bool{false, true} {
+		layer := &neuralnet.UpsampleLayer{
+			XFactor:     3,
+			YFactor:     2,
+			Bilinear:    bilinear,
+			InputWidth:  3,
+			InputHeight: 4,
+			InputDepth:  2,
+		}
+		test := &nettest.LayerTest{Layer: layer, InputSize: 3 * 4 * 2}
+		t.Run(fmt.Sprintf("Bilinear=%v", bilinear), test.Run)
+	}
+}
+
+func TestConv1DChecks(t *testing.T) {
+	layers := []*neuralnet.Conv1DLayer{
+		{FilterCount: 3, FilterSize: 3, Stride: 2, SamePadding: true,
+			InputLength: 7, InputDepth: 2},
+		{FilterCount: 2, FilterSize: 2, Stride: 1, Dilation: 3,
+			InputLength: 10, InputDepth: 3},
+		{FilterCount: 2, FilterSize: 3, Stride: 1, Padding: 1,
+			InputLength: 5, InputDepth: 2},
+	}
+	for i, layer := range layers {
+		layer.Randomize()
+		test := &nettest.LayerTest{
+			Layer:     layer,
+			InputSize: layer.InputLength * layer.InputDepth,
+		}
+		t.Run(fmt.Sprint(i), test.Run)
+	}
+}
+
+func TestDepthwiseConvChecks(t *testing.T) {
+	layers := []*neuralnet.DepthwiseConvLayer{
+		{FilterWidth: 2, FilterHeight: 3, Stride: 2, SamePadding: true,
+			InputWidth: 5, InputHeight: 7, InputDepth: 3},
+		{FilterWidth: 3, FilterHeight: 2, Stride: 1, Dilation: 2,
+			InputWidth: 8, InputHeight: 6, InputDepth: 3},
+	}
+	for i, layer := range layers {
+		layer.Randomize()
+		test := &nettest.LayerTest{
+			Layer:     layer,
+			InputSize: layer.InputWidth * layer.InputHeight * layer.InputDepth,
+		}
+		t.Run(fmt.Sprint(i), test.Run)
+	}
+}
+
+func TestResidualChecks(t *testing.T) {
+	body := neuralnet.Network{
+		&neuralnet.DenseLayer{InputCount: 4, OutputCount: 5},
+		&neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{InputCount: 5, OutputCount: 4},
+	}
+	body.Randomize()
+	projection := &neuralnet.DenseLayer{InputCount: 4, OutputCount: 3}
+	projection.Randomize()
+	layers := []*neuralnet.Residual{
+		{Body: body},
+		{Body: checkBranch(4, 3), Projection: projection},
+	}
+	for i, layer := range layers {
+		test := &nettest.LayerTest{Layer: layer, InputSize: 4}
+		t.Run(fmt.Sprint(i), test.Run)
+	}
+}
+
+func TestConcatChecks(t *testing.T) {
+	layer := &neuralnet.Concat{
+		Branches: []neuralnet.Layer{
+			checkBranch(4, 2),
+			checkBranch(4, 3),
+			&neuralnet.Residual{Body: checkBranch(4, 4)},
+		},
+	}
+	test := &nettest.LayerTest{Layer: layer, InputSize: 4}
+	test.Run(t)
+}
+
+func TestSumChecks(t *testing.T) {
+	layer := &neuralnet.Sum{
+		Branches: []neuralnet.Layer{
+			checkBranch(4, 4),
+			checkBranch(4, 4),
+			&neuralnet.Residual{Body: checkBranch(4, 4)},
+		},
+	}
+	test := &nettest.LayerTest{Layer: layer, InputSize: 4}
+	test.Run(t)
+}
+
+func checkBranch(inCount, outCount int) neuralnet.Network {
+	res := neuralnet.Network{
+		&neuralnet.DenseLayer{InputCount: inCount, OutputCount: outCount},
+		&neuralnet.HyperbolicTangent{},
+	}
+	res.Randomize()
+	return res
+}
@@ -0,0 +1,349 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+const defaultLayerNormStabilizer = 1e-5
+
+// LayerNorm is a Layer which normalizes each of its
+// input vectors to have a mean of 0 and a variance of
+// 1, then scales and shifts the normalized values using
+// learned per-component gains and biases.
+//
+// Unlike BatchNormLayer, a LayerNorm computes statistics
+// for each input independently, so its behavior does not
+// depend on the batch size or on a training mode.
+type LayerNorm struct {
+	// InputCount is the size of each input vector.
+	InputCount int
+
+	// Stabilizer is added to each variance before it is
+	// used to normalize an input.
+	Stabilizer float64
+
+	Gains  *autofunc.Variable
+	Biases *autofunc.Variable
+}
+
+// NewLayerNorm creates a LayerNorm with unit gains and
+// zero biases.
+func NewLayerNorm(inCount int) *LayerNorm {
+	res := &LayerNorm{
+		InputCount: inCount,
+		Stabilizer: defaultLayerNormStabilizer,
+		Gains:      &autofunc.Variable{Vector: make(linalg.Vector, inCount)},
+		Biases:     &autofunc.Variable{Vector: make(linalg.Vector, inCount)},
+	}
+	for i := range res.Gains.Vector {
+		res.Gains.Vector[i] = 1
+	}
+	return res
+}
+
+// DeserializeLayerNorm deserializes a LayerNorm.
+func DeserializeLayerNorm(d []byte) (*LayerNorm, error) {
+	var res LayerNorm
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Parameters returns a slice containing the gain and
+// bias variables.
+func (l *LayerNorm) Parameters() []*autofunc.Variable {
+	if l.Gains == nil || l.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{l.Gains, l.Biases}
+}
+
+// Apply normalizes a single input vector.
+func (l *LayerNorm) Apply(in autofunc.Result) autofunc.Result {
+	return l.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (l *LayerNorm) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return l.BatchR(rv, in, 1)
+}
+
+// Batch normalizes each of the input vectors in a batch.
+func (l *LayerNorm) Batch(in autofunc.Result, n int) autofunc.Result {
+	l.checkInput(in.Output(), n)
+	normalized, invStddevs := l.normalize(in.Output())
+	res := &layerNormResult{
+		OutputVec:  make(linalg.Vector, len(normalized)),
+		Normalized: normalized,
+		InvStddevs: invStddevs,
+		Input:      in,
+		Layer:      l,
+	}
+	for i, x := range normalized {
+		k := i % l.InputCount
+		res.OutputVec[i] = x*l.Gains.Vector[k] + l.Biases.Vector[k]
+	}
+	return res
+}
+
+// BatchR is like Batch, but for RResults.
+func (l *LayerNorm) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	l.checkInput(in.Output(), n)
+	normalized, invStddevs := l.normalize(in.Output())
+	res := &layerNormRResult{
+		OutputVec:   make(linalg.Vector, len(normalized)),
+		ROutputVec:  make(linalg.Vector, len(normalized)),
+		Normalized:  normalized,
+		NormalizedR: make(linalg.Vector, len(normalized)),
+		InvStddevs:  invStddevs,
+		InvStddevsR: make(linalg.Vector, len(invStddevs)),
+		Input:       in,
+		GainsR:      rv[l.Gains],
+		Layer:       l,
+	}
+
+	inR := in.ROutput()
+	meansR := l.sampleMeans(inR)
+	centeredR := make(linalg.Vector, len(inR))
+	products := make(linalg.Vector, len(inR))
+	for i, x := range inR {
+		centeredR[i] = x - meansR[i/l.InputCount]
+		products[i] = centeredR[i] * normalized[i]
+	}
+	for j, x := range l.sampleMeans(products) {
+		s := invStddevs[j]
+		res.InvStddevsR[j] = -s * s * x
+	}
+	for i, x := range centeredR {
+		j := i / l.InputCount
+		res.NormalizedR[i] = x*invStddevs[j] +
+			normalized[i]*res.InvStddevsR[j]/invStddevs[j]
+	}
+
+	biasesR := rv[l.Biases]
+	for i, x := range normalized {
+		k := i % l.InputCount
+		res.OutputVec[i] = x*l.Gains.Vector[k] + l.Biases.Vector[k]
+		res.ROutputVec[i] = res.NormalizedR[i] * l.Gains.Vector[k]
+		if res.GainsR != nil {
+			res.ROutputVec[i] += x * res.GainsR[k]
+		}
+		if biasesR != nil {
+			res.ROutputVec[i] += biasesR[k]
+		}
+	}
+
+	return res
+}
+
+// Serialize serializes the layer.
+func (l *LayerNorm) Serialize() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (l *LayerNorm) SerializerType() string {
+	return serializerTypeLayerNorm
+}
+
+func (l *LayerNorm) checkInput(in linalg.Vector, n int) {
+	if l.Gains == nil || l.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	if len(in) != n*l.InputCount {
+		panic("invalid input size")
+	}
+}
+
+// normalize computes the normalized inputs and the
+// inverse standard deviation of each input vector.
+func (l *LayerNorm) normalize(in linalg.Vector) (normalized, invStddevs linalg.Vector) {
+	means := l.sampleMeans(in)
+	normalized = make(linalg.Vector, len(in))
+	squares := make(linalg.Vector, len(in))
+	for i, x := range in {
+		normalized[i] = x - means[i/l.InputCount]
+		squares[i] = normalized[i] * normalized[i]
+	}
+	invStddevs = l.sampleMeans(squares)
+	for j, v := range invStddevs {
+		invStddevs[j] = 1 / math.Sqrt(v+l.Stabilizer)
+	}
+	for i := range normalized {
+		normalized[i] *= invStddevs[i/l.InputCount]
+	}
+	return
+}
+
+// sampleMeans computes the mean of each input vector
+// in a batch.
+func (l *LayerNorm) sampleMeans(v linalg.Vector) linalg.Vector {
+	res := make(linalg.Vector, len(v)/l.InputCount)
+	for i, x := range v {
+		res[i/l.InputCount] += x
+	}
+	return res.Scale(1 / float64(l.InputCount))
+}
+
+// paramSums sums the entries of v which correspond to
+// each gain or bias and adds the sums to dest.
+func (l *LayerNorm) paramSums(dest, v linalg.Vector) {
+	for i, x := range v {
+		dest[i%l.InputCount] += x
+	}
+}
+
+type layerNormResult struct {
+	OutputVec  linalg.Vector
+	Normalized linalg.Vector
+	InvStddevs linalg.Vector
+	Input      autofunc.Result
+	Layer      *LayerNorm
+}
+
+func (l *layerNormResult) Output() linalg.Vector {
+	return l.OutputVec
+}
+
+func (l *layerNormResult) Constant(g autofunc.Gradient) bool {
+	return l.Input.Constant(g) && l.Layer.Gains.Constant(g) &&
+		l.Layer.Biases.Constant(g)
+}
+
+func (l *layerNormResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	layer := l.Layer
+	if biasGrad, ok := grad[layer.Biases]; ok {
+		layer.paramSums(biasGrad, upstream)
+	}
+	if gainGrad, ok := grad[layer.Gains]; ok {
+		products := make(linalg.Vector, len(upstream))
+		for i, x := range upstream {
+			products[i] = x * l.Normalized[i]
+		}
+		layer.paramSums(gainGrad, products)
+	}
+
+	if l.Input.Constant(grad) {
+		return
+	}
+
+	normGrad := make(linalg.Vector, len(upstream))
+	products := make(linalg.Vector, len(upstream))
+	for i, x := range upstream {
+		normGrad[i] = x * layer.Gains.Vector[i%layer.InputCount]
+		products[i] = normGrad[i] * l.Normalized[i]
+	}
+	gradMeans := layer.sampleMeans(normGrad)
+	productMeans := layer.sampleMeans(products)
+	downstream := make(linalg.Vector, len(upstream))
+	for i, x := range normGrad {
+		j := i / layer.InputCount
+		downstream[i] = l.InvStddevs[j] *
+			(x - gradMeans[j] - l.Normalized[i]*productMeans[j])
+	}
+	l.Input.PropagateGradient(downstream, grad)
+}
+
+type layerNormRResult struct {
+	OutputVec   linalg.Vector
+	ROutputVec  linalg.Vector
+	Normalized  linalg.Vector
+	NormalizedR linalg.Vector
+	InvStddevs  linalg.Vector
+	InvStddevsR linalg.Vector
+	Input       autofunc.RResult
+	GainsR      linalg.Vector
+	Layer       *LayerNorm
+}
+
+func (l *layerNormRResult) Output() linalg.Vector {
+	return l.OutputVec
+}
+
+func (l *layerNormRResult) ROutput() linalg.Vector {
+	return l.ROutputVec
+}
+
+func (l *layerNormRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	if !l.Layer.Gains.Constant(g) || !l.Layer.Biases.Constant(g) {
+		return false
+	}
+	if _, ok := rg[l.Layer.Gains]; ok {
+		return false
+	}
+	if _, ok := rg[l.Layer.Biases]; ok {
+		return false
+	}
+	return l.Input.Constant(rg, g)
+}
+
+func (l *layerNormRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if grad == nil {
+		grad = autofunc.Gradient{}
+	}
+	layer := l.Layer
+
+	if biasGrad, ok := grad[layer.Biases]; ok {
+		layer.paramSums(biasGrad, upstream)
+	}
+	if biasRGrad, ok := rgrad[layer.Biases]; ok {
+		layer.paramSums(biasRGrad, upstreamR)
+	}
+	if gainGrad, ok := grad[layer.Gains]; ok {
+		products := make(linalg.Vector, len(upstream))
+		for i, x := range upstream {
+			products[i] = x * l.Normalized[i]
+		}
+		layer.paramSums(gainGrad, products)
+	}
+	if gainRGrad, ok := rgrad[layer.Gains]; ok {
+		products := make(linalg.Vector, len(upstream))
+		for i, x := range upstream {
+			products[i] = x*l.NormalizedR[i] + upstreamR[i]*l.Normalized[i]
+		}
+		layer.paramSums(gainRGrad, products)
+	}
+
+	if l.Input.Constant(rgrad, grad) {
+		return
+	}
+
+	normGrad := make(linalg.Vector, len(upstream))
+	normGradR := make(linalg.Vector, len(upstream))
+	products := make(linalg.Vector, len(upstream))
+	productsR := make(linalg.Vector, len(upstream))
+	for i, x := range upstream {
+		k := i % layer.InputCount
+		normGrad[i] = x * layer.Gains.Vector[k]
+		normGradR[i] = upstreamR[i] * layer.Gains.Vector[k]
+		if l.GainsR != nil {
+			normGradR[i] += x * l.GainsR[k]
+		}
+		products[i] = normGrad[i] * l.Normalized[i]
+		productsR[i] = normGradR[i]*l.Normalized[i] + normGrad[i]*l.NormalizedR[i]
+	}
+	gradMeans := layer.sampleMeans(normGrad)
+	gradMeansR := layer.sampleMeans(normGradR)
+	productMeans := layer.sampleMeans(products)
+	productMeansR := layer.sampleMeans(productsR)
+
+	downstream := make(linalg.Vector, len(upstream))
+	downstreamR := make(linalg.Vector, len(upstream))
+	for i, x := range normGrad {
+		j := i / layer.InputCount
+		centered := x - gradMeans[j] - l.Normalized[i]*productMeans[j]
+		centeredR := normGradR[i] - gradMeansR[j] -
+			l.NormalizedR[i]*productMeans[j] - l.Normalized[i]*productMeansR[j]
+		downstream[i] = l.InvStddevs[j] * centered
+		downstreamR[i] = l.InvStddevsR[j]*centered + l.InvStddevs[j]*centeredR
+	}
+	l.Input.PropagateRGradient(downstream, downstreamR, rgrad, grad)
+}
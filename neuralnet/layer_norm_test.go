@@ -0,0 +1,101 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestLayerNormOutput(t *testing.T) {
+	layer := NewLayerNorm(3)
+	layer.Gains.Vector = linalg.Vector{1, 2, 3}
+	layer.Biases.Vector = linalg.Vector{0, 1, -1}
+	input := &autofunc.Variable{Vector: linalg.Vector{1, 2, 3, 4, 4, 4}}
+	output := layer.Batch(input, 2).Output()
+
+	s := 1 / math.Sqrt(2.0/3+layer.Stabilizer)
+	expected := linalg.Vector{-s, 1, 3*s - 1, 0, 1, -1}
+	for i, x := range expected {
+		if math.Abs(output[i]-x) > 1e-5 {
+			t.Errorf("output %d: expected %f got %f", i, x, output[i])
+		}
+	}
+}
+
+func TestLayerNormRProp(t *testing.T) {
+	layer, inVar := layerNormTestInfo(4, 1)
+	rVector := layerNormTestRVector(layer, inVar)
+	funcTest := &functest.RFuncTest{
+		F:     layer,
+		Vars:  append(layer.Parameters(), inVar),
+		Input: inVar,
+		RV:    rVector,
+	}
+	funcTest.Run(t)
+}
+
+func TestLayerNormBatch(t *testing.T) {
+	layer, inVar := layerNormTestInfo(4, 3)
+	params := append(layer.Parameters(), inVar)
+	testBatcher(t, layer, inVar, 3, params)
+
+	rVector := layerNormTestRVector(layer, inVar)
+	inRVar := autofunc.NewRVariable(inVar, rVector)
+	testRBatcher(t, rVector, layer, inRVar, 3, params)
+}
+
+func TestLayerNormSerialize(t *testing.T) {
+	layer, _ := layerNormTestInfo(4, 1)
+	data, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(layer.SerializerType())(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := decoded.(*LayerNorm)
+	if !ok {
+		t.Fatalf("unexpected type: %T", decoded)
+	}
+	if newLayer.InputCount != layer.InputCount ||
+		newLayer.Stabilizer != layer.Stabilizer {
+		t.Fatal("invalid hyper-parameters")
+	}
+	for i, param := range layer.Parameters() {
+		newParam := newLayer.Parameters()[i]
+		if param.Vector.Copy().Scale(-1).Add(newParam.Vector).MaxAbs() != 0 {
+			t.Errorf("parameter %d: expected %v got %v", i, param.Vector,
+				newParam.Vector)
+		}
+	}
+}
+
+func layerNormTestInfo(inCount, n int) (*LayerNorm, *autofunc.Variable) {
+	layer := NewLayerNorm(inCount)
+	for i := 0; i < inCount; i++ {
+		layer.Gains.Vector[i] = rand.NormFloat64()
+		layer.Biases.Vector[i] = rand.NormFloat64()
+	}
+	inVec := make(linalg.Vector, inCount*n)
+	for i := range inVec {
+		inVec[i] = rand.NormFloat64()
+	}
+	return layer, &autofunc.Variable{Vector: inVec}
+}
+
+func layerNormTestRVector(layer *LayerNorm, in *autofunc.Variable) autofunc.RVector {
+	rVector := autofunc.RVector{}
+	for _, variable := range append(layer.Parameters(), in) {
+		rVector[variable] = make(linalg.Vector, len(variable.Vector))
+		for i := range rVector[variable] {
+			rVector[variable][i] = rand.NormFloat64()
+		}
+	}
+	return rVector
+}
@@ -0,0 +1,178 @@
+package neuralnet
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// MaskedCost wraps a CostFunc and ignores every
+// component of the desired output which is NaN.
+//
+// If the wrapped CostFunc is separable (see
+// SeparableCost), it still sees vectors of the full size,
+// so costs which depend on component indices (such as
+// WeightedCrossEntropyCost) keep working.
+// Each ignored component is replaced by a fixed value in
+// both the desired and actual outputs, so it receives no
+// gradient and adds at most a constant to the cost
+// (nothing at all for distance-based costs like
+// MeanSquaredCost).
+//
+// If the wrapped CostFunc is not separable (e.g. it is a
+// MultiHingeCost), the ignored components are removed
+// before the CostFunc is applied, since a fixed value
+// could still interact with the other components.
+//
+// If every component is ignored, the cost is 0.
+//
+// The gradienters in this package automatically use
+// a MaskedCost for VectorSamples with a Mask, so it is
+// only necessary to use MaskedCost directly when the
+// desired outputs themselves contain NaNs.
+type MaskedCost struct {
+	CostFunc CostFunc
+}
+
+// maskFillValue is substituted for ignored components.
+// It is strictly between 0 and 1 so that costs which
+// take logarithms of their inputs remain finite.
+const maskFillValue = 0.5
+
+// Separable returns false if the wrapped CostFunc is a
+// SeparableCost which is not separable.
+func (m *MaskedCost) Separable() bool {
+	return costSeparable(m.CostFunc)
+}
+
+func (m *MaskedCost) Cost(x linalg.Vector, a autofunc.Result) autofunc.Result {
+	keep, count := outputMask(x)
+	if count == len(x) {
+		return m.CostFunc.Cost(x, a)
+	} else if count == 0 {
+		return &autofunc.Variable{Vector: linalg.Vector{0}}
+	}
+	if !costSeparable(m.CostFunc) {
+		return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+			var parts []autofunc.Result
+			forEachRun(keep, func(start, end int) {
+				parts = append(parts, autofunc.Slice(a, start, end))
+			})
+			return m.CostFunc.Cost(gatherKept(x, keep), autofunc.Concat(parts...))
+		})
+	}
+	return autofunc.Pool(a, func(a autofunc.Result) autofunc.Result {
+		keepVar := &autofunc.Variable{Vector: keep}
+		fillVar := &autofunc.Variable{Vector: maskFill(keep)}
+		maskedA := autofunc.Add(autofunc.Mul(a, keepVar), fillVar)
+		return m.CostFunc.Cost(fillMasked(x, keep), maskedA)
+	})
+}
+
+func (m *MaskedCost) CostR(v autofunc.RVector, x linalg.Vector,
+	a autofunc.RResult) autofunc.RResult {
+	keep, count := outputMask(x)
+	if count == len(x) {
+		return m.CostFunc.CostR(v, x, a)
+	} else if count == 0 {
+		zero := &autofunc.Variable{Vector: linalg.Vector{0}}
+		return autofunc.NewRVariable(zero, v)
+	}
+	if !costSeparable(m.CostFunc) {
+		return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+			var parts []autofunc.RResult
+			forEachRun(keep, func(start, end int) {
+				parts = append(parts, autofunc.SliceR(a, start, end))
+			})
+			return m.CostFunc.CostR(v, gatherKept(x, keep), autofunc.ConcatR(parts...))
+		})
+	}
+	return autofunc.PoolR(a, func(a autofunc.RResult) autofunc.RResult {
+		keepVar := autofunc.NewRVariable(&autofunc.Variable{Vector: keep}, v)
+		fillVar := autofunc.NewRVariable(&autofunc.Variable{Vector: maskFill(keep)}, v)
+		maskedA := autofunc.AddR(autofunc.MulR(a, keepVar), fillVar)
+		return m.CostFunc.CostR(v, fillMasked(x, keep), maskedA)
+	})
+}
+
+// MaskOutput creates a copy of a desired output vector
+// with NaN in place of every component for which the
+// corresponding mask component is 0.
+// The result is suitable for a MaskedCost.
+func MaskOutput(output, mask linalg.Vector) linalg.Vector {
+	if len(mask) != len(output) {
+		panic("mask size must match output size")
+	}
+	res := output.Copy()
+	for i, x := range mask {
+		if x == 0 {
+			res[i] = math.NaN()
+		}
+	}
+	return res
+}
+
+// outputMask returns a vector which is 1 for the non-NaN
+// components of x and 0 for the rest, along with the
+// number of non-NaN components.
+func outputMask(x linalg.Vector) (keep linalg.Vector, count int) {
+	keep = make(linalg.Vector, len(x))
+	for i, val := range x {
+		if !math.IsNaN(val) {
+			keep[i] = 1
+			count++
+		}
+	}
+	return
+}
+
+// maskFill returns a vector which is maskFillValue for
+// the ignored components and 0 for the rest.
+func maskFill(keep linalg.Vector) linalg.Vector {
+	res := make(linalg.Vector, len(keep))
+	for i, k := range keep {
+		if k == 0 {
+			res[i] = maskFillValue
+		}
+	}
+	return res
+}
+
+// fillMasked replaces the ignored components of x with
+// maskFillValue.
+func fillMasked(x, keep linalg.Vector) linalg.Vector {
+	res := x.Copy()
+	for i, k := range keep {
+		if k == 0 {
+			res[i] = maskFillValue
+		}
+	}
+	return res
+}
+
+// forEachRun calls f for every run of consecutive kept
+// components, giving the start and end of the run.
+func forEachRun(keep linalg.Vector, f func(start, end int)) {
+	start := -1
+	for i := 0; i <= len(keep); i++ {
+		kept := i < len(keep) && keep[i] != 0
+		if kept && start < 0 {
+			start = i
+		} else if !kept && start >= 0 {
+			f(start, i)
+			start = -1
+		}
+	}
+}
+
+// gatherKept returns the kept components of x.
+func gatherKept(x, keep linalg.Vector) linalg.Vector {
+	res := make(linalg.Vector, 0, len(x))
+	for i, k := range keep {
+		if k != 0 {
+			res = append(res, x[i])
+		}
+	}
+	return res
+}
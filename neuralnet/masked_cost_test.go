@@ -0,0 +1,191 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+func TestMaskedCostOutput(t *testing.T) {
+	nan := math.NaN()
+	expected := linalg.Vector{1, nan, 0.5, nan, nan, 2}
+	actual := &autofunc.Variable{Vector: []float64{0.5, 3, 1, -2, 7, 1}}
+	cost := &MaskedCost{CostFunc: MeanSquaredCost{}}
+
+	out := cost.Cost(expected, actual).Output()[0]
+	if math.Abs(out-1.5) > 1e-8 {
+		t.Errorf("expected 1.5 but got %f", out)
+	}
+	rv := autofunc.RVector{}
+	out = cost.CostR(rv, expected, autofunc.NewRVariable(actual, rv)).Output()[0]
+	if math.Abs(out-1.5) > 1e-8 {
+		t.Errorf("expected 1.5 from CostR but got %f", out)
+	}
+
+	allMasked := linalg.Vector{nan, nan, nan, nan, nan, nan}
+	if out := cost.Cost(allMasked, actual).Output()[0]; out != 0 {
+		t.Errorf("expected 0 but got %f", out)
+	}
+}
+
+func TestMaskedCostGradients(t *testing.T) {
+	actual := &autofunc.Variable{make(linalg.Vector, 10)}
+	expected := make(linalg.Vector, len(actual.Vector))
+	mask := make(linalg.Vector, len(actual.Vector))
+	rVector := autofunc.RVector{actual: make(linalg.Vector, len(expected))}
+	for i := range expected {
+		expected[i] = float64(rand.Intn(2))
+		mask[i] = float64(rand.Intn(2))
+		actual.Vector[i] = rand.NormFloat64()
+		rVector[actual][i] = rand.NormFloat64()
+	}
+	funcTest := &functest.RFuncTest{
+		F: costTestFunc{
+			Cost:     &MaskedCost{CostFunc: SigmoidCECost{}},
+			Expected: MaskOutput(expected, mask),
+		},
+		Vars:  []*autofunc.Variable{actual},
+		Input: actual,
+		RV:    rVector,
+	}
+	funcTest.Run(t)
+}
+
+func TestMaskedWeightedCrossEntropy(t *testing.T) {
+	nan := math.NaN()
+	weights := linalg.Vector{2, 0.5, 1, 3}
+	cost := &MaskedCost{CostFunc: WeightedCrossEntropyCost{Weights: weights}}
+	expected := linalg.Vector{1, nan, 0, nan}
+	actual := &autofunc.Variable{Vector: []float64{0.7, 0.2, 0.4, 0.9}}
+
+	// Each ignored component adds a constant w*log(2).
+	expOut := -2*math.Log(0.7) - math.Log(0.6) + (0.5+3)*math.Log(2)
+	if out := cost.Cost(expected, actual).Output()[0]; math.Abs(out-expOut) > 1e-8 {
+		t.Errorf("expected %f but got %f", expOut, out)
+	}
+
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+	expGrad := linalg.Vector{-2 / 0.7, 0, 1 / 0.6, 0}
+	if diff := grad[actual].Copy().Scale(-1).Add(expGrad).MaxAbs(); diff > 1e-8 {
+		t.Errorf("expected gradient %v but got %v", expGrad, grad[actual])
+	}
+
+	rVector := autofunc.RVector{actual: []float64{0.3, -0.2, 0.5, 0.1}}
+	funcTest := &functest.RFuncTest{
+		F:     costTestFunc{Cost: cost, Expected: expected},
+		Vars:  []*autofunc.Variable{actual},
+		Input: actual,
+		RV:    rVector,
+	}
+	funcTest.Run(t)
+
+	testMaskedGradienters(t, WeightedCrossEntropyCost{Weights: weights})
+}
+
+func TestMaskedMultiHinge(t *testing.T) {
+	nan := math.NaN()
+	expected := linalg.Vector{nan, 0, 1, nan}
+	actual := &autofunc.Variable{Vector: []float64{5, 0.2, 0.5, 0.3}}
+	cost := &MaskedCost{CostFunc: MultiHingeCost{}}
+
+	// Neither the masked class with score 5 nor any fill
+	// value may be the rival.
+	if out := cost.Cost(expected, actual).Output()[0]; math.Abs(out-0.7) > 1e-8 {
+		t.Errorf("expected 0.7 but got %f", out)
+	}
+	rv := autofunc.RVector{}
+	outR := cost.CostR(rv, expected, autofunc.NewRVariable(actual, rv)).Output()[0]
+	if math.Abs(outR-0.7) > 1e-8 {
+		t.Errorf("expected 0.7 from CostR but got %f", outR)
+	}
+
+	grad := autofunc.NewGradient([]*autofunc.Variable{actual})
+	cost.Cost(expected, actual).PropagateGradient(linalg.Vector{1}, grad)
+	expGrad := linalg.Vector{0, 1, -1, 0}
+	if diff := grad[actual].Copy().Scale(-1).Add(expGrad).MaxAbs(); diff > 1e-8 {
+		t.Errorf("expected gradient %v but got %v", expGrad, grad[actual])
+	}
+	testMaskedGradienters(t, MultiHingeCost{})
+}
+
+func TestMaskedGradienters(t *testing.T) {
+	testMaskedGradienters(t, MeanSquaredCost{})
+}
+
+func testMaskedGradienters(t *testing.T, cost CostFunc) {
+	net := Network{
+		&DenseLayer{InputCount: 5, OutputCount: 10},
+		&Sigmoid{},
+		&DenseLayer{InputCount: 10, OutputCount: 4},
+		&Sigmoid{},
+	}
+	net.Randomize()
+
+	samples := sgd.SliceSampleSet{}
+	shuffled := sgd.SliceSampleSet{}
+	for i := 0; i < 10; i++ {
+		sample := VectorSample{
+			Input:  make(linalg.Vector, 5),
+			Output: make(linalg.Vector, 4),
+			Mask:   make(linalg.Vector, 4),
+		}
+		for j := range sample.Input {
+			sample.Input[j] = rand.NormFloat64()
+		}
+		for j := range sample.Output {
+			sample.Output[j] = float64(rand.Intn(2))
+			sample.Mask[j] = float64(rand.Intn(2))
+		}
+		samples = append(samples, sample)
+
+		changed := sample
+		changed.Output = sample.Output.Copy()
+		for j, m := range sample.Mask {
+			if m == 0 {
+				changed.Output[j] = rand.NormFloat64()
+			}
+		}
+		shuffled = append(shuffled, changed)
+	}
+
+	rVector := autofunc.RVector(autofunc.NewGradient(net.Parameters()))
+	for _, vec := range rVector {
+		for i := range vec {
+			vec[i] = rand.NormFloat64()
+		}
+	}
+
+	single := &SingleRGradienter{Learner: net, CostFunc: cost}
+	batch := &BatchRGradienter{
+		Learner:      net.BatchLearner(),
+		CostFunc:     cost,
+		MaxBatchSize: 3,
+	}
+	expected, expectedR := single.RGradient(rVector, samples)
+	expected, expectedR = copyVecMap(expected), copyVecMap(expectedR)
+
+	for _, set := range []sgd.SampleSet{samples, shuffled} {
+		actual, actualR := single.RGradient(rVector, set)
+		if !vecMapsEqual(expected, actual) || !vecMapsEqual(expectedR, actualR) {
+			t.Error("bad gradients from SingleRGradienter")
+		}
+		actual, actualR = batch.RGradient(rVector, set)
+		if !vecMapsEqual(expected, actual) || !vecMapsEqual(expectedR, actualR) {
+			t.Error("bad gradients from BatchRGradienter")
+		}
+	}
+}
+
+func copyVecMap(m map[*autofunc.Variable]linalg.Vector) map[*autofunc.Variable]linalg.Vector {
+	res := map[*autofunc.Variable]linalg.Vector{}
+	for k, v := range m {
+		res[k] = v.Copy()
+	}
+	return res
+}
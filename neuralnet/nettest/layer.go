@@ -0,0 +1,216 @@
+// Package nettest provides a test harness for checking
+// that custom neuralnet.Layer implementations compute
+// correct gradients, batch correctly, and serialize
+// properly.
+package nettest
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+const (
+	defaultBatchSize  = 3
+	batchTestPrec     = 1e-5
+	serializeTestPrec = 1e-10
+)
+
+// LayerTest performs a suite of checks on a Layer:
+//
+//   - Gradients and r-gradients are compared to finite
+//     differences, as are r-outputs.
+//   - If the Layer is an autofunc.Batcher, its Batch
+//     outputs and gradients are compared to those of
+//     Apply.
+//   - If the Layer is an autofunc.RBatcher, the same
+//     checks are performed for BatchR and ApplyR.
+//   - The Layer is serialized and deserialized, and the
+//     resulting Layer is checked for equivalence.
+//
+// If the Layer is an sgd.Learner, its parameters are
+// included in the gradient checks.
+type LayerTest struct {
+	Layer neuralnet.Layer
+
+	// InputSize is the size of each input to the Layer.
+	InputSize int
+
+	// BatchSize is the number of inputs to use when
+	// checking batches.
+	// If this is 0, a reasonable default is used.
+	BatchSize int
+
+	// Vars lists additional variables which the Layer
+	// depends on and which should be included in the
+	// gradient checks.
+	Vars []*autofunc.Variable
+}
+
+// Run runs each check as a sub-test of t.
+func (l *LayerTest) Run(t *testing.T) {
+	t.Run("Gradients", l.checkGradients)
+	if _, ok := l.Layer.(autofunc.Batcher); ok {
+		t.Run("Batch", l.checkBatch)
+	}
+	if _, ok := l.Layer.(autofunc.RBatcher); ok {
+		t.Run("BatchR", l.checkBatchR)
+	}
+	t.Run("Serialize", l.checkSerialize)
+}
+
+func (l *LayerTest) checkGradients(t *testing.T) {
+	input := randomVariable(l.InputSize)
+	vars := append(l.params(), input)
+	funcTest := &functest.RFuncTest{
+		F:     l.Layer,
+		Vars:  vars,
+		Input: input,
+		RV:    randomRVector(vars),
+	}
+	funcTest.Run(t)
+}
+
+func (l *LayerTest) checkBatch(t *testing.T) {
+	batcher := l.Layer.(autofunc.Batcher)
+	n := l.batchSize()
+	input := randomVariable(l.InputSize * n)
+	vars := append(l.params(), input)
+	funcBatcher := &autofunc.FuncBatcher{F: l.Layer}
+
+	expectedOut := funcBatcher.Batch(input, n)
+	actualOut := batcher.Batch(input, n)
+	compareVecs(t, "output", expectedOut.Output(), actualOut.Output())
+
+	upstream := randomVector(len(expectedOut.Output()))
+	expected := autofunc.NewGradient(vars)
+	actual := autofunc.NewGradient(vars)
+	expectedOut.PropagateGradient(upstream.Copy(), expected)
+	actualOut.PropagateGradient(upstream, actual)
+	for i, v := range vars {
+		compareVecs(t, fmt.Sprintf("variable %d gradient", i), expected[v], actual[v])
+	}
+}
+
+func (l *LayerTest) checkBatchR(t *testing.T) {
+	batcher := l.Layer.(autofunc.RBatcher)
+	n := l.batchSize()
+	input := randomVariable(l.InputSize * n)
+	vars := append(l.params(), input)
+	rv := randomRVector(vars)
+	rInput := autofunc.NewRVariable(input, rv)
+	funcBatcher := &autofunc.RFuncBatcher{F: l.Layer}
+
+	expectedOut := funcBatcher.BatchR(rv, rInput, n)
+	actualOut := batcher.BatchR(rv, rInput, n)
+	compareVecs(t, "output", expectedOut.Output(), actualOut.Output())
+	compareVecs(t, "r-output", expectedOut.ROutput(), actualOut.ROutput())
+
+	upstream := randomVector(len(expectedOut.Output()))
+	upstreamR := randomVector(len(expectedOut.Output()))
+	expected := autofunc.NewGradient(vars)
+	actual := autofunc.NewGradient(vars)
+	expectedR := autofunc.NewRGradient(vars)
+	actualR := autofunc.NewRGradient(vars)
+	expectedOut.PropagateRGradient(upstream.Copy(), upstreamR.Copy(), expectedR, expected)
+	actualOut.PropagateRGradient(upstream, upstreamR, actualR, actual)
+	for i, v := range vars {
+		compareVecs(t, fmt.Sprintf("variable %d gradient", i), expected[v], actual[v])
+		compareVecs(t, fmt.Sprintf("variable %d r-gradient", i), expectedR[v], actualR[v])
+	}
+}
+
+func (l *LayerTest) checkSerialize(t *testing.T) {
+	data, err := l.Layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deserializer := serializer.GetDeserializer(l.Layer.SerializerType())
+	if deserializer == nil {
+		t.Fatalf("no deserializer for type %s", l.Layer.SerializerType())
+	}
+	decoded, err := deserializer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%T", decoded) != fmt.Sprintf("%T", l.Layer) {
+		t.Fatalf("expected type %T but got %T", l.Layer, decoded)
+	}
+	newLayer := decoded.(neuralnet.Layer)
+
+	if learner, ok := l.Layer.(sgd.Learner); ok {
+		params := learner.Parameters()
+		newParams := newLayer.(sgd.Learner).Parameters()
+		if len(params) != len(newParams) {
+			t.Fatalf("expected %d parameters but got %d", len(params), len(newParams))
+		}
+		for i, p := range params {
+			compareVecs(t, fmt.Sprintf("parameter %d", i), p.Vector, newParams[i].Vector)
+		}
+	}
+
+	input := randomVariable(l.InputSize)
+	expected := l.Layer.Apply(input).Output()
+	actual := newLayer.Apply(input).Output()
+	if len(expected) != len(actual) {
+		t.Fatalf("expected output size %d but got %d", len(expected), len(actual))
+	}
+	for i, x := range expected {
+		if diff := x - actual[i]; diff > serializeTestPrec || diff < -serializeTestPrec {
+			t.Fatalf("output %d: expected %f but got %f", i, x, actual[i])
+		}
+	}
+}
+
+func (l *LayerTest) params() []*autofunc.Variable {
+	var res []*autofunc.Variable
+	if learner, ok := l.Layer.(sgd.Learner); ok {
+		res = append(res, learner.Parameters()...)
+	}
+	return append(res, l.Vars...)
+}
+
+func (l *LayerTest) batchSize() int {
+	if l.BatchSize == 0 {
+		return defaultBatchSize
+	}
+	return l.BatchSize
+}
+
+func compareVecs(t *testing.T, name string, expected, actual linalg.Vector) {
+	if len(expected) != len(actual) {
+		t.Errorf("%s: expected length %d but got %d", name, len(expected), len(actual))
+		return
+	}
+	diff := actual.Copy().Scale(-1).Add(expected).MaxAbs()
+	if diff > batchTestPrec {
+		t.Errorf("%s: expected %v but got %v", name, expected, actual)
+	}
+}
+
+func randomVector(size int) linalg.Vector {
+	res := make(linalg.Vector, size)
+	for i := range res {
+		res[i] = rand.NormFloat64()
+	}
+	return res
+}
+
+func randomVariable(size int) *autofunc.Variable {
+	return &autofunc.Variable{Vector: randomVector(size)}
+}
+
+func randomRVector(vars []*autofunc.Variable) autofunc.RVector {
+	res := autofunc.RVector{}
+	for _, v := range vars {
+		res[v] = randomVector(len(v.Vector))
+	}
+	return res
+}
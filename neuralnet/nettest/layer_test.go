@@ -0,0 +1,46 @@
+package nettest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestDenseLayer(t *testing.T) {
+	layer := &neuralnet.DenseLayer{InputCount: 4, OutputCount: 3}
+	layer.Randomize()
+	test := &LayerTest{Layer: layer, InputSize: 4}
+	test.Run(t)
+}
+
+func TestNetwork(t *testing.T) {
+	net := neuralnet.Network{
+		&neuralnet.DenseLayer{InputCount: 3, OutputCount: 5},
+		&neuralnet.HyperbolicTangent{},
+		&neuralnet.DenseLayer{InputCount: 5, OutputCount: 2},
+		&neuralnet.LogSoftmaxLayer{},
+	}
+	net.Randomize()
+	test := &LayerTest{Layer: net, InputSize: 3, BatchSize: 4}
+	test.Run(t)
+}
+
+func TestLayerNorm(t *testing.T) {
+	layer := neuralnet.NewLayerNorm(5)
+	test := &LayerTest{Layer: layer, InputSize: 5}
+	test.Run(t)
+}
+
+func TestActivations(t *testing.T) {
+	layers := []neuralnet.Layer{
+		&neuralnet.Sigmoid{},
+		&neuralnet.HyperbolicTangent{},
+		&neuralnet.Softplus{},
+		&neuralnet.Swish{},
+	}
+	for _, layer := range layers {
+		test := &LayerTest{Layer: layer, InputSize: 4}
+		t.Run(fmt.Sprintf("%T", layer), test.Run)
+	}
+}
@@ -198,3 +198,30 @@ func (n *networkBatchLearner) BatchR(v autofunc.RVector, in autofunc.RResult,
 func (n *networkBatchLearner) Parameters() []*autofunc.Variable {
 	return n.Network.Parameters()
 }
+
+// batchLayer applies a Layer to a batch of inputs,
+// taking advantage of the Layer's batching abilities
+// when possible.
+func batchLayer(l Layer, in autofunc.Result, n int) autofunc.Result {
+	switch l := l.(type) {
+	case autofunc.Batcher:
+		return l.Batch(in, n)
+	case Network:
+		return l.makeBatcher().Batch(in, n)
+	default:
+		return (&autofunc.FuncBatcher{F: l}).Batch(in, n)
+	}
+}
+
+// batchLayerR is like batchLayer, but for RResults.
+func batchLayerR(l Layer, v autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	switch l := l.(type) {
+	case autofunc.RBatcher:
+		return l.BatchR(v, in, n)
+	case Network:
+		return l.makeRBatcher().BatchR(v, in, n)
+	default:
+		return (&autofunc.RFuncBatcher{F: l}).BatchR(v, in, n)
+	}
+}
@@ -0,0 +1,221 @@
+package neuralnet
+
+import (
+	"encoding/json"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+const defaultPReLUSlope = 0.25
+
+// PReLU is a Layer which acts like LeakyReLU, except
+// that the slopes for negative inputs are learned.
+//
+// Input component i uses slope i%len(Slopes).
+// Thus, a single slope may be shared by every input,
+// or a Tensor3 may have one slope per depth layer.
+type PReLU struct {
+	Slopes *autofunc.Variable
+}
+
+// NewPReLU creates a PReLU with the given number of
+// slopes, each initialized to 0.25.
+func NewPReLU(slopeCount int) *PReLU {
+	res := &PReLU{
+		Slopes: &autofunc.Variable{Vector: make(linalg.Vector, slopeCount)},
+	}
+	for i := range res.Slopes.Vector {
+		res.Slopes.Vector[i] = defaultPReLUSlope
+	}
+	return res
+}
+
+// DeserializePReLU deserializes a PReLU.
+func DeserializePReLU(d []byte) (*PReLU, error) {
+	var res PReLU
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Parameters returns a slice containing the slope
+// variable.
+func (p *PReLU) Parameters() []*autofunc.Variable {
+	if p.Slopes == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{p.Slopes}
+}
+
+func (p *PReLU) Apply(in autofunc.Result) autofunc.Result {
+	if p.Slopes == nil {
+		panic(uninitPanicMessage)
+	}
+	inVec := in.Output()
+	res := &preluResult{
+		OutputVec: make(linalg.Vector, len(inVec)),
+		Input:     in,
+		Layer:     p,
+	}
+	for i, x := range inVec {
+		if x > 0 {
+			res.OutputVec[i] = x
+		} else {
+			res.OutputVec[i] = x * p.slope(p.Slopes.Vector, i)
+		}
+	}
+	return res
+}
+
+func (p *PReLU) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	if p.Slopes == nil {
+		panic(uninitPanicMessage)
+	}
+	inVec := in.Output()
+	inVecR := in.ROutput()
+	res := &preluRResult{
+		OutputVec:  make(linalg.Vector, len(inVec)),
+		ROutputVec: make(linalg.Vector, len(inVec)),
+		Input:      in,
+		SlopesR:    v[p.Slopes],
+		Layer:      p,
+	}
+	for i, x := range inVec {
+		if x > 0 {
+			res.OutputVec[i] = x
+			res.ROutputVec[i] = inVecR[i]
+			continue
+		}
+		slope := p.slope(p.Slopes.Vector, i)
+		res.OutputVec[i] = x * slope
+		res.ROutputVec[i] = inVecR[i] * slope
+		if res.SlopesR != nil {
+			res.ROutputVec[i] += x * p.slope(res.SlopesR, i)
+		}
+	}
+	return res
+}
+
+func (p *PReLU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return p.Apply(inputs)
+}
+
+func (p *PReLU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return p.ApplyR(v, inputs)
+}
+
+func (p *PReLU) Serialize() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *PReLU) SerializerType() string {
+	return serializerTypePReLU
+}
+
+func (p *PReLU) slope(slopes linalg.Vector, i int) float64 {
+	return slopes[i%len(slopes)]
+}
+
+type preluResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	Layer     *PReLU
+}
+
+func (p *preluResult) Output() linalg.Vector {
+	return p.OutputVec
+}
+
+func (p *preluResult) Constant(g autofunc.Gradient) bool {
+	return p.Input.Constant(g) && p.Layer.Slopes.Constant(g)
+}
+
+func (p *preluResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	slopes := p.Layer.Slopes.Vector
+	input := p.Input.Output()
+	if slopeGrad, ok := grad[p.Layer.Slopes]; ok {
+		for i, x := range input {
+			if x <= 0 {
+				slopeGrad[i%len(slopeGrad)] += upstream[i] * x
+			}
+		}
+	}
+	if p.Input.Constant(grad) {
+		return
+	}
+	for i, x := range input {
+		if x <= 0 {
+			upstream[i] *= p.Layer.slope(slopes, i)
+		}
+	}
+	p.Input.PropagateGradient(upstream, grad)
+}
+
+type preluRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	SlopesR    linalg.Vector
+	Layer      *PReLU
+}
+
+func (p *preluRResult) Output() linalg.Vector {
+	return p.OutputVec
+}
+
+func (p *preluRResult) ROutput() linalg.Vector {
+	return p.ROutputVec
+}
+
+func (p *preluRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	if !p.Layer.Slopes.Constant(g) {
+		return false
+	}
+	if _, ok := rg[p.Layer.Slopes]; ok {
+		return false
+	}
+	return p.Input.Constant(rg, g)
+}
+
+func (p *preluRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if grad == nil {
+		grad = autofunc.Gradient{}
+	}
+	layer := p.Layer
+	input := p.Input.Output()
+	inputR := p.Input.ROutput()
+
+	if slopeGrad, ok := grad[layer.Slopes]; ok {
+		for i, x := range input {
+			if x <= 0 {
+				slopeGrad[i%len(slopeGrad)] += upstream[i] * x
+			}
+		}
+	}
+	if slopeRGrad, ok := rgrad[layer.Slopes]; ok {
+		for i, x := range input {
+			if x <= 0 {
+				slopeRGrad[i%len(slopeRGrad)] += upstreamR[i]*x + upstream[i]*inputR[i]
+			}
+		}
+	}
+
+	if p.Input.Constant(rgrad, grad) {
+		return
+	}
+	for i, x := range input {
+		if x > 0 {
+			continue
+		}
+		slope := layer.slope(layer.Slopes.Vector, i)
+		upstreamR[i] *= slope
+		if p.SlopesR != nil {
+			upstreamR[i] += upstream[i] * layer.slope(p.SlopesR, i)
+		}
+		upstream[i] *= slope
+	}
+	p.Input.PropagateRGradient(upstream, upstreamR, rgrad, grad)
+}
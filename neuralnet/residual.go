@@ -0,0 +1,111 @@
+package neuralnet
+
+import (
+	"errors"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/serializer"
+)
+
+// Residual is a Layer which adds its input to the
+// output of a sub-network, as in a residual network.
+//
+// If the sub-network's output does not have the same
+// size as its input, a Projection layer can be used
+// to transform the input before it is added.
+type Residual struct {
+	Body Network
+
+	// Projection, if non-nil, is applied to the input
+	// before it is added to the output of Body.
+	Projection Layer
+}
+
+// DeserializeResidual deserializes a Residual.
+func DeserializeResidual(d []byte) (*Residual, error) {
+	list, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) != 1 && len(list) != 2 {
+		return nil, errors.New("invalid slice length for Residual")
+	}
+	body, ok := list[0].(Network)
+	if !ok {
+		return nil, errors.New("invalid body for Residual")
+	}
+	res := &Residual{Body: body}
+	if len(list) == 2 {
+		res.Projection, ok = list[1].(Layer)
+		if !ok {
+			return nil, errors.New("invalid projection for Residual")
+		}
+	}
+	return res, nil
+}
+
+// Randomize randomizes the body and the projection.
+func (r *Residual) Randomize() {
+	r.layers().Randomize()
+}
+
+// Parameters returns the parameters of the body,
+// followed by those of the projection.
+func (r *Residual) Parameters() []*autofunc.Variable {
+	return r.layers().Parameters()
+}
+
+// Apply applies the layer to an input.
+func (r *Residual) Apply(in autofunc.Result) autofunc.Result {
+	return r.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (r *Residual) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return r.BatchR(v, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (r *Residual) Batch(in autofunc.Result, n int) autofunc.Result {
+	return autofunc.Pool(in, func(in autofunc.Result) autofunc.Result {
+		shortcut := in
+		if r.Projection != nil {
+			shortcut = batchLayer(r.Projection, in, n)
+		}
+		return autofunc.Add(batchLayer(r.Body, in, n), shortcut)
+	})
+}
+
+// BatchR is like Batch, but for RResults.
+func (r *Residual) BatchR(v autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	return autofunc.PoolR(in, func(in autofunc.RResult) autofunc.RResult {
+		shortcut := in
+		if r.Projection != nil {
+			shortcut = batchLayerR(r.Projection, v, in, n)
+		}
+		return autofunc.AddR(batchLayerR(r.Body, v, in, n), shortcut)
+	})
+}
+
+// Serialize serializes the layer.
+func (r *Residual) Serialize() ([]byte, error) {
+	list := []serializer.Serializer{r.Body}
+	if r.Projection != nil {
+		list = append(list, r.Projection)
+	}
+	return serializer.SerializeSlice(list)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (r *Residual) SerializerType() string {
+	return serializerTypeResidual
+}
+
+func (r *Residual) layers() Network {
+	if r.Projection != nil {
+		return Network{r.Body, r.Projection}
+	}
+	return Network{r.Body}
+}
@@ -0,0 +1,58 @@
+package neuralnet
+
+import (
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/sgd"
+)
+
+func TestResidualOutput(t *testing.T) {
+	body := &DenseLayer{InputCount: 3, OutputCount: 3}
+	body.Randomize()
+	layer := &Residual{Body: Network{body}}
+
+	input := &autofunc.Variable{Vector: []float64{1, -2, 0.5}}
+	expected := body.Apply(input).Output().Copy().Add(input.Vector)
+	actual := layer.Apply(input).Output()
+	if actual.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-6 {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestResidualParameters(t *testing.T) {
+	layer := testResidualLayers()[1].(*Residual)
+	params := layer.Parameters()
+	expected := append(layer.Body.Parameters(),
+		layer.Projection.(sgd.Learner).Parameters()...)
+	if len(params) != len(expected) {
+		t.Fatalf("expected %d parameters but got %d", len(expected), len(params))
+	}
+	for i, p := range expected {
+		if params[i] != p {
+			t.Errorf("parameter %d is incorrect", i)
+		}
+	}
+}
+
+func testResidualLayers() []Layer {
+	body := Network{
+		&DenseLayer{InputCount: 4, OutputCount: 5},
+		&Sigmoid{},
+		&DenseLayer{InputCount: 5, OutputCount: 4},
+	}
+	body.Randomize()
+
+	projBody := Network{
+		&DenseLayer{InputCount: 4, OutputCount: 3},
+		&Sigmoid{},
+	}
+	projBody.Randomize()
+	projection := &DenseLayer{InputCount: 4, OutputCount: 3}
+	projection.Randomize()
+
+	return []Layer{
+		&Residual{Body: body},
+		&Residual{Body: projBody, Projection: projection},
+	}
+}
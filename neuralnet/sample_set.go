@@ -14,6 +14,30 @@ type VectorSample struct {
 
 	// Output is the desired output from the classifier.
 	Output linalg.Vector
+
+	// Mask, if non-nil, specifies which components of
+	// Output to train on.
+	// Components where the mask is 0 are ignored, as if
+	// a MaskedCost were used.
+	Mask linalg.Vector
+}
+
+// maskedOutput returns the desired output with NaN in
+// place of the masked components.
+func (v VectorSample) maskedOutput() linalg.Vector {
+	if v.Mask == nil {
+		return v.Output
+	}
+	return MaskOutput(v.Output, v.Mask)
+}
+
+// costFunc wraps a CostFunc in a MaskedCost if the
+// sample has a mask.
+func (v VectorSample) costFunc(c CostFunc) CostFunc {
+	if v.Mask == nil {
+		return c
+	}
+	return &MaskedCost{CostFunc: c}
 }
 
 // VectorSampleSet creates an sgd.SampleSet of
@@ -19,6 +19,28 @@ const (
 	serializerTypeDropoutLayer      = serializerTypePrefix + "DropoutLayer"
 	serializerTypeVecRescaleLayer   = serializerTypePrefix + "VecRescaleLayer"
 	serializerTypeGaussNoiseLayer   = serializerTypePrefix + "GaussNoiseLayer"
+	serializerTypeBatchNormLayer    = serializerTypePrefix + "BatchNormLayer"
+	serializerTypeLayerNorm         = serializerTypePrefix + "LayerNorm"
+	serializerTypeAvgPoolingLayer   = serializerTypePrefix + "AvgPoolingLayer"
+	serializerTypeDeconvLayer       = serializerTypePrefix + "DeconvLayer"
+	serializerTypeResidual          = serializerTypePrefix + "Residual"
+	serializerTypeConcat            = serializerTypePrefix + "Concat"
+	serializerTypeSum               = serializerTypePrefix + "Sum"
+	serializerTypeEmbeddingLayer    = serializerTypePrefix + "EmbeddingLayer"
+	serializerTypeLeakyReLU         = serializerTypePrefix + "LeakyReLU"
+	serializerTypeELU               = serializerTypePrefix + "ELU"
+	serializerTypeSELU              = serializerTypePrefix + "SELU"
+	serializerTypeSoftplus          = serializerTypePrefix + "Softplus"
+	serializerTypeSwish             = serializerTypePrefix + "Swish"
+	serializerTypeSiLU              = serializerTypePrefix + "SiLU"
+	serializerTypeGELU              = serializerTypePrefix + "GELU"
+	serializerTypeHardTanh          = serializerTypePrefix + "HardTanh"
+	serializerTypePReLU             = serializerTypePrefix + "PReLU"
+	serializerTypeUpsampleLayer     = serializerTypePrefix + "UpsampleLayer"
+	serializerTypeConv1DLayer       = serializerTypePrefix + "Conv1DLayer"
+
+	serializerTypeGlobalAvgPoolingLayer = serializerTypePrefix + "GlobalAvgPoolingLayer"
+	serializerTypeDepthwiseConvLayer    = serializerTypePrefix + "DepthwiseConvLayer"
 )
 
 func init() {
@@ -34,6 +56,30 @@ func init() {
 		func(d []byte) (serializer.Serializer, error) {
 			return &HyperbolicTangent{}, nil
 		})
+	serializer.RegisterDeserializer(serializerTypeSELU,
+		func(d []byte) (serializer.Serializer, error) {
+			return &SELU{}, nil
+		})
+	serializer.RegisterDeserializer(serializerTypeSoftplus,
+		func(d []byte) (serializer.Serializer, error) {
+			return &Softplus{}, nil
+		})
+	serializer.RegisterDeserializer(serializerTypeSwish,
+		func(d []byte) (serializer.Serializer, error) {
+			return &Swish{}, nil
+		})
+	serializer.RegisterDeserializer(serializerTypeSiLU,
+		func(d []byte) (serializer.Serializer, error) {
+			return &SiLU{}, nil
+		})
+	serializer.RegisterDeserializer(serializerTypeGELU,
+		func(d []byte) (serializer.Serializer, error) {
+			return &GELU{}, nil
+		})
+	serializer.RegisterDeserializer(serializerTypeHardTanh,
+		func(d []byte) (serializer.Serializer, error) {
+			return &HardTanh{}, nil
+		})
 	serializer.RegisterTypedDeserializer(serializerTypeConvLayer,
 		DeserializeConvLayer)
 	serializer.RegisterTypedDeserializer(serializerTypeDenseLayer,
@@ -58,4 +104,32 @@ func init() {
 		DeserializeVecRescaleLayer)
 	serializer.RegisterTypedDeserializer(serializerTypeGaussNoiseLayer,
 		DeserializeGaussNoiseLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeBatchNormLayer,
+		DeserializeBatchNormLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeLayerNorm,
+		DeserializeLayerNorm)
+	serializer.RegisterTypedDeserializer(serializerTypeAvgPoolingLayer,
+		DeserializeAvgPoolingLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeGlobalAvgPoolingLayer,
+		DeserializeGlobalAvgPoolingLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeDeconvLayer,
+		DeserializeDeconvLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeResidual,
+		DeserializeResidual)
+	serializer.RegisterTypedDeserializer(serializerTypeConcat,
+		DeserializeConcat)
+	serializer.RegisterTypedDeserializer(serializerTypeSum,
+		DeserializeSum)
+	serializer.RegisterTypedDeserializer(serializerTypeEmbeddingLayer,
+		DeserializeEmbeddingLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeLeakyReLU,
+		DeserializeLeakyReLU)
+	serializer.RegisterTypedDeserializer(serializerTypeELU, DeserializeELU)
+	serializer.RegisterTypedDeserializer(serializerTypePReLU, DeserializePReLU)
+	serializer.RegisterTypedDeserializer(serializerTypeUpsampleLayer,
+		DeserializeUpsampleLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeDepthwiseConvLayer,
+		DeserializeDepthwiseConvLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeConv1DLayer,
+		DeserializeConv1DLayer)
 }
@@ -35,10 +35,10 @@ func (b *SingleRGradienter) Gradient(s sgd.SampleSet) autofunc.Gradient {
 	for i := 0; i < s.Len(); i++ {
 		sample := s.GetSample(i)
 		vs := sample.(VectorSample)
-		output := vs.Output
+		output := vs.maskedOutput()
 		inVar := &autofunc.Variable{vs.Input}
 		result := b.Learner.Apply(inVar)
-		cost := b.CostFunc.Cost(output, result)
+		cost := vs.costFunc(b.CostFunc).Cost(output, result)
 		cost.PropagateGradient(linalg.Vector{1}, b.gradCache)
 	}
 
@@ -61,11 +61,11 @@ func (b *SingleRGradienter) RGradient(rv autofunc.RVector, s sgd.SampleSet) (aut
 	for i := 0; i < s.Len(); i++ {
 		sample := s.GetSample(i)
 		vs := sample.(VectorSample)
-		output := vs.Output
+		output := vs.maskedOutput()
 		inVar := &autofunc.Variable{vs.Input}
 		rVar := autofunc.NewRVariable(inVar, rv)
 		result := b.Learner.ApplyR(rv, rVar)
-		cost := b.CostFunc.CostR(rv, output, result)
+		cost := vs.costFunc(b.CostFunc).CostR(rv, output, result)
 		cost.PropagateRGradient(linalg.Vector{1}, linalg.Vector{0},
 			b.rgradCache, b.gradCache)
 	}
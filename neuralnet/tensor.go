@@ -124,6 +124,83 @@ func (t *Tensor3) ToCol(width, height, stride int) linalg.Vector {
 	return resVec
 }
 
+// toColDilated is like ToCol, but it supports separate
+// horizontal and vertical strides, as well as dilated
+// convolutional regions.
+// The width and height arguments specify the number of
+// entries in each region, not the area it spans.
+func (t *Tensor3) toColDilated(width, height, xStride, yStride,
+	dilation int) linalg.Vector {
+	if dilation < 1 {
+		dilation = 1
+	}
+	if dilation == 1 && xStride == yStride {
+		return t.ToCol(width, height, xStride)
+	}
+	w, h := dilatedColSize(t.Width, t.Height, width, height, xStride, yStride, dilation)
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	resVec := make(linalg.Vector, w*h*width*height*t.Depth)
+	t.colDilatedInto(resVec, width, height, xStride, yStride, dilation)
+	return resVec
+}
+
+// colDilatedInto writes the result of toColDilated to
+// dest, which must be large enough to hold it.
+// The dilation must be at least 1.
+func (t *Tensor3) colDilatedInto(dest linalg.Vector, width, height, xStride,
+	yStride, dilation int) {
+	w, h := dilatedColSize(t.Width, t.Height, width, height, xStride, yStride, dilation)
+	outData := dest
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for subY := 0; subY < height; subY++ {
+				inY := y*yStride + subY*dilation
+				for subX := 0; subX < width; subX++ {
+					inX := x*xStride + subX*dilation
+					start := (inY*t.Width + inX) * t.Depth
+					copy(outData, t.Data[start:start+t.Depth])
+					outData = outData[t.Depth:]
+				}
+			}
+		}
+	}
+}
+
+// newTensor3ColDilated is like NewTensor3Col, but it
+// inverts toColDilated instead of ToCol.
+func newTensor3ColDilated(width, height, depth int, col linalg.Vector,
+	convWidth, convHeight, xStride, yStride, dilation int) *Tensor3 {
+	if dilation < 1 {
+		dilation = 1
+	}
+	if dilation == 1 && xStride == yStride {
+		return NewTensor3Col(width, height, depth, col, convWidth, convHeight, xStride)
+	}
+	res := NewTensor3(width, height, depth)
+	w, h := dilatedColSize(width, height, convWidth, convHeight, xStride, yStride,
+		dilation)
+	if w <= 0 || h <= 0 {
+		return res
+	}
+	inData := col
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for subY := 0; subY < convHeight; subY++ {
+				outY := y*yStride + subY*dilation
+				for subX := 0; subX < convWidth; subX++ {
+					outX := x*xStride + subX*dilation
+					start := (outY*width + outX) * depth
+					linalg.Vector(res.Data[start : start+depth]).Add(inData[:depth])
+					inData = inData[depth:]
+				}
+			}
+		}
+	}
+	return res
+}
+
 // Crop extracts a sub-region of t and puts it into t1.
 // The sub-region starts at x,y in t and has the
 // dimensions of t1.
@@ -205,3 +282,13 @@ func (t *Tensor3) MulAdd(x, y int, t1 *Tensor3, s float64) {
 		}
 	}
 }
+
+func dilatedColSize(width, height, convWidth, convHeight, xStride, yStride,
+	dilation int) (w, h int) {
+	spanWidth := (convWidth-1)*dilation + 1
+	spanHeight := (convHeight-1)*dilation + 1
+	if spanWidth > width || spanHeight > height {
+		return 0, 0
+	}
+	return 1 + (width-spanWidth)/xStride, 1 + (height-spanHeight)/yStride
+}
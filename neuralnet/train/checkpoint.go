@@ -0,0 +1,351 @@
+package train
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/sgd"
+)
+
+// A Checkpoint bundles everything needed to resume a
+// Trainer exactly where it left off.
+//
+// Checkpoints are encoded as JSON.
+// Infinite and NaN validation costs are encoded as
+// strings, since JSON numbers cannot represent them.
+type Checkpoint struct {
+	// Model is the model, serialized with
+	// serializer.SerializeWithType.
+	Model []byte
+
+	// Optimizer is the state of the Optimizer, if any.
+	Optimizer *OptimizerState
+
+	// Rand is the state of the RandSource, if any.
+	Rand *RandSource
+
+	// NoiseStep is the Step of the GradientNoise, if any.
+	NoiseStep int
+
+	// Schedule is the JSON-encoded state of the Trainer's
+	// Schedule if it is an ObservingSchedule.
+	Schedule json.RawMessage
+
+	// Status is the progress of the Trainer.
+	Status Status
+}
+
+// LoadCheckpoint reads a Checkpoint from a file.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var res Checkpoint
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DecodeModel deserializes the model in the checkpoint.
+// For instance, if a neuralnet.Network was saved, the
+// result is a neuralnet.Network.
+func (c *Checkpoint) DecodeModel() (serializer.Serializer, error) {
+	return serializer.DeserializeWithType(c.Model)
+}
+
+// A Checkpointer saves checkpoints for a Trainer and
+// resumes Trainers from them.
+//
+// Training is only reproduced exactly if all of the
+// randomness in the training process comes from the
+// Trainer's shuffling and from Rand.
+// For example, a neuralnet.DropoutLayer uses the global
+// functions in math/rand, so a network which uses
+// dropout will not be resumed bit-for-bit.
+type Checkpointer struct {
+	// Path is the file where checkpoints are saved.
+	// Checkpoints are written to a temporary file before
+	// replacing Path, so that a crash never leaves a
+	// partial checkpoint behind.
+	Path string
+
+	// Interval is the number of steps between checkpoints.
+	// If this is 0, a checkpoint is saved at the end of
+	// every epoch.
+	Interval int
+
+	// Model is the model being trained.
+	// It must be an sgd.Learner whose parameters are the
+	// Trainer's Learner's parameters (typically, it is
+	// the same object as the Trainer's Learner).
+	Model serializer.Serializer
+
+	// Optimizer, if non-nil, is the Optimizer used in the
+	// Trainer's Gradienter.
+	Optimizer Optimizer
+
+	// Rand, if non-nil, is a source of randomness used
+	// during training (e.g. by GradientNoise).
+	Rand *RandSource
+
+	// Noise, if non-nil, is a GradientNoise used in the
+	// Trainer's Gradienter.
+	// Its Step is saved so that the noise keeps annealing
+	// after a resume.
+	Noise *GradientNoise
+}
+
+// Checkpoint creates a Checkpoint for the current state
+// of a Trainer.
+func (c *Checkpointer) Checkpoint(t *Trainer) (*Checkpoint, error) {
+	model, err := serializer.SerializeWithType(c.Model)
+	if err != nil {
+		return nil, err
+	}
+	res := &Checkpoint{
+		Model:  model,
+		Status: t.Status,
+	}
+	res.Status.History = append([]Validation{}, t.Status.History...)
+	if c.Optimizer != nil {
+		res.Optimizer = c.Optimizer.State(t.Learner.Parameters())
+	}
+	if c.Rand != nil {
+		randCopy := *c.Rand
+		res.Rand = &randCopy
+	}
+	if c.Noise != nil {
+		res.NoiseStep = c.Noise.Step
+	}
+	if obs, ok := t.Schedule.(ObservingSchedule); ok {
+		res.Schedule, err = json.Marshal(obs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Save writes a Checkpoint for a Trainer to c.Path.
+func (c *Checkpointer) Save(t *Trainer) error {
+	checkpoint, err := c.Checkpoint(t)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(c.Path), filepath.Base(c.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	_, err = tempFile.Write(data)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, c.Path)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+	}
+	return err
+}
+
+// Resume restores the state of a Trainer from the
+// checkpoint at c.Path.
+// The model parameters are copied into the Trainer's
+// Learner, so the Trainer and Checkpointer should be set
+// up exactly as they were when the checkpoint was saved.
+//
+// If there is no checkpoint, Resume returns an error for
+// which os.IsNotExist returns true.
+func (c *Checkpointer) Resume(t *Trainer) error {
+	checkpoint, err := LoadCheckpoint(c.Path)
+	if err != nil {
+		return err
+	}
+	model, err := checkpoint.DecodeModel()
+	if err != nil {
+		return err
+	}
+	learner, ok := model.(sgd.Learner)
+	if !ok {
+		return errors.New("checkpoint model has no parameters")
+	}
+	params := t.Learner.Parameters()
+	savedParams := learner.Parameters()
+	if len(savedParams) != len(params) {
+		return errors.New("checkpoint model does not match learner")
+	}
+	for i, p := range savedParams {
+		if len(p.Vector) != len(params[i].Vector) {
+			return errors.New("checkpoint model does not match learner")
+		}
+	}
+
+	if c.Optimizer != nil {
+		if checkpoint.Optimizer == nil {
+			return errors.New("checkpoint has no optimizer state")
+		}
+		if err := c.Optimizer.SetState(params, checkpoint.Optimizer); err != nil {
+			return err
+		}
+	}
+	if c.Rand != nil {
+		if checkpoint.Rand == nil {
+			return errors.New("checkpoint has no random state")
+		}
+		*c.Rand = *checkpoint.Rand
+	}
+	if c.Noise != nil {
+		c.Noise.Step = checkpoint.NoiseStep
+	}
+	if obs, ok := t.Schedule.(ObservingSchedule); ok && checkpoint.Schedule != nil {
+		if err := json.Unmarshal(checkpoint.Schedule, obs); err != nil {
+			return err
+		}
+	}
+	for i, p := range savedParams {
+		copy(params[i].Vector, p.Vector)
+	}
+	t.Status = checkpoint.Status
+	return nil
+}
+
+// due returns true if a checkpoint should be saved for
+// the given status.
+// It is called after every step and after every epoch.
+func (c *Checkpointer) due(s *Status, endOfEpoch bool) bool {
+	if c.Interval == 0 {
+		return endOfEpoch
+	}
+	return !endOfEpoch && s.Step%c.Interval == 0
+}
+
+// RandSource is a rand.Source whose state can be saved
+// and restored.
+// It implements the SplitMix64 generator, whose entire
+// state is a single integer, so restoring it takes
+// constant time no matter how many values were drawn.
+//
+// A rand.Rand created from a RandSource should not use
+// its Read method, since that buffers random bytes.
+type RandSource struct {
+	State uint64
+}
+
+// NewRandSource creates a RandSource with the given seed.
+func NewRandSource(seed int64) *RandSource {
+	return &RandSource{State: uint64(seed)}
+}
+
+func (r *RandSource) Int63() int64 {
+	return int64(r.Uint64() >> 1)
+}
+
+func (r *RandSource) Uint64() uint64 {
+	r.State += 0x9e3779b97f4a7c15
+	z := r.State
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (r *RandSource) Seed(seed int64) {
+	r.State = uint64(seed)
+}
+
+// jsonFloat is a float64 which is encoded as a JSON
+// string (e.g. "+Inf") if it is infinite or NaN.
+type jsonFloat float64
+
+func (j jsonFloat) MarshalJSON() ([]byte, error) {
+	f := float64(j)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return json.Marshal(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return json.Marshal(f)
+}
+
+func (j *jsonFloat) UnmarshalJSON(d []byte) error {
+	var str string
+	if err := json.Unmarshal(d, &str); err == nil {
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return err
+		}
+		*j = jsonFloat(f)
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(d, &f); err != nil {
+		return err
+	}
+	*j = jsonFloat(f)
+	return nil
+}
+
+// MarshalJSON encodes the Validation, allowing for
+// infinite or NaN costs.
+func (v Validation) MarshalJSON() ([]byte, error) {
+	type plain Validation
+	return json.Marshal(struct {
+		plain
+		Cost jsonFloat
+	}{plain(v), jsonFloat(v.Cost)})
+}
+
+// UnmarshalJSON decodes a Validation which was encoded
+// with MarshalJSON.
+func (v *Validation) UnmarshalJSON(d []byte) error {
+	type plain Validation
+	aux := struct {
+		*plain
+		Cost jsonFloat
+	}{(*plain)(v), jsonFloat(v.Cost)}
+	if err := json.Unmarshal(d, &aux); err != nil {
+		return err
+	}
+	v.Cost = float64(aux.Cost)
+	return nil
+}
+
+// MarshalJSON encodes the ReduceOnPlateau, allowing for
+// an infinite or NaN Best cost.
+func (r ReduceOnPlateau) MarshalJSON() ([]byte, error) {
+	type plain ReduceOnPlateau
+	return json.Marshal(struct {
+		plain
+		Best jsonFloat
+	}{plain(r), jsonFloat(r.Best)})
+}
+
+// UnmarshalJSON decodes a ReduceOnPlateau which was
+// encoded with MarshalJSON.
+func (r *ReduceOnPlateau) UnmarshalJSON(d []byte) error {
+	type plain ReduceOnPlateau
+	aux := struct {
+		*plain
+		Best jsonFloat
+	}{(*plain)(r), jsonFloat(r.Best)}
+	if err := json.Unmarshal(d, &aux); err != nil {
+		return err
+	}
+	r.Best = float64(aux.Best)
+	return nil
+}
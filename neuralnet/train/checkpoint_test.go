@@ -0,0 +1,168 @@
+package train
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/sgd"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	expected := checkpointTestTrainer(filepath.Join(dir, "expected"))
+	expected.Epochs = 3
+	if err := expected.Train(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "actual")
+	interrupted := checkpointTestTrainer(path)
+	interrupted.Epochs = 3
+	interrupted.StepFunc = func(s *Status) bool {
+		return s.Step < 8
+	}
+	if err := interrupted.Train(); err != nil {
+		t.Fatal(err)
+	}
+
+	actual := checkpointTestTrainer(path)
+	for _, param := range actual.Learner.Parameters() {
+		param.Vector.Scale(0)
+	}
+	if err := actual.Checkpointer.Resume(actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual.Status.Step != 6 {
+		t.Fatalf("expected checkpoint at step 6 but got %d", actual.Status.Step)
+	}
+	plateau := actual.Schedule.(*Warmup).Schedule.(*ReduceOnPlateau)
+	if plateau.Observations != 1 {
+		t.Fatalf("expected 1 restored observation but got %d", plateau.Observations)
+	}
+	actual.Epochs = 3
+	if err := actual.Train(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(actual.Status.History) != len(expected.Status.History) {
+		t.Fatalf("expected %d validations but got %d", len(expected.Status.History),
+			len(actual.Status.History))
+	}
+	for i, v := range expected.Status.History {
+		if actual.Status.History[i] != v {
+			t.Errorf("validation %d: expected %v but got %v", i, v, actual.Status.History[i])
+		}
+	}
+	expParams := expected.Learner.Parameters()
+	for i, param := range actual.Learner.Parameters() {
+		for j, x := range param.Vector {
+			if x != expParams[i].Vector[j] {
+				t.Fatalf("parameter %d,%d should be %f but got %f", i, j,
+					expParams[i].Vector[j], x)
+			}
+		}
+	}
+
+	listing, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != 2 {
+		t.Errorf("expected 2 files but got %d", len(listing))
+	}
+}
+
+func TestCheckpointInfiniteCost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint")
+	trainer := checkpointTestTrainer(path)
+	trainer.Epochs = 2
+	trainer.Cost = func(s sgd.SampleSet) float64 {
+		return math.Inf(1)
+	}
+	if err := trainer.Train(); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := checkpointTestTrainer(path)
+	if err := resumed.Checkpointer.Resume(resumed); err != nil {
+		t.Fatal(err)
+	}
+	history := resumed.Status.History
+	if len(history) != 1 || !math.IsInf(history[0].Cost, 1) {
+		t.Errorf("unexpected history %v", history)
+	}
+	plateau := resumed.Schedule.(*Warmup).Schedule.(*ReduceOnPlateau)
+	if plateau.Observations != 1 || !math.IsInf(plateau.Best, 1) {
+		t.Errorf("unexpected plateau state %+v", plateau)
+	}
+}
+
+func TestRandSource(t *testing.T) {
+	source := NewRandSource(1337)
+	gen := rand.New(source)
+	for i := 0; i < 10; i++ {
+		gen.NormFloat64()
+	}
+	data, err := json.Marshal(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored RandSource
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	restoredGen := rand.New(&restored)
+	for i := 0; i < 10; i++ {
+		if x, y := gen.NormFloat64(), restoredGen.NormFloat64(); x != y {
+			t.Fatalf("value %d: expected %f but got %f", i, x, y)
+		}
+	}
+}
+
+// checkpointTestTrainer creates a Trainer which uses Adam,
+// gradient noise, and a warmed up ReduceOnPlateau, and
+// saves a checkpoint every 3 steps.
+func checkpointTestTrainer(path string) *Trainer {
+	rand.Seed(1337)
+	trainer := testTrainer(0.01)
+	source := NewRandSource(42)
+	noise := &GradientNoise{
+		Gradienter: trainer.Gradienter,
+		Variance:   0.01,
+		Decay:      0.55,
+		Rand:       rand.New(source),
+		Learner:    trainer.Learner,
+	}
+	adam := &Adam{Gradienter: noise}
+	trainer.Gradienter = adam
+	trainer.Schedule = &Warmup{
+		Schedule: &ReduceOnPlateau{Initial: 0.01, Factor: 0.5, Patience: 1},
+		Steps:    2,
+	}
+	trainer.Checkpointer = &Checkpointer{
+		Path:      path,
+		Interval:  3,
+		Model:     trainer.Learner.(serializer.Serializer),
+		Optimizer: adam,
+		Rand:      source,
+		Noise:     noise,
+	}
+	return trainer
+}
@@ -0,0 +1,224 @@
+package train
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+// ClipMode determines how a Clipper clips gradients.
+type ClipMode int
+
+const (
+	// ClipGlobalNorm scales the entire gradient so that
+	// its norm (across all variables) is at most the
+	// threshold.
+	ClipGlobalNorm ClipMode = iota
+
+	// ClipVarNorm separately scales the gradient of each
+	// variable so that its norm is at most the threshold.
+	ClipVarNorm
+
+	// ClipValue clamps each gradient component to the
+	// range [-threshold, threshold].
+	ClipValue
+)
+
+// ClipStats describes the effect of a Clipper on a
+// gradient.
+type ClipStats struct {
+	// NormBefore and NormAfter are the global norms of
+	// the gradient before and after clipping.
+	NormBefore float64
+	NormAfter  float64
+
+	// Clipped is true if any part of the gradient was
+	// changed by clipping.
+	Clipped bool
+}
+
+// A Clipper wraps a Gradienter and clips the gradients
+// it produces to prevent gradient explosion.
+//
+// A Clipper can also be used with R-operator methods if
+// its Gradienter is an sgd.RGradienter.
+// In this case, the r-gradient is the exact directional
+// derivative of the clipped gradient.
+// Variables which are missing from the r-gradient are
+// treated as if their r-gradients were 0.
+// Since clipping the global norm may still give such a
+// variable a non-zero r-gradient, an r-gradient entry is
+// added for it in that case.
+type Clipper struct {
+	Gradienter sgd.Gradienter
+	Mode       ClipMode
+
+	// Threshold is the maximum norm or component size.
+	// It must be positive.
+	Threshold float64
+
+	// StatsFunc, if non-nil, is called with the statistics
+	// of every gradient after it is clipped.
+	StatsFunc func(s ClipStats)
+}
+
+func (c *Clipper) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	g := c.Gradienter.Gradient(s)
+	c.clip(g, nil)
+	return g
+}
+
+// RGradient computes and clips the gradient and
+// r-gradient.
+// It panics if the Gradienter is not an sgd.RGradienter.
+func (c *Clipper) RGradient(v autofunc.RVector,
+	s sgd.SampleSet) (autofunc.Gradient, autofunc.RGradient) {
+	g, rg := c.Gradienter.(sgd.RGradienter).RGradient(v, s)
+	c.clip(g, rg)
+	return g, rg
+}
+
+func (c *Clipper) clip(g autofunc.Gradient, rg autofunc.RGradient) {
+	if c.Threshold <= 0 {
+		panic("threshold must be positive")
+	}
+	stats := ClipStats{NormBefore: gradientNorm(g)}
+	switch c.Mode {
+	case ClipGlobalNorm:
+		if stats.NormBefore > c.Threshold {
+			stats.Clipped = true
+			var vecs, rVecs []linalg.Vector
+			for variable, vec := range g {
+				vecs = append(vecs, vec)
+				if rg != nil {
+					rVec, ok := rg[variable]
+					if !ok {
+						rVec = make(linalg.Vector, len(vec))
+						rg[variable] = rVec
+					}
+					rVecs = append(rVecs, rVec)
+				}
+			}
+			clipNorm(vecs, rVecs, stats.NormBefore, c.Threshold)
+		}
+	case ClipVarNorm:
+		for variable, vec := range g {
+			if norm := vec.Mag(); norm > c.Threshold {
+				stats.Clipped = true
+				var rVecs []linalg.Vector
+				if rVec, ok := rg[variable]; ok {
+					rVecs = []linalg.Vector{rVec}
+				}
+				clipNorm([]linalg.Vector{vec}, rVecs, norm, c.Threshold)
+			}
+		}
+	case ClipValue:
+		for variable, vec := range g {
+			for i, x := range vec {
+				if math.Abs(x) > c.Threshold {
+					stats.Clipped = true
+					vec[i] = math.Copysign(c.Threshold, x)
+					if rVec, ok := rg[variable]; ok {
+						rVec[i] = 0
+					}
+				}
+			}
+		}
+	default:
+		panic("unknown clip mode")
+	}
+	if c.StatsFunc != nil {
+		stats.NormAfter = gradientNorm(g)
+		c.StatsFunc(stats)
+	}
+}
+
+// clipNorm scales a list of vectors with the given norm
+// so that their norm becomes threshold.
+// If rVecs is non-nil, its entries are replaced with the
+// derivatives of the scaled vectors.
+func clipNorm(vecs, rVecs []linalg.Vector, norm, threshold float64) {
+	scale := threshold / norm
+	if rVecs != nil {
+		// The derivative of g*t/|g| is
+		// (t/|g|)*(R(g) - g*(g.R(g))/|g|^2).
+		var dot float64
+		for i, vec := range vecs {
+			dot += vec.Dot(rVecs[i])
+		}
+		for i, vec := range vecs {
+			rVecs[i].Add(vec.Copy().Scale(-dot / (norm * norm))).Scale(scale)
+		}
+	}
+	for _, vec := range vecs {
+		vec.Scale(scale)
+	}
+}
+
+func gradientNorm(g autofunc.Gradient) float64 {
+	var sum float64
+	for _, vec := range g {
+		sum += vec.Dot(vec)
+	}
+	return math.Sqrt(sum)
+}
+
+// GradientNoise wraps a Gradienter and adds annealed
+// Gaussian noise to its gradients, which can help train
+// very deep or recurrent networks.
+//
+// The noise at step t has variance
+//
+//	Variance / (1 + t)^Decay
+//
+// where t starts at 0.
+type GradientNoise struct {
+	Gradienter sgd.Gradienter
+	Variance   float64
+	Decay      float64
+
+	// Step is the number of gradients computed so far.
+	Step int
+
+	// Rand, if non-nil, is used to generate the noise.
+	// Otherwise, the global functions in math/rand are
+	// used.
+	Rand *rand.Rand
+
+	// Learner, if non-nil, determines the order in which
+	// noise is generated for the variables.
+	// Without a Learner, the order is random, so the noise
+	// is not reproducible even when Rand is seeded.
+	Learner sgd.Learner
+}
+
+func (g *GradientNoise) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	grad := g.Gradienter.Gradient(s)
+	stddev := math.Sqrt(g.Variance / math.Pow(1+float64(g.Step), g.Decay))
+	g.Step++
+	if g.Learner != nil {
+		for _, v := range g.Learner.Parameters() {
+			if vec, ok := grad[v]; ok {
+				g.addNoise(vec, stddev)
+			}
+		}
+	} else {
+		for _, vec := range grad {
+			g.addNoise(vec, stddev)
+		}
+	}
+	return grad
+}
+
+func (g *GradientNoise) addNoise(vec linalg.Vector, stddev float64) {
+	for i := range vec {
+		if g.Rand != nil {
+			vec[i] += g.Rand.NormFloat64() * stddev
+		} else {
+			vec[i] += rand.NormFloat64() * stddev
+		}
+	}
+}
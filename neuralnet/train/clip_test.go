@@ -0,0 +1,219 @@
+package train
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+func TestClipperGlobalNorm(t *testing.T) {
+	g := newQuadraticGradienter()
+	expected := g.Gradient(nil)
+	var stats ClipStats
+	c := &Clipper{
+		Gradienter: g,
+		Mode:       ClipGlobalNorm,
+		Threshold:  gradientNorm(expected) / 2,
+		StatsFunc:  func(s ClipStats) { stats = s },
+	}
+	actual := c.Gradient(nil)
+	if !stats.Clipped {
+		t.Error("gradient should have been clipped")
+	}
+	if math.Abs(stats.NormBefore-2*c.Threshold) > 1e-8 {
+		t.Errorf("expected norm %f before but got %f", 2*c.Threshold, stats.NormBefore)
+	}
+	if math.Abs(stats.NormAfter-c.Threshold) > 1e-8 {
+		t.Errorf("expected norm %f after but got %f", c.Threshold, stats.NormAfter)
+	}
+	for v, vec := range expected {
+		for i, x := range vec {
+			if math.Abs(actual[v][i]-x/2) > 1e-8 {
+				t.Errorf("expected %f but got %f", x/2, actual[v][i])
+			}
+		}
+	}
+
+	c.Threshold = stats.NormBefore * 2
+	c.Gradient(nil)
+	if stats.Clipped || stats.NormBefore != stats.NormAfter {
+		t.Errorf("gradient should not be clipped: %+v", stats)
+	}
+}
+
+func TestClipperVarNorm(t *testing.T) {
+	g := newQuadraticGradienter()
+	c := &Clipper{Gradienter: g, Mode: ClipVarNorm, Threshold: 0.5}
+	for _, vec := range c.Gradient(nil) {
+		if math.Abs(vec.Mag()-0.5) > 1e-8 {
+			t.Errorf("expected norm 0.5 but got %f", vec.Mag())
+		}
+	}
+}
+
+func TestClipperValue(t *testing.T) {
+	g := newQuadraticGradienter()
+	expected := g.Gradient(nil)
+	c := &Clipper{Gradienter: g, Mode: ClipValue, Threshold: 1}
+	for v, vec := range c.Gradient(nil) {
+		for i, x := range vec {
+			exp := math.Max(-1, math.Min(1, expected[v][i]))
+			if x != exp {
+				t.Errorf("expected %f but got %f", exp, x)
+			}
+		}
+	}
+}
+
+func TestClipperRGradient(t *testing.T) {
+	for _, mode := range []ClipMode{ClipGlobalNorm, ClipVarNorm, ClipValue} {
+		g := newQuadraticGradienter()
+		c := &Clipper{Gradienter: g, Mode: mode, Threshold: 1}
+		rv := autofunc.RVector{}
+		for _, v := range g.Vars {
+			rv[v] = make(linalg.Vector, len(v.Vector))
+			for i := range rv[v] {
+				rv[v][i] = rand.NormFloat64()
+			}
+		}
+		_, rg := c.RGradient(rv, nil)
+		checkClipperRGradient(t, c, g.Vars, rv, rg)
+	}
+}
+
+func TestClipperMissingRGradient(t *testing.T) {
+	for _, mode := range []ClipMode{ClipGlobalNorm, ClipVarNorm, ClipValue} {
+		g := &partialRGradienter{newQuadraticGradienter()}
+		c := &Clipper{Gradienter: g, Mode: mode, Threshold: 0.1}
+
+		// The omitted variable does not change in the
+		// direction rv, so its r-gradient is really 0
+		// before clipping.
+		rv := autofunc.RVector{g.Vars[0]: make(linalg.Vector, len(g.Vars[0].Vector))}
+		for _, v := range g.Vars[1:] {
+			rv[v] = make(linalg.Vector, len(v.Vector))
+			for i := range rv[v] {
+				rv[v][i] = rand.NormFloat64()
+			}
+		}
+		grad, rgrad := c.RGradient(rv, nil)
+		if len(grad) != len(g.Vars) {
+			t.Errorf("mode %d: unexpected gradient size %d", mode, len(grad))
+		}
+		if _, ok := rgrad[g.Vars[0]]; ok != (mode == ClipGlobalNorm) {
+			t.Errorf("mode %d: unexpected r-gradient entry presence %v", mode, ok)
+		}
+		checkClipperRGradient(t, c, g.Vars, rv, rgrad)
+	}
+}
+
+func TestClipperThreshold(t *testing.T) {
+	for _, threshold := range []float64{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("threshold %f: expected panic", threshold)
+				}
+			}()
+			c := &Clipper{Gradienter: newQuadraticGradienter(), Threshold: threshold}
+			c.Gradient(nil)
+		}()
+	}
+}
+
+// checkClipperRGradient compares an r-gradient from a
+// Clipper to finite differences of its gradients.
+// Missing r-gradient entries are treated as 0.
+func checkClipperRGradient(t *testing.T, c *Clipper, vars []*autofunc.Variable,
+	rv autofunc.RVector, rg autofunc.RGradient) {
+	const delta = 1e-5
+	for _, v := range vars {
+		v.Vector.Add(rv[v].Copy().Scale(delta))
+	}
+	plus := copyGrad(c.Gradient(nil))
+	for _, v := range vars {
+		v.Vector.Add(rv[v].Copy().Scale(-2 * delta))
+	}
+	minus := copyGrad(c.Gradient(nil))
+	for _, v := range vars {
+		v.Vector.Add(rv[v].Copy().Scale(delta))
+	}
+
+	for _, v := range vars {
+		for i := range v.Vector {
+			var actual float64
+			if rVec, ok := rg[v]; ok {
+				actual = rVec[i]
+			}
+			expected := (plus[v][i] - minus[v][i]) / (2 * delta)
+			if math.Abs(actual-expected) > 1e-4 {
+				t.Errorf("mode %d: expected %f but got %f", c.Mode, expected, actual)
+			}
+		}
+	}
+}
+
+func TestGradientNoise(t *testing.T) {
+	g1 := newQuadraticGradienter()
+	g2 := &quadraticGradienter{}
+	for _, v := range g1.Vars {
+		g2.Vars = append(g2.Vars, &autofunc.Variable{Vector: v.Vector.Copy()})
+	}
+	n1 := &GradientNoise{
+		Gradienter: g1,
+		Variance:   0.1,
+		Decay:      0.55,
+		Rand:       rand.New(rand.NewSource(1)),
+		Learner:    g1,
+	}
+	n2 := &GradientNoise{
+		Gradienter: g2,
+		Variance:   0.1,
+		Decay:      0.55,
+		Rand:       rand.New(rand.NewSource(1)),
+		Learner:    g2,
+	}
+	clean := g1.Gradient(nil)
+	noisy1 := n1.Gradient(nil)
+	noisy2 := n2.Gradient(nil)
+	var diff float64
+	for i, v := range g1.Vars {
+		for j, x := range noisy1[v] {
+			if noisy2[g2.Vars[i]][j] != x {
+				t.Fatal("noise should be reproducible")
+			}
+			diff += math.Abs(x - clean[v][j])
+		}
+	}
+	if diff == 0 {
+		t.Error("no noise was added")
+	}
+	if n1.Step != 1 {
+		t.Errorf("expected step 1 but got %d", n1.Step)
+	}
+}
+
+// partialRGradienter omits the first variable from its
+// r-gradients.
+type partialRGradienter struct {
+	*quadraticGradienter
+}
+
+func (p *partialRGradienter) RGradient(v autofunc.RVector,
+	s sgd.SampleSet) (autofunc.Gradient, autofunc.RGradient) {
+	g, rg := p.quadraticGradienter.RGradient(v, s)
+	delete(rg, p.Vars[0])
+	return g, rg
+}
+
+func copyGrad(g autofunc.Gradient) autofunc.Gradient {
+	res := autofunc.Gradient{}
+	for k, v := range g {
+		res[k] = v.Copy()
+	}
+	return res
+}
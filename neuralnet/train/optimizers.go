@@ -0,0 +1,364 @@
+package train
+
+import (
+	"errors"
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+const (
+	defaultAdamDecayRate1 = 0.9
+	defaultAdamDecayRate2 = 0.999
+	defaultRMSResiliency  = 0.9
+	defaultDamping        = 1e-8
+)
+
+// An Optimizer is an sgd.Gradienter which transforms the
+// gradients from another sgd.Gradienter, typically using
+// some state which it keeps for each variable.
+// The transformed gradients should be scaled by a step
+// size and added to the variables, just like regular
+// gradients.
+//
+// The state of an Optimizer can be saved and restored,
+// making it possible to resume training exactly.
+type Optimizer interface {
+	sgd.Gradienter
+
+	// State exports the current state of the Optimizer
+	// for the given variables.
+	State(vars []*autofunc.Variable) *OptimizerState
+
+	// SetState restores a state which was exported with
+	// State, using the same variables in the same order.
+	SetState(vars []*autofunc.Variable, s *OptimizerState) error
+}
+
+// OptimizerState is an exported version of an Optimizer's
+// internal state.
+// It can be encoded with encoding/json.
+type OptimizerState struct {
+	// Step is the number of gradients that the Optimizer
+	// has computed.
+	Step int
+
+	// Vectors contains a list of vectors for each variable.
+	// The list is nil if the Optimizer has no state for
+	// the corresponding variable.
+	Vectors [][]linalg.Vector
+}
+
+// Adam implements the Adam optimizer, which scales each
+// gradient component using running averages of the
+// gradient and of its square.
+type Adam struct {
+	Gradienter sgd.Gradienter
+
+	// DecayRate1 is the decay rate for the first moment.
+	// If this is 0, 0.9 is used.
+	DecayRate1 float64
+
+	// DecayRate2 is the decay rate for the second moment.
+	// If this is 0, 0.999 is used.
+	DecayRate2 float64
+
+	// Damping is added to the denominator of every update
+	// for numerical stability.
+	// If this is 0, 1e-8 is used.
+	Damping float64
+
+	step   int
+	params paramState
+}
+
+func (a *Adam) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	g := a.Gradienter.Gradient(s)
+	a.step++
+	decay1 := valueOrDefault(a.DecayRate1, defaultAdamDecayRate1)
+	decay2 := valueOrDefault(a.DecayRate2, defaultAdamDecayRate2)
+	damping := valueOrDefault(a.Damping, defaultDamping)
+	correction1 := 1 - math.Pow(decay1, float64(a.step))
+	correction2 := 1 - math.Pow(decay2, float64(a.step))
+	for v, x := range g {
+		vecs, _ := a.params.get(v, 2, len(x))
+		moment1, moment2 := vecs[0], vecs[1]
+		for i, y := range x {
+			moment1[i] = decay1*moment1[i] + (1-decay1)*y
+			moment2[i] = decay2*moment2[i] + (1-decay2)*y*y
+			x[i] = (moment1[i] / correction1) /
+				(math.Sqrt(moment2[i]/correction2) + damping)
+		}
+	}
+	return g
+}
+
+func (a *Adam) State(vars []*autofunc.Variable) *OptimizerState {
+	return &OptimizerState{Step: a.step, Vectors: a.params.export(vars)}
+}
+
+func (a *Adam) SetState(vars []*autofunc.Variable, s *OptimizerState) error {
+	if err := a.params.load(vars, s.Vectors, 2); err != nil {
+		return err
+	}
+	a.step = s.Step
+	return nil
+}
+
+// RMSProp implements the RMSProp optimizer, which
+// divides each gradient component by a running average
+// of its magnitude.
+type RMSProp struct {
+	Gradienter sgd.Gradienter
+
+	// Resiliency is the decay rate of the running average.
+	// If this is 0, 0.9 is used.
+	Resiliency float64
+
+	// Damping is added to the denominator of every update
+	// for numerical stability.
+	// If this is 0, 1e-8 is used.
+	Damping float64
+
+	step   int
+	params paramState
+}
+
+func (r *RMSProp) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	g := r.Gradienter.Gradient(s)
+	r.step++
+	resiliency := valueOrDefault(r.Resiliency, defaultRMSResiliency)
+	damping := valueOrDefault(r.Damping, defaultDamping)
+	for v, x := range g {
+		vecs, isNew := r.params.get(v, 1, len(x))
+		rolling := vecs[0]
+		for i, y := range x {
+			if isNew {
+				rolling[i] = y * y
+			} else {
+				rolling[i] = resiliency*rolling[i] + (1-resiliency)*y*y
+			}
+			x[i] = y / (math.Sqrt(rolling[i]) + damping)
+		}
+	}
+	return g
+}
+
+func (r *RMSProp) State(vars []*autofunc.Variable) *OptimizerState {
+	return &OptimizerState{Step: r.step, Vectors: r.params.export(vars)}
+}
+
+func (r *RMSProp) SetState(vars []*autofunc.Variable, s *OptimizerState) error {
+	if err := r.params.load(vars, s.Vectors, 1); err != nil {
+		return err
+	}
+	r.step = s.Step
+	return nil
+}
+
+// AdaGrad implements the AdaGrad optimizer, which
+// divides each gradient component by the square root of
+// the sum of its squares over all previous steps.
+type AdaGrad struct {
+	Gradienter sgd.Gradienter
+
+	// Damping is added to the denominator of every update
+	// for numerical stability.
+	// If this is 0, 1e-8 is used.
+	Damping float64
+
+	step   int
+	params paramState
+}
+
+func (a *AdaGrad) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	g := a.Gradienter.Gradient(s)
+	a.step++
+	damping := valueOrDefault(a.Damping, defaultDamping)
+	for v, x := range g {
+		vecs, _ := a.params.get(v, 1, len(x))
+		sumSquares := vecs[0]
+		for i, y := range x {
+			sumSquares[i] += y * y
+			x[i] = y / (math.Sqrt(sumSquares[i]) + damping)
+		}
+	}
+	return g
+}
+
+func (a *AdaGrad) State(vars []*autofunc.Variable) *OptimizerState {
+	return &OptimizerState{Step: a.step, Vectors: a.params.export(vars)}
+}
+
+func (a *AdaGrad) SetState(vars []*autofunc.Variable, s *OptimizerState) error {
+	if err := a.params.load(vars, s.Vectors, 1); err != nil {
+		return err
+	}
+	a.step = s.Step
+	return nil
+}
+
+// Nesterov implements Nesterov momentum.
+//
+// Each step, the velocity of a variable is scaled by
+// Momentum and then incremented by the gradient.
+// The resulting update is the gradient plus the scaled
+// velocity, which looks ahead to where the momentum
+// will carry the variable.
+type Nesterov struct {
+	Gradienter sgd.Gradienter
+	Momentum   float64
+
+	step   int
+	params paramState
+}
+
+func (n *Nesterov) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	g := n.Gradienter.Gradient(s)
+	n.step++
+	for v, x := range g {
+		vecs, _ := n.params.get(v, 1, len(x))
+		velocity := vecs[0]
+		for i, y := range x {
+			velocity[i] = n.Momentum*velocity[i] + y
+			x[i] = y + n.Momentum*velocity[i]
+		}
+	}
+	return g
+}
+
+func (n *Nesterov) State(vars []*autofunc.Variable) *OptimizerState {
+	return &OptimizerState{Step: n.step, Vectors: n.params.export(vars)}
+}
+
+func (n *Nesterov) SetState(vars []*autofunc.Variable, s *OptimizerState) error {
+	if err := n.params.load(vars, s.Vectors, 1); err != nil {
+		return err
+	}
+	n.step = s.Step
+	return nil
+}
+
+// WeightDecay adds a multiple of each variable to its
+// gradient, causing the variables to decay towards zero.
+//
+// When WeightDecay wraps another Optimizer, the decay is
+// added after the Optimizer's transformation, so that it
+// is decoupled from any adaptive scaling (as in AdamW).
+type WeightDecay struct {
+	Gradienter sgd.Gradienter
+	Rate       float64
+
+	// Vars, if non-nil, lists the only variables which
+	// should be decayed.
+	// This can be used to exclude biases from the decay.
+	Vars []*autofunc.Variable
+}
+
+func (w *WeightDecay) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	g := w.Gradienter.Gradient(s)
+	if w.Vars == nil {
+		for v, x := range g {
+			x.Add(v.Vector.Copy().Scale(w.Rate))
+		}
+	} else {
+		for _, v := range w.Vars {
+			if x, ok := g[v]; ok {
+				x.Add(v.Vector.Copy().Scale(w.Rate))
+			}
+		}
+	}
+	return g
+}
+
+// State returns the state of the wrapped Gradienter if it
+// is an Optimizer, since WeightDecay itself has no state.
+func (w *WeightDecay) State(vars []*autofunc.Variable) *OptimizerState {
+	if o, ok := w.Gradienter.(Optimizer); ok {
+		return o.State(vars)
+	}
+	return &OptimizerState{}
+}
+
+// SetState sets the state of the wrapped Gradienter if it
+// is an Optimizer.
+func (w *WeightDecay) SetState(vars []*autofunc.Variable, s *OptimizerState) error {
+	if o, ok := w.Gradienter.(Optimizer); ok {
+		return o.SetState(vars, s)
+	}
+	return nil
+}
+
+// paramState stores a fixed number of vectors for each
+// variable.
+type paramState struct {
+	vecs map[*autofunc.Variable][]linalg.Vector
+}
+
+// get returns the vectors for a variable, creating zero
+// vectors if the variable has no state yet.
+// The second return value indicates if the vectors were
+// just created.
+func (p *paramState) get(v *autofunc.Variable, count, size int) ([]linalg.Vector, bool) {
+	if p.vecs == nil {
+		p.vecs = map[*autofunc.Variable][]linalg.Vector{}
+	}
+	if res, ok := p.vecs[v]; ok {
+		return res, false
+	}
+	res := make([]linalg.Vector, count)
+	for i := range res {
+		res[i] = make(linalg.Vector, size)
+	}
+	p.vecs[v] = res
+	return res, true
+}
+
+func (p *paramState) export(vars []*autofunc.Variable) [][]linalg.Vector {
+	res := make([][]linalg.Vector, len(vars))
+	for i, v := range vars {
+		vecs, ok := p.vecs[v]
+		if !ok {
+			continue
+		}
+		res[i] = make([]linalg.Vector, len(vecs))
+		for j, vec := range vecs {
+			res[i][j] = vec.Copy()
+		}
+	}
+	return res
+}
+
+func (p *paramState) load(vars []*autofunc.Variable, data [][]linalg.Vector,
+	count int) error {
+	if len(data) != len(vars) {
+		return errors.New("state does not match variable count")
+	}
+	newVecs := map[*autofunc.Variable][]linalg.Vector{}
+	for i, v := range vars {
+		if data[i] == nil {
+			continue
+		} else if len(data[i]) != count {
+			return errors.New("state has wrong number of vectors")
+		}
+		vecs := make([]linalg.Vector, len(data[i]))
+		for j, vec := range data[i] {
+			if len(vec) != len(v.Vector) {
+				return errors.New("state does not match variable size")
+			}
+			vecs[j] = vec.Copy()
+		}
+		newVecs[v] = vecs
+	}
+	p.vecs = newVecs
+	return nil
+}
+
+func valueOrDefault(value, def float64) float64 {
+	if value == 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,158 @@
+package train
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+func TestOptimizerFirstStep(t *testing.T) {
+	// Every adaptive optimizer should take steps of size 1
+	// in the direction of the gradient on the first step.
+	for _, opt := range []func(g sgd.Gradienter) Optimizer{
+		func(g sgd.Gradienter) Optimizer { return &Adam{Gradienter: g} },
+		func(g sgd.Gradienter) Optimizer { return &RMSProp{Gradienter: g} },
+		func(g sgd.Gradienter) Optimizer { return &AdaGrad{Gradienter: g} },
+	} {
+		g := newQuadraticGradienter()
+		grad := opt(g).Gradient(nil)
+		for _, v := range g.Vars {
+			for i, x := range grad[v] {
+				expected := math.Copysign(1, v.Vector[i])
+				if math.Abs(x-expected) > 1e-5 {
+					t.Errorf("%T: expected %f but got %f", opt(g), expected, x)
+				}
+			}
+		}
+	}
+}
+
+func TestNesterov(t *testing.T) {
+	g := newQuadraticGradienter()
+	n := &Nesterov{Gradienter: g, Momentum: 0.5}
+	var velocity linalg.Vector
+	for i := 0; i < 3; i++ {
+		grad := n.Gradient(nil)
+		gradient := g.Vars[0].Vector.Copy().Scale(2)
+		if velocity == nil {
+			velocity = gradient.Copy()
+		} else {
+			velocity.Scale(0.5).Add(gradient)
+		}
+		expected := gradient.Copy().Add(velocity.Copy().Scale(0.5))
+		for j, x := range grad[g.Vars[0]] {
+			if math.Abs(x-expected[j]) > 1e-8 {
+				t.Fatalf("step %d: expected %v but got %v", i, expected, grad[g.Vars[0]])
+			}
+		}
+		grad.AddToVars(-0.1)
+	}
+}
+
+func TestWeightDecay(t *testing.T) {
+	g := newQuadraticGradienter()
+	w := &WeightDecay{Gradienter: g, Rate: 0.5, Vars: g.Vars[:1]}
+	grad := w.Gradient(nil)
+	for i, v := range g.Vars {
+		scale := 2.0
+		if i == 0 {
+			scale = 2.5
+		}
+		for j, x := range grad[v] {
+			if expected := scale * v.Vector[j]; math.Abs(x-expected) > 1e-8 {
+				t.Errorf("var %d: expected %f but got %f", i, expected, x)
+			}
+		}
+	}
+}
+
+func TestOptimizerState(t *testing.T) {
+	for _, opt := range []func(g sgd.Gradienter) Optimizer{
+		func(g sgd.Gradienter) Optimizer { return &Adam{Gradienter: g} },
+		func(g sgd.Gradienter) Optimizer { return &RMSProp{Gradienter: g} },
+		func(g sgd.Gradienter) Optimizer { return &AdaGrad{Gradienter: g} },
+		func(g sgd.Gradienter) Optimizer { return &Nesterov{Gradienter: g, Momentum: 0.9} },
+		func(g sgd.Gradienter) Optimizer {
+			return &WeightDecay{Gradienter: &Adam{Gradienter: g}, Rate: 0.01}
+		},
+	} {
+		g1 := newQuadraticGradienter()
+		o1 := opt(g1)
+		for i := 0; i < 3; i++ {
+			o1.Gradient(nil).AddToVars(-0.01)
+		}
+
+		data, err := json.Marshal(o1.State(g1.Vars))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var state OptimizerState
+		if err := json.Unmarshal(data, &state); err != nil {
+			t.Fatal(err)
+		}
+		g2 := &quadraticGradienter{}
+		for _, v := range g1.Vars {
+			g2.Vars = append(g2.Vars, &autofunc.Variable{Vector: v.Vector.Copy()})
+		}
+		o2 := opt(g2)
+		if err := o2.SetState(g2.Vars, &state); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			o1.Gradient(nil).AddToVars(-0.01)
+			o2.Gradient(nil).AddToVars(-0.01)
+		}
+		for i, v := range g1.Vars {
+			for j, x := range v.Vector {
+				if actual := g2.Vars[i].Vector[j]; actual != x {
+					t.Errorf("%T: expected %f but got %f", o1, x, actual)
+				}
+			}
+		}
+	}
+}
+
+// quadraticGradienter computes the gradient and
+// r-gradient of the sum of the squares of its variables.
+type quadraticGradienter struct {
+	Vars []*autofunc.Variable
+}
+
+func newQuadraticGradienter() *quadraticGradienter {
+	res := &quadraticGradienter{}
+	for _, size := range []int{3, 5} {
+		v := &autofunc.Variable{Vector: make(linalg.Vector, size)}
+		for i := range v.Vector {
+			v.Vector[i] = rand.NormFloat64()
+		}
+		res.Vars = append(res.Vars, v)
+	}
+	return res
+}
+
+func (q *quadraticGradienter) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	res := autofunc.Gradient{}
+	for _, v := range q.Vars {
+		res[v] = v.Vector.Copy().Scale(2)
+	}
+	return res
+}
+
+func (q *quadraticGradienter) RGradient(v autofunc.RVector,
+	s sgd.SampleSet) (autofunc.Gradient, autofunc.RGradient) {
+	rg := autofunc.RGradient{}
+	for _, variable := range q.Vars {
+		rg[variable] = v[variable].Copy().Scale(2)
+	}
+	return q.Gradient(s), rg
+}
+
+func (q *quadraticGradienter) Parameters() []*autofunc.Variable {
+	return q.Vars
+}
@@ -0,0 +1,205 @@
+package train
+
+import (
+	"math"
+
+	"github.com/unixpickle/sgd"
+)
+
+// A Schedule determines the step size to use at each
+// step of training.
+//
+// The StepSize method of a Schedule can be used as the
+// StepSizeFunc of an rbm.Trainer or of an
+// svm.SubgradientSolver.
+type Schedule interface {
+	// StepSize returns the step size for the given step,
+	// where the first step is 0.
+	StepSize(step int) float64
+}
+
+// An ObservingSchedule is a Schedule which adapts to
+// validation costs.
+//
+// A Trainer calls Observe after every validation when
+// its Schedule is an ObservingSchedule, and a Checkpointer
+// saves and restores the Schedule's state as JSON.
+type ObservingSchedule interface {
+	Schedule
+
+	// Observe reports a new validation cost.
+	Observe(cost float64)
+}
+
+// StepDecay is a Schedule which multiplies the step size
+// by a constant factor every Interval steps.
+type StepDecay struct {
+	Initial float64
+	Factor  float64
+
+	// Interval is the number of steps between decays.
+	// If this is 0, the step size decays every step.
+	Interval int
+}
+
+func (s *StepDecay) StepSize(step int) float64 {
+	interval := s.Interval
+	if interval == 0 {
+		interval = 1
+	} else if interval < 0 {
+		panic("interval must not be negative")
+	}
+	return s.Initial * math.Pow(s.Factor, float64(step/interval))
+}
+
+// ExpDecay is a Schedule which multiplies the step size
+// by a constant factor every step.
+type ExpDecay struct {
+	Initial float64
+	Factor  float64
+}
+
+func (e *ExpDecay) StepSize(step int) float64 {
+	return e.Initial * math.Pow(e.Factor, float64(step))
+}
+
+// CosineRestarts is a Schedule which anneals the step
+// size from Max to Min following half of a cosine wave,
+// then restarts at Max.
+//
+// The first annealing period lasts Period steps, and
+// each subsequent period is PeriodScale times as long
+// as the one before it.
+// If PeriodScale is 0, all periods are the same length.
+//
+// Period must be positive, and PeriodScale must be 0 or
+// at least 1.
+type CosineRestarts struct {
+	Max         float64
+	Min         float64
+	Period      int
+	PeriodScale float64
+}
+
+func (c *CosineRestarts) StepSize(step int) float64 {
+	if c.Period <= 0 {
+		panic("period must be positive")
+	} else if c.PeriodScale != 0 && c.PeriodScale < 1 {
+		panic("period scale must be 0 or at least 1")
+	}
+	period := float64(c.Period)
+	t := float64(step)
+	if c.PeriodScale == 0 || c.PeriodScale == 1 {
+		t = math.Mod(t, period)
+	} else {
+		for t >= period {
+			t -= period
+			period *= c.PeriodScale
+		}
+	}
+	return c.Min + (c.Max-c.Min)*(1+math.Cos(math.Pi*t/period))/2
+}
+
+// Warmup is a Schedule which linearly increases the step
+// size for a number of steps before switching to another
+// Schedule.
+//
+// During the warmup, the step size increases towards the
+// first step size of the wrapped Schedule.
+// After the warmup, the wrapped Schedule is used as if
+// training had started when the warmup ended.
+//
+// Validation costs passed to Observe are forwarded to
+// the wrapped Schedule if it is an ObservingSchedule.
+type Warmup struct {
+	Schedule Schedule
+	Steps    int
+}
+
+func (w *Warmup) StepSize(step int) float64 {
+	if step < w.Steps {
+		return w.Schedule.StepSize(0) * float64(step+1) / float64(w.Steps+1)
+	}
+	return w.Schedule.StepSize(step - w.Steps)
+}
+
+// Observe forwards a validation cost to the wrapped
+// Schedule if it is an ObservingSchedule.
+func (w *Warmup) Observe(cost float64) {
+	if obs, ok := w.Schedule.(ObservingSchedule); ok {
+		obs.Observe(cost)
+	}
+}
+
+// ReduceOnPlateau is a Schedule which reduces the step
+// size whenever a validation cost stops improving.
+//
+// Validation costs are reported with Observe.
+// A Trainer does this automatically after every
+// validation when ReduceOnPlateau is its Schedule, or is
+// wrapped by its Schedule (e.g. in a Warmup).
+type ReduceOnPlateau struct {
+	Initial float64
+
+	// Factor is multiplied by the step size every time
+	// it is reduced.
+	Factor float64
+
+	// Patience is the number of observations without an
+	// improvement after which the step size is reduced.
+	Patience int
+
+	// MinStepSize is a lower bound on the step size.
+	MinStepSize float64
+
+	// The remaining fields store the progress of the
+	// schedule so that it can be saved and restored.
+	Observations int
+	Best         float64
+	Stale        int
+	Reductions   int
+}
+
+func (r *ReduceOnPlateau) StepSize(step int) float64 {
+	res := r.Initial * math.Pow(r.Factor, float64(r.Reductions))
+	return math.Max(res, r.MinStepSize)
+}
+
+// Observe reports a new validation cost.
+func (r *ReduceOnPlateau) Observe(cost float64) {
+	r.Observations++
+	if r.Observations == 1 || cost < r.Best {
+		r.Best = cost
+		r.Stale = 0
+		return
+	}
+	r.Stale++
+	if r.Stale >= r.Patience {
+		r.Reductions++
+		r.Stale = 0
+	}
+}
+
+// SGD is like sgd.SGD, except that the step size is
+// determined by a Schedule.
+// If batchSize is 0, a batch size of 1 is used.
+func SGD(g sgd.Gradienter, s sgd.SampleSet, sched Schedule, epochs, batchSize int) {
+	if batchSize == 0 {
+		batchSize = 1
+	} else if batchSize < 0 {
+		panic("batch size must not be negative")
+	}
+	s = s.Copy()
+	var step int
+	for i := 0; i < epochs; i++ {
+		sgd.ShuffleSampleSet(s)
+		for j := 0; j < s.Len(); j += batchSize {
+			end := j + batchSize
+			if end > s.Len() {
+				end = s.Len()
+			}
+			g.Gradient(s.Subset(j, end)).AddToVars(-sched.StepSize(step))
+			step++
+		}
+	}
+}
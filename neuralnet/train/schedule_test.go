@@ -0,0 +1,124 @@
+package train
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSchedules(t *testing.T) {
+	tests := []struct {
+		Schedule Schedule
+		Expected []float64
+	}{
+		{
+			&StepDecay{Initial: 1, Factor: 0.5, Interval: 2},
+			[]float64{1, 1, 0.5, 0.5, 0.25},
+		},
+		{
+			&StepDecay{Initial: 1, Factor: 0.5},
+			[]float64{1, 0.5, 0.25},
+		},
+		{
+			&ExpDecay{Initial: 2, Factor: 0.5},
+			[]float64{2, 1, 0.5, 0.25},
+		},
+		{
+			&CosineRestarts{Max: 1, Min: 0, Period: 2},
+			[]float64{1, 0.5, 1, 0.5},
+		},
+		{
+			&CosineRestarts{Max: 3, Min: 1, Period: 1, PeriodScale: 2},
+			[]float64{3, 3, 2, 3, 2 + math.Cos(math.Pi/4), 2},
+		},
+		{
+			&Warmup{Schedule: &ExpDecay{Initial: 3, Factor: 0.5}, Steps: 2},
+			[]float64{1, 2, 3, 1.5},
+		},
+	}
+	for i, test := range tests {
+		for step, expected := range test.Expected {
+			actual := test.Schedule.StepSize(step)
+			if math.Abs(actual-expected) > 1e-8 {
+				t.Errorf("test %d step %d: expected %f but got %f", i, step,
+					expected, actual)
+			}
+		}
+	}
+}
+
+func TestSchedulePanics(t *testing.T) {
+	schedules := []Schedule{
+		&StepDecay{Initial: 1, Factor: 0.5, Interval: -1},
+		&CosineRestarts{Max: 1, Min: 0},
+		&CosineRestarts{Max: 1, Min: 0, Period: 2, PeriodScale: 0.5},
+	}
+	for i, sched := range schedules {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("schedule %d: expected panic", i)
+				}
+			}()
+			sched.StepSize(10)
+		}()
+	}
+}
+
+func TestReduceOnPlateau(t *testing.T) {
+	r := &ReduceOnPlateau{
+		Initial:     1,
+		Factor:      0.1,
+		Patience:    2,
+		MinStepSize: 0.005,
+	}
+	costs := []float64{5, 4, 4.5, 4, 3, 3.5, 3.5, 3.5, 3.5}
+	expected := []float64{1, 1, 1, 0.1, 0.1, 0.1, 0.01, 0.01, 0.005}
+	for i, cost := range costs {
+		r.Observe(cost)
+		if actual := r.StepSize(0); math.Abs(actual-expected[i]) > 1e-8 {
+			t.Errorf("observation %d: expected %f but got %f", i, expected[i], actual)
+		}
+	}
+}
+
+func TestTrainerSchedule(t *testing.T) {
+	trainer := testTrainer(0)
+	trainer.Epochs = 3
+	trainer.Schedule = &ReduceOnPlateau{Initial: 0.05, Factor: 0.5, Patience: 1}
+	var stepSizes []float64
+	trainer.StepFunc = func(s *Status) bool {
+		stepSizes = append(stepSizes, trainer.Schedule.StepSize(s.Step))
+		return true
+	}
+	initCost := trainer.Cost(trainer.Validation)
+	trainer.Train()
+	if plateau := trainer.Schedule.(*ReduceOnPlateau); plateau.Observations != 3 {
+		t.Errorf("expected 3 observations but got %d", plateau.Observations)
+	}
+	if len(stepSizes) != 15 || stepSizes[0] != 0.05 {
+		t.Errorf("unexpected step sizes: %v", stepSizes)
+	}
+	if final := trainer.Status.History[2].Cost; final >= initCost {
+		t.Errorf("cost went from %f to %f", initCost, final)
+	}
+}
+
+func TestSGDDefaultBatchSize(t *testing.T) {
+	trainer := testTrainer(0)
+	var steps []int
+	sched := scheduleFunc(func(step int) float64 {
+		steps = append(steps, step)
+		return 0.01
+	})
+	SGD(trainer.Gradienter, trainer.Samples, sched, 2, 0)
+	if len(steps) != 2*trainer.Samples.Len() || steps[len(steps)-1] != len(steps)-1 {
+		t.Errorf("unexpected steps %v", steps)
+	}
+}
+
+// scheduleFunc is a Schedule which calls a function.
+type scheduleFunc func(step int) float64
+
+func (s scheduleFunc) StepSize(step int) float64 {
+	return s(step)
+}
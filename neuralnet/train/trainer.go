@@ -0,0 +1,278 @@
+// Package train provides a reusable driver for
+// gradient-based training loops.
+package train
+
+import (
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+// A Trainer runs mini-batch stochastic gradient descent
+// over a set of samples, periodically measuring the cost
+// on a separate validation set.
+//
+// A Trainer can stop early once the validation cost
+// stops improving, optionally restoring the parameters
+// which gave the best validation cost.
+type Trainer struct {
+	Gradienter sgd.Gradienter
+
+	// Learner provides the parameters to save and restore
+	// when RestoreBest is set.
+	Learner sgd.Learner
+
+	Samples    sgd.SampleSet
+	Validation sgd.SampleSet
+
+	// Cost evaluates the total cost of a sample set,
+	// such as with neuralnet.TotalCost or
+	// seqtoseq.TotalCostBlock.
+	// If Cost or Validation is nil, no validation is
+	// performed.
+	Cost func(s sgd.SampleSet) float64
+
+	StepSize float64
+
+	// BatchSize is the number of samples per step.
+	// If this is 0, a batch size of 1 is used.
+	BatchSize int
+
+	// Schedule, if non-nil, determines the step size in
+	// place of StepSize.
+	// If Schedule is an ObservingSchedule, it is notified
+	// of every validation cost.
+	Schedule Schedule
+
+	// Epochs is the number of passes to make over the
+	// samples.
+	// If this is 0, training continues until a callback
+	// or early stopping ends it.
+	Epochs int
+
+	// ValidateInterval is the number of steps between
+	// validations.
+	// If this is 0, validation is performed at the end of
+	// every epoch.
+	ValidateInterval int
+
+	// Patience is the number of consecutive validations
+	// without an improvement after which training stops.
+	// If this is 0, training never stops early.
+	Patience int
+
+	// RestoreBest, if set, causes the Learner's
+	// parameters to be restored to their values at the
+	// best validation once training ends.
+	RestoreBest bool
+
+	// Seed determines the order in which samples are
+	// visited.
+	// Every epoch uses a different permutation derived
+	// from Seed, so that training can be resumed in the
+	// middle of an epoch.
+	Seed int64
+
+	// StepFunc, if non-nil, is called after every step.
+	// If it returns false, training stops.
+	StepFunc func(s *Status) bool
+
+	// ValidationFunc, if non-nil, is called after every
+	// validation.
+	// If it returns false, training stops.
+	ValidationFunc func(s *Status) bool
+
+	// Checkpointer, if non-nil, is used to periodically
+	// save checkpoints during training.
+	Checkpointer *Checkpointer
+
+	// Status is the progress of training so far.
+	// Train picks up where Status leaves off, so a
+	// Trainer can be resumed by restoring its Status.
+	Status Status
+}
+
+// Status describes the progress of a Trainer.
+type Status struct {
+	// Epoch is the number of complete epochs.
+	Epoch int
+
+	// EpochStep is the number of steps taken so far in
+	// the current epoch.
+	EpochStep int
+
+	// Step is the total number of steps taken.
+	Step int
+
+	// History contains every validation so far.
+	History []Validation
+
+	// BestParameters stores the parameters at the best
+	// validation, if RestoreBest is set.
+	BestParameters []linalg.Vector
+}
+
+// Validation is the result of measuring the validation
+// cost at some point during training.
+type Validation struct {
+	Epoch int
+	Step  int
+	Cost  float64
+}
+
+// Best returns the validation with the lowest cost, or
+// nil if there have been no validations.
+func (s *Status) Best() *Validation {
+	var best *Validation
+	for i, v := range s.History {
+		if best == nil || v.Cost < best.Cost {
+			best = &s.History[i]
+		}
+	}
+	return best
+}
+
+// Stale returns the number of validations since the one
+// returned by Best.
+func (s *Status) Stale() int {
+	best := s.Best()
+	if best == nil {
+		return 0
+	}
+	for i := len(s.History) - 1; i >= 0; i-- {
+		if &s.History[i] == best {
+			return len(s.History) - (i + 1)
+		}
+	}
+	return 0
+}
+
+// Train runs the training loop until the desired number
+// of epochs have been completed or until training is
+// stopped by a callback or by early stopping.
+//
+// If there are no samples, Train returns immediately.
+//
+// An error is only returned if a checkpoint could not be
+// saved, in which case training stops.
+func (t *Trainer) Train() error {
+	if t.Samples == nil || t.Samples.Len() == 0 {
+		return nil
+	}
+	if t.RestoreBest {
+		defer t.restoreBest()
+	}
+	status := &t.Status
+	batchSize := t.batchSize()
+	for t.Epochs == 0 || status.Epoch < t.Epochs {
+		samples := t.epochSamples(status.Epoch)
+		for status.EpochStep*batchSize < samples.Len() {
+			start := status.EpochStep * batchSize
+			end := start + batchSize
+			if end > samples.Len() {
+				end = samples.Len()
+			}
+			t.step(samples.Subset(start, end))
+			status.EpochStep++
+			status.Step++
+			if t.StepFunc != nil && !t.StepFunc(status) {
+				return nil
+			}
+			if t.ValidateInterval != 0 && status.Step%t.ValidateInterval == 0 {
+				if !t.validate() {
+					return nil
+				}
+			}
+			if err := t.checkpoint(false); err != nil {
+				return err
+			}
+		}
+		status.Epoch++
+		status.EpochStep = 0
+		if t.ValidateInterval == 0 && !t.validate() {
+			return nil
+		}
+		if err := t.checkpoint(true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Trainer) batchSize() int {
+	if t.BatchSize == 0 {
+		return 1
+	}
+	return t.BatchSize
+}
+
+func (t *Trainer) step(batch sgd.SampleSet) {
+	stepSize := t.StepSize
+	if t.Schedule != nil {
+		stepSize = t.Schedule.StepSize(t.Status.Step)
+	}
+	t.Gradienter.Gradient(batch).AddToVars(-stepSize)
+}
+
+// epochSamples returns the shuffled samples for the
+// given epoch.
+func (t *Trainer) epochSamples(epoch int) sgd.SampleSet {
+	gen := rand.New(rand.NewSource(t.Seed + int64(epoch)))
+	res := t.Samples.Copy()
+	for i := 0; i < res.Len()-1; i++ {
+		j := i + gen.Intn(res.Len()-i)
+		res.Swap(i, j)
+	}
+	return res
+}
+
+// validate measures the validation cost and returns
+// false if training should stop.
+func (t *Trainer) validate() bool {
+	if t.Cost == nil || t.Validation == nil {
+		return true
+	}
+	status := &t.Status
+	cost := t.Cost(t.Validation)
+	status.History = append(status.History, Validation{
+		Epoch: status.Epoch,
+		Step:  status.Step,
+		Cost:  cost,
+	})
+	if obs, ok := t.Schedule.(ObservingSchedule); ok {
+		obs.Observe(cost)
+	}
+	if t.RestoreBest && status.Stale() == 0 {
+		status.BestParameters = copyParameters(t.Learner.Parameters())
+	}
+	if t.ValidationFunc != nil && !t.ValidationFunc(status) {
+		return false
+	}
+	return t.Patience == 0 || status.Stale() < t.Patience
+}
+
+func (t *Trainer) checkpoint(endOfEpoch bool) error {
+	if t.Checkpointer == nil || !t.Checkpointer.due(&t.Status, endOfEpoch) {
+		return nil
+	}
+	return t.Checkpointer.Save(t)
+}
+
+func (t *Trainer) restoreBest() {
+	if t.Status.BestParameters == nil {
+		return
+	}
+	for i, param := range t.Learner.Parameters() {
+		copy(param.Vector, t.Status.BestParameters[i])
+	}
+}
+
+func copyParameters(params []*autofunc.Variable) []linalg.Vector {
+	res := make([]linalg.Vector, len(params))
+	for i, p := range params {
+		res[i] = p.Vector.Copy()
+	}
+	return res
+}
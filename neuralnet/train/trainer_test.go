@@ -0,0 +1,153 @@
+package train
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestTrainerConverges(t *testing.T) {
+	trainer := testTrainer(0.05)
+	trainer.Epochs = 30
+	initCost := trainer.Cost(trainer.Validation)
+	trainer.Train()
+	if len(trainer.Status.History) != 30 {
+		t.Fatalf("expected 30 validations but got %d", len(trainer.Status.History))
+	}
+	if trainer.Status.Step != 30*5 {
+		t.Errorf("expected %d steps but got %d", 30*5, trainer.Status.Step)
+	}
+	finalCost := trainer.Status.History[29].Cost
+	if finalCost > initCost/10 {
+		t.Errorf("cost went from %f to %f", initCost, finalCost)
+	}
+}
+
+func TestTrainerEarlyStopping(t *testing.T) {
+	// A negative step size makes the cost increase, so the
+	// first validation is always the best one.
+	trainer := testTrainer(-0.01)
+	trainer.Patience = 2
+	trainer.RestoreBest = true
+	trainer.ValidateInterval = 3
+
+	var firstParams []linalg.Vector
+	trainer.ValidationFunc = func(s *Status) bool {
+		if len(s.History) == 1 {
+			firstParams = copyParameters(trainer.Learner.Parameters())
+		}
+		return true
+	}
+	trainer.Train()
+
+	if len(trainer.Status.History) != 3 {
+		t.Fatalf("expected 3 validations but got %d", len(trainer.Status.History))
+	}
+	if trainer.Status.Step != 9 {
+		t.Errorf("expected 9 steps but got %d", trainer.Status.Step)
+	}
+	if best := trainer.Status.Best(); best.Step != 3 {
+		t.Errorf("expected best step 3 but got %d", best.Step)
+	}
+	for i, param := range trainer.Learner.Parameters() {
+		for j, x := range param.Vector {
+			if x != firstParams[i][j] {
+				t.Fatalf("parameter %d,%d should be %f but got %f", i, j,
+					firstParams[i][j], x)
+			}
+		}
+	}
+}
+
+func TestTrainerResume(t *testing.T) {
+	rand.Seed(1337)
+	expected := testTrainer(0.05)
+	rand.Seed(1337)
+	actual := testTrainer(0.05)
+
+	expected.Epochs = 2
+	expected.Train()
+
+	actual.Epochs = 2
+	actual.StepFunc = func(s *Status) bool {
+		return s.Step != 7
+	}
+	actual.Train()
+	if actual.Status.Epoch != 1 || actual.Status.EpochStep != 2 {
+		t.Fatalf("unexpected status: %+v", actual.Status)
+	}
+	actual.StepFunc = nil
+	actual.Train()
+
+	if len(actual.Status.History) != len(expected.Status.History) {
+		t.Fatalf("expected %d validations but got %d", len(expected.Status.History),
+			len(actual.Status.History))
+	}
+	expParams := expected.Learner.Parameters()
+	for i, param := range actual.Learner.Parameters() {
+		for j, x := range param.Vector {
+			if x != expParams[i].Vector[j] {
+				t.Fatalf("parameter %d,%d should be %f but got %f", i, j,
+					expParams[i].Vector[j], x)
+			}
+		}
+	}
+}
+
+// testTrainer creates a Trainer for a linear regression
+// problem with 20 samples and a batch size of 4.
+func TestTrainerDefaults(t *testing.T) {
+	trainer := testTrainer(0.05)
+	trainer.BatchSize = 0
+	trainer.Epochs = 2
+	trainer.Train()
+	if trainer.Status.Step != 2*20 {
+		t.Errorf("expected %d steps but got %d", 2*20, trainer.Status.Step)
+	}
+
+	trainer = testTrainer(0.05)
+	trainer.Samples = sgd.SliceSampleSet{}
+	trainer.Train()
+	if trainer.Status.Step != 0 || len(trainer.Status.History) != 0 {
+		t.Errorf("unexpected status: %+v", trainer.Status)
+	}
+}
+
+func testTrainer(stepSize float64) *Trainer {
+	net := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  3,
+			OutputCount: 2,
+		},
+	}
+	net.Randomize()
+
+	genSamples := func(count int) sgd.SampleSet {
+		var ins, outs []linalg.Vector
+		for i := 0; i < count; i++ {
+			in := linalg.Vector{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()}
+			ins = append(ins, in)
+			outs = append(outs, linalg.Vector{in[0] - 2*in[1], in[2] + 1})
+		}
+		return neuralnet.VectorSampleSet(ins, outs)
+	}
+
+	return &Trainer{
+		Gradienter: &neuralnet.BatchRGradienter{
+			Learner:  net.BatchLearner(),
+			CostFunc: neuralnet.MeanSquaredCost{},
+		},
+		Learner:    net,
+		Samples:    genSamples(20),
+		Validation: genSamples(10),
+		Cost: func(s sgd.SampleSet) float64 {
+			return neuralnet.TotalCost(neuralnet.MeanSquaredCost{}, net, s)
+		},
+		StepSize:  stepSize,
+		BatchSize: 4,
+		Seed:      123,
+	}
+}
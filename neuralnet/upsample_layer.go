@@ -0,0 +1,238 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// An UpsampleLayer increases the width and height of an
+// input tensor by integer factors.
+//
+// By default, each input value is repeated to fill an
+// XFactor by YFactor block of the output (nearest-neighbor
+// upsampling).
+// If Bilinear is set, output values are bilinearly
+// interpolated from the nearest input values, treating
+// each input value as the center of its output block.
+type UpsampleLayer struct {
+	XFactor int
+	YFactor int
+
+	Bilinear bool
+
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+}
+
+// DeserializeUpsampleLayer deserializes an UpsampleLayer.
+func DeserializeUpsampleLayer(d []byte) (*UpsampleLayer, error) {
+	var res UpsampleLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// OutputWidth returns the output tensor width.
+func (u *UpsampleLayer) OutputWidth() int {
+	return u.InputWidth * u.XFactor
+}
+
+// OutputHeight returns the output tensor height.
+func (u *UpsampleLayer) OutputHeight() int {
+	return u.InputHeight * u.YFactor
+}
+
+// Apply applies the layer to an input, which is treated
+// as a tensor.
+func (u *UpsampleLayer) Apply(in autofunc.Result) autofunc.Result {
+	return u.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (u *UpsampleLayer) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return u.BatchR(rv, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (u *UpsampleLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	u.checkInput(in.Output(), n)
+	return &upsampleResult{
+		OutputVec: u.forward(in.Output(), n),
+		Input:     in,
+		N:         n,
+		Layer:     u,
+	}
+}
+
+// BatchR is like Batch, but for RResults.
+func (u *UpsampleLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	u.checkInput(in.Output(), n)
+	return &upsampleRResult{
+		OutputVec:  u.forward(in.Output(), n),
+		ROutputVec: u.forward(in.ROutput(), n),
+		Input:      in,
+		N:          n,
+		Layer:      u,
+	}
+}
+
+// Serialize serializes the layer.
+func (u *UpsampleLayer) Serialize() ([]byte, error) {
+	return json.Marshal(u)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (u *UpsampleLayer) SerializerType() string {
+	return serializerTypeUpsampleLayer
+}
+
+func (u *UpsampleLayer) checkInput(in linalg.Vector, n int) {
+	if len(in) != n*u.InputWidth*u.InputHeight*u.InputDepth {
+		panic("invalid input size")
+	}
+}
+
+func (u *UpsampleLayer) forward(in linalg.Vector, n int) linalg.Vector {
+	inSize := u.InputWidth * u.InputHeight * u.InputDepth
+	outSize := u.OutputWidth() * u.OutputHeight() * u.InputDepth
+	res := make(linalg.Vector, outSize*n)
+	for i := 0; i < n; i++ {
+		inTensor := u.inputTensor(in[i*inSize : (i+1)*inSize])
+		outTensor := u.outputTensor(res[i*outSize : (i+1)*outSize])
+		u.forEachWeight(func(outX, outY, inX, inY int, weight float64) {
+			for z := 0; z < u.InputDepth; z++ {
+				old := outTensor.Get(outX, outY, z)
+				outTensor.Set(outX, outY, z, old+weight*inTensor.Get(inX, inY, z))
+			}
+		})
+	}
+	return res
+}
+
+func (u *UpsampleLayer) backward(upstream linalg.Vector, n int) linalg.Vector {
+	inSize := u.InputWidth * u.InputHeight * u.InputDepth
+	outSize := u.OutputWidth() * u.OutputHeight() * u.InputDepth
+	res := make(linalg.Vector, inSize*n)
+	for i := 0; i < n; i++ {
+		upTensor := u.outputTensor(upstream[i*outSize : (i+1)*outSize])
+		downTensor := u.inputTensor(res[i*inSize : (i+1)*inSize])
+		u.forEachWeight(func(outX, outY, inX, inY int, weight float64) {
+			for z := 0; z < u.InputDepth; z++ {
+				old := downTensor.Get(inX, inY, z)
+				downTensor.Set(inX, inY, z, old+weight*upTensor.Get(outX, outY, z))
+			}
+		})
+	}
+	return res
+}
+
+// forEachWeight calls f for every pair of output and
+// input coordinates for which the output depends on the
+// input, giving the coefficient of the input.
+func (u *UpsampleLayer) forEachWeight(f func(outX, outY, inX, inY int, weight float64)) {
+	for outY := 0; outY < u.OutputHeight(); outY++ {
+		for outX := 0; outX < u.OutputWidth(); outX++ {
+			if !u.Bilinear {
+				f(outX, outY, outX/u.XFactor, outY/u.YFactor, 1)
+				continue
+			}
+			x0, x1, xFrac := interpolationPoints(outX, u.XFactor, u.InputWidth)
+			y0, y1, yFrac := interpolationPoints(outY, u.YFactor, u.InputHeight)
+			f(outX, outY, x0, y0, (1-xFrac)*(1-yFrac))
+			f(outX, outY, x1, y0, xFrac*(1-yFrac))
+			f(outX, outY, x0, y1, (1-xFrac)*yFrac)
+			f(outX, outY, x1, y1, xFrac*yFrac)
+		}
+	}
+}
+
+func (u *UpsampleLayer) inputTensor(inVec linalg.Vector) *Tensor3 {
+	return &Tensor3{
+		Width:  u.InputWidth,
+		Height: u.InputHeight,
+		Depth:  u.InputDepth,
+		Data:   inVec,
+	}
+}
+
+func (u *UpsampleLayer) outputTensor(outVec linalg.Vector) *Tensor3 {
+	return &Tensor3{
+		Width:  u.OutputWidth(),
+		Height: u.OutputHeight(),
+		Depth:  u.InputDepth,
+		Data:   outVec,
+	}
+}
+
+// interpolationPoints finds the two input coordinates
+// which surround an output coordinate, along with the
+// weight of the second input coordinate.
+func interpolationPoints(out, factor, inSize int) (in0, in1 int, frac float64) {
+	center := (float64(out)+0.5)/float64(factor) - 0.5
+	center = math.Max(0, math.Min(float64(inSize-1), center))
+	in0 = int(center)
+	in1 = in0 + 1
+	if in1 >= inSize {
+		in1 = inSize - 1
+	}
+	frac = center - float64(in0)
+	return
+}
+
+type upsampleResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	N         int
+	Layer     *UpsampleLayer
+}
+
+func (u *upsampleResult) Output() linalg.Vector {
+	return u.OutputVec
+}
+
+func (u *upsampleResult) Constant(g autofunc.Gradient) bool {
+	return u.Input.Constant(g)
+}
+
+func (u *upsampleResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	if u.Input.Constant(grad) {
+		return
+	}
+	u.Input.PropagateGradient(u.Layer.backward(upstream, u.N), grad)
+}
+
+type upsampleRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	N          int
+	Layer      *UpsampleLayer
+}
+
+func (u *upsampleRResult) Output() linalg.Vector {
+	return u.OutputVec
+}
+
+func (u *upsampleRResult) ROutput() linalg.Vector {
+	return u.ROutputVec
+}
+
+func (u *upsampleRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return u.Input.Constant(rg, g)
+}
+
+func (u *upsampleRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if u.Input.Constant(rgrad, grad) {
+		return
+	}
+	u.Input.PropagateRGradient(u.Layer.backward(upstream, u.N),
+		u.Layer.backward(upstreamR, u.N), rgrad, grad)
+}
@@ -0,0 +1,80 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/serializer"
+)
+
+func TestUpsampleNearest(t *testing.T) {
+	layer := &UpsampleLayer{
+		XFactor:     2,
+		YFactor:     3,
+		InputWidth:  2,
+		InputHeight: 1,
+		InputDepth:  2,
+	}
+	input := &autofunc.Variable{Vector: []float64{1, -1, 2, -2}}
+	expected := []float64{
+		1, -1, 1, -1, 2, -2, 2, -2,
+		1, -1, 1, -1, 2, -2, 2, -2,
+		1, -1, 1, -1, 2, -2, 2, -2,
+	}
+	testUpsampleOutput(t, layer, input, expected)
+}
+
+func TestUpsampleBilinear(t *testing.T) {
+	layer := &UpsampleLayer{
+		XFactor:     2,
+		YFactor:     1,
+		Bilinear:    true,
+		InputWidth:  2,
+		InputHeight: 2,
+		InputDepth:  1,
+	}
+	input := &autofunc.Variable{Vector: []float64{1, 3, 5, 7}}
+	expected := []float64{
+		1, 1.5, 2.5, 3,
+		5, 5.5, 6.5, 7,
+	}
+	testUpsampleOutput(t, layer, input, expected)
+}
+
+func TestUpsampleSerialize(t *testing.T) {
+	layer := &UpsampleLayer{
+		XFactor:     2,
+		YFactor:     3,
+		Bilinear:    true,
+		InputWidth:  4,
+		InputHeight: 3,
+		InputDepth:  2,
+	}
+	data, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(layer.SerializerType())(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newLayer, ok := decoded.(*UpsampleLayer); !ok {
+		t.Fatalf("unexpected type: %T", decoded)
+	} else if *newLayer != *layer {
+		t.Errorf("expected %v but got %v", layer, newLayer)
+	}
+}
+
+func testUpsampleOutput(t *testing.T, layer *UpsampleLayer, input *autofunc.Variable,
+	expected []float64) {
+	actual := layer.Apply(input).Output()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d outputs but got %d", len(expected), len(actual))
+	}
+	for i, x := range expected {
+		if math.Abs(actual[i]-x) > 1e-5 {
+			t.Errorf("output %d: expected %f got %f", i, x, actual[i])
+		}
+	}
+}
@@ -11,6 +11,13 @@ type Trainer struct {
 	StepSize   float64
 	Epochs     int
 	BatchSize  int
+
+	// StepSizeFunc, if non-nil, is used in place of
+	// StepSize to compute the step size for each batch.
+	// It is passed the number of batches which have
+	// already been trained on by the current call to
+	// Train.
+	StepSizeFunc func(step int) float64
 }
 
 // Train trains the RBM for the supplied inputs.
@@ -32,6 +39,7 @@ func (t *Trainer) Train(r *RBM, inputs [][]bool) {
 		}()
 	}
 
+	var step int
 	for i := 0; i < t.Epochs; i++ {
 		perm := rand.Perm(len(inputs))
 		for j := 0; j < len(inputs); j += t.BatchSize {
@@ -53,9 +61,14 @@ func (t *Trainer) Train(r *RBM, inputs [][]bool) {
 					batch.Weights.Add(grad.Weights)
 				}
 			}
-			r.HiddenBiases.Add(batch.HiddenBiases.Scale(t.StepSize))
-			r.VisibleBiases.Add(batch.VisibleBiases.Scale(t.StepSize))
-			r.Weights.Add(batch.Weights.Scale(t.StepSize))
+			stepSize := t.StepSize
+			if t.StepSizeFunc != nil {
+				stepSize = t.StepSizeFunc(step)
+			}
+			step++
+			r.HiddenBiases.Add(batch.HiddenBiases.Scale(stepSize))
+			r.VisibleBiases.Add(batch.VisibleBiases.Scale(stepSize))
+			r.Weights.Add(batch.Weights.Scale(stepSize))
 		}
 	}
 }
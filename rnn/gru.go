@@ -33,6 +33,17 @@ func NewGRU(inputSize, hiddenSize int) *GRU {
 	return res
 }
 
+// NewNormGRU creates a GRU like NewGRU, but each of its
+// gates applies layer normalization before its
+// activation function.
+func NewNormGRU(inputSize, hiddenSize int) *GRU {
+	res := NewGRU(inputSize, hiddenSize)
+	for _, gate := range res.gates() {
+		gate.Norm = neuralnet.NewLayerNorm(hiddenSize)
+	}
+	return res
+}
+
 // DeserializeGRU creates a GRU from some serialized
 // data about the GRU.
 func DeserializeGRU(d []byte) (*GRU, error) {
@@ -79,8 +90,11 @@ func (g *GRU) StartStateR(rv autofunc.RVector) autofunc.RResult {
 // reset gate weights, reset gate biases, update
 // gate weights, update gate biases, initial state
 // biases.
+// If the gates use layer normalization, the gains
+// and biases for each gate's normalization follow,
+// in the same gate order.
 func (g *GRU) Parameters() []*autofunc.Variable {
-	return []*autofunc.Variable{
+	res := []*autofunc.Variable{
 		g.inputValue.Dense.Weights.Data,
 		g.inputValue.Dense.Biases.Var,
 		g.resetGate.Dense.Weights.Data,
@@ -89,6 +103,10 @@ func (g *GRU) Parameters() []*autofunc.Variable {
 		g.updateGate.Dense.Biases.Var,
 		g.initState,
 	}
+	for _, gate := range g.gates() {
+		res = append(res, gate.NormParameters()...)
+	}
+	return res
 }
 
 func (g *GRU) StateSize() int {
@@ -166,6 +184,10 @@ func (g *GRU) SerializerType() string {
 	return serializerTypeGRU
 }
 
+func (g *GRU) gates() []*lstmGate {
+	return []*lstmGate{g.inputValue, g.resetGate, g.updateGate}
+}
+
 type gruOutput struct {
 	LaneCount int
 	Output    autofunc.Result
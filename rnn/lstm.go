@@ -41,6 +41,20 @@ func NewLSTM(inputSize, hiddenSize int) *LSTM {
 	return res
 }
 
+// NewNormLSTM creates an LSTM like NewLSTM, but each
+// of its gates applies layer normalization before its
+// activation function.
+// Layer normalization can make it easier to train an
+// LSTM over long sequences.
+func NewNormLSTM(inputSize, hiddenSize int) *LSTM {
+	res := NewLSTM(inputSize, hiddenSize)
+	for _, gate := range res.gates() {
+		gate.Norm = neuralnet.NewLayerNorm(hiddenSize)
+	}
+	res.prioritizeRemembering()
+	return res
+}
+
 // DeserializeLSTM creates an LSTM from some serialized
 // data about the LSTM.
 func DeserializeLSTM(d []byte) (*LSTM, error) {
@@ -89,8 +103,11 @@ func (l *LSTM) StartStateR(rv autofunc.RVector) autofunc.RResult {
 // input gate weights, input gate biases, remember
 // gate weights, remember gate biases, output gate
 // weights, output gate biases, init state biases.
+// If the gates use layer normalization, the gains
+// and biases for each gate's normalization follow,
+// in the same gate order.
 func (l *LSTM) Parameters() []*autofunc.Variable {
-	return []*autofunc.Variable{
+	res := []*autofunc.Variable{
 		l.inputValue.Dense.Weights.Data,
 		l.inputValue.Dense.Biases.Var,
 		l.inputGate.Dense.Weights.Data,
@@ -101,6 +118,10 @@ func (l *LSTM) Parameters() []*autofunc.Variable {
 		l.outputGate.Dense.Biases.Var,
 		l.initState,
 	}
+	for _, gate := range l.gates() {
+		res = append(res, gate.NormParameters()...)
+	}
+	return res
 }
 
 func (l *LSTM) StateSize() int {
@@ -191,13 +212,28 @@ func (l *LSTM) SerializerType() string {
 
 func (l *LSTM) prioritizeRemembering() {
 	rememberBiases := l.rememberGate.Dense.Biases.Var.Vector
+	if l.rememberGate.Norm != nil {
+		// Dense biases are canceled out by normalization.
+		for i := range rememberBiases {
+			rememberBiases[i] = 0
+		}
+		rememberBiases = l.rememberGate.Norm.Biases.Vector
+	}
 	for i := range rememberBiases {
 		rememberBiases[i] = initialRememberBias
 	}
 }
 
+func (l *LSTM) gates() []*lstmGate {
+	return []*lstmGate{l.inputValue, l.inputGate, l.rememberGate, l.outputGate}
+}
+
+// lstmGate is a fully-connected layer followed by an
+// activation function, with optional layer normalization
+// between the two.
 type lstmGate struct {
 	Dense      *neuralnet.DenseLayer
+	Norm       *neuralnet.LayerNorm
 	Activation neuralnet.Layer
 }
 
@@ -218,7 +254,7 @@ func deserializeLSTMGate(d []byte) (*lstmGate, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(list) != 2 {
+	if len(list) != 2 && len(list) != 3 {
 		return nil, errors.New("invalid slice length for LSTM gate")
 	}
 	dense, ok := list[0].(*neuralnet.DenseLayer)
@@ -226,19 +262,46 @@ func deserializeLSTMGate(d []byte) (*lstmGate, error) {
 	if !ok || !ok1 {
 		return nil, errors.New("invalid types for list elements")
 	}
-	return &lstmGate{Dense: dense, Activation: activ}, nil
+	res := &lstmGate{Dense: dense, Activation: activ}
+	if len(list) == 3 {
+		res.Norm, ok = list[2].(*neuralnet.LayerNorm)
+		if !ok {
+			return nil, errors.New("invalid types for list elements")
+		}
+	}
+	return res, nil
+}
+
+// NormParameters returns the parameters of the gate's
+// layer normalization, if there is any.
+func (l *lstmGate) NormParameters() []*autofunc.Variable {
+	if l.Norm == nil {
+		return nil
+	}
+	return l.Norm.Parameters()
 }
 
 func (l *lstmGate) Batch(in autofunc.Result, n int) autofunc.Result {
-	return l.Activation.Apply(l.Dense.Batch(in, n))
+	out := l.Dense.Batch(in, n)
+	if l.Norm != nil {
+		out = l.Norm.Batch(out, n)
+	}
+	return l.Activation.Apply(out)
 }
 
 func (l *lstmGate) BatchR(v autofunc.RVector, in autofunc.RResult, n int) autofunc.RResult {
-	return l.Activation.ApplyR(v, l.Dense.BatchR(v, in, n))
+	out := l.Dense.BatchR(v, in, n)
+	if l.Norm != nil {
+		out = l.Norm.BatchR(v, out, n)
+	}
+	return l.Activation.ApplyR(v, out)
 }
 
 func (l *lstmGate) Serialize() ([]byte, error) {
 	slist := []serializer.Serializer{l.Dense, l.Activation}
+	if l.Norm != nil {
+		slist = append(slist, l.Norm)
+	}
 	return serializer.SerializeSlice(slist)
 }
 
@@ -0,0 +1,116 @@
+package rnn
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// packSeqs concatenates every timestep of every sequence
+// into one packed Result.
+// If there are no timesteps, the packed Result is nil.
+func packSeqs(seqs [][]autofunc.Result) (packed autofunc.Result, lengths []int) {
+	var joined []autofunc.Result
+	lengths = make([]int, len(seqs))
+	for i, seq := range seqs {
+		joined = append(joined, seq...)
+		lengths[i] = len(seq)
+	}
+	if len(joined) > 0 {
+		packed = autofunc.Concat(joined...)
+	}
+	return
+}
+
+// packSeqsR is like packSeqs, but for RResults.
+func packSeqsR(seqs [][]autofunc.RResult) (packed autofunc.RResult, lengths []int) {
+	var joined []autofunc.RResult
+	lengths = make([]int, len(seqs))
+	for i, seq := range seqs {
+		joined = append(joined, seq...)
+		lengths[i] = len(seq)
+	}
+	if len(joined) > 0 {
+		packed = autofunc.ConcatR(joined...)
+	}
+	return
+}
+
+// packedSeqsResult is a ResultSeqs which is backed by a
+// Result containing every output timestep.
+type packedSeqsResult struct {
+	Output    autofunc.Result
+	PackedOut [][]linalg.Vector
+}
+
+func newPackedSeqsResult(out autofunc.Result, lengths []int) *packedSeqsResult {
+	return &packedSeqsResult{
+		Output:    out,
+		PackedOut: splitSeqs(out.Output(), lengths),
+	}
+}
+
+func (p *packedSeqsResult) OutputSeqs() [][]linalg.Vector {
+	return p.PackedOut
+}
+
+func (p *packedSeqsResult) Gradient(upstream [][]linalg.Vector, g autofunc.Gradient) {
+	if p.Output == nil {
+		return
+	}
+	p.Output.PropagateGradient(joinSeqBatchVec(upstream), g)
+}
+
+// packedSeqsRResult is like packedSeqsResult, but for
+// RResultSeqs.
+type packedSeqsRResult struct {
+	Output     autofunc.RResult
+	PackedOut  [][]linalg.Vector
+	RPackedOut [][]linalg.Vector
+}
+
+func newPackedSeqsRResult(out autofunc.RResult, lengths []int) *packedSeqsRResult {
+	return &packedSeqsRResult{
+		Output:     out,
+		PackedOut:  splitSeqs(out.Output(), lengths),
+		RPackedOut: splitSeqs(out.ROutput(), lengths),
+	}
+}
+
+func (p *packedSeqsRResult) OutputSeqs() [][]linalg.Vector {
+	return p.PackedOut
+}
+
+func (p *packedSeqsRResult) ROutputSeqs() [][]linalg.Vector {
+	return p.RPackedOut
+}
+
+func (p *packedSeqsRResult) RGradient(upstream, upstreamR [][]linalg.Vector,
+	rg autofunc.RGradient, g autofunc.Gradient) {
+	if p.Output == nil {
+		return
+	}
+	if g == nil {
+		g = autofunc.Gradient{}
+	}
+	p.Output.PropagateRGradient(joinSeqBatchVec(upstream),
+		joinSeqBatchVec(upstreamR), rg, g)
+}
+
+// splitSeqs splits a packed batch of timesteps into
+// sequences of the given lengths.
+func splitSeqs(packed linalg.Vector, lengths []int) [][]linalg.Vector {
+	var total int
+	for _, l := range lengths {
+		total += l
+	}
+	size := len(packed) / total
+	res := make([][]linalg.Vector, len(lengths))
+	var idx int
+	for i, l := range lengths {
+		for t := 0; t < l; t++ {
+			res[i] = append(res[i], packed[idx:idx+size])
+			idx += size
+		}
+	}
+	return res
+}
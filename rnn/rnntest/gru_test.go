@@ -37,3 +37,28 @@ func TestGRUBatches(t *testing.T) {
 	batchTest.GradientParams = nil
 	batchTest.Run(t)
 }
+
+func TestNormGRUGradients(t *testing.T) {
+	test := GradientTest{
+		Block: rnn.StackedBlock{rnn.NewNormGRU(3, 4),
+			NewSquareBlock(2)},
+		GradientParams: gradientTestVariables,
+		Inputs:         gradientTestVariables[:2],
+		InStates:       gradientTestVariables[6:8],
+	}
+	test.Run(t)
+	test.GradientParams = nil
+	test.Run(t)
+}
+
+func TestNormGRUBatches(t *testing.T) {
+	batchTest := BatchTest{
+		Block: rnn.StackedBlock{rnn.NewNormGRU(3, 4), NewSquareBlock(2)},
+
+		OutputSize:     4,
+		GradientParams: gradientTestVariables,
+		Inputs:         gradientTestVariables[:2],
+		InStates:       gradientTestVariables[6:8],
+	}
+	batchTest.Run(t)
+}
@@ -37,3 +37,28 @@ func TestLSTMBatches(t *testing.T) {
 	batchTest.GradientParams = nil
 	batchTest.Run(t)
 }
+
+func TestNormLSTMGradients(t *testing.T) {
+	test := GradientTest{
+		Block: rnn.StackedBlock{rnn.NewNormLSTM(3, 2),
+			NewSquareBlock(2)},
+		GradientParams: gradientTestVariables,
+		Inputs:         gradientTestVariables[:2],
+		InStates:       gradientTestVariables[6:8],
+	}
+	test.Run(t)
+	test.GradientParams = nil
+	test.Run(t)
+}
+
+func TestNormLSTMBatches(t *testing.T) {
+	batchTest := BatchTest{
+		Block: rnn.StackedBlock{rnn.NewNormLSTM(3, 2), NewSquareBlock(2)},
+
+		OutputSize:     2,
+		GradientParams: gradientTestVariables,
+		Inputs:         gradientTestVariables[:2],
+		InStates:       gradientTestVariables[6:8],
+	}
+	batchTest.Run(t)
+}
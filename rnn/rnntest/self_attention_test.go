@@ -0,0 +1,82 @@
+package rnntest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+var selfAttentionTests = [][]linalg.Vector{
+	{{0.5, 0.2, 0.3, -0.1}, {-0.1, -0.2, 0.1, 0.5}, {0.1, 0.1, -0.1, 0.2}},
+	{{0.1, 0, 0.3, 0.1}},
+	{},
+	{{0.1, 0.2, 0.3, 0}, {-0.1, -0.2, 0.1, 0.1}, {0.1, 0.1, -0.1, -0.1},
+		{0, 0, 0, 0.5}},
+}
+
+func TestSelfAttentionGradients(t *testing.T) {
+	rand.Seed(123)
+	for _, causal := range []bool{false, true} {
+		attention := rnn.NewSelfAttention(4, 2)
+		attention.Causal = causal
+		test := SeqFuncTest{
+			S:        attention,
+			Params:   attention.Parameters(),
+			TestSeqs: selfAttentionTests,
+		}
+		test.Run(t)
+	}
+}
+
+func TestSelfAttentionSingleStep(t *testing.T) {
+	rand.Seed(123)
+	attention := rnn.NewSelfAttention(4, 2)
+	in := &autofunc.Variable{Vector: []float64{1, -2, 0.5, 3}}
+	actual := attention.BatchSeqs([][]autofunc.Result{{in}}).OutputSeqs()[0][0]
+	expected := attention.Output.Apply(attention.Value.Apply(in)).Output()
+	if actual.Copy().Scale(-1).Add(expected).MaxAbs() > 1e-6 {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestSelfAttentionCausal(t *testing.T) {
+	rand.Seed(123)
+	attention := rnn.NewSelfAttention(4, 2)
+	attention.Causal = true
+	full := selfAttentionTests[3]
+	for length := 1; length <= len(full); length++ {
+		prefix := seqsToVarSeqs([][]linalg.Vector{full[:length]})
+		fullOut := attention.BatchSeqs(seqsToVarSeqs([][]linalg.Vector{full}))
+		prefixOut := attention.BatchSeqs(prefix)
+		testSequencesEqual(t, "prefix", prefixOut.OutputSeqs(),
+			[][]linalg.Vector{fullOut.OutputSeqs()[0][:length]})
+	}
+}
+
+func TestSelfAttentionSerialize(t *testing.T) {
+	rand.Seed(123)
+	attention := rnn.NewSelfAttention(4, 2)
+	attention.Causal = true
+	data, err := attention.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(attention.SerializerType())(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAttention, ok := decoded.(*rnn.SelfAttention)
+	if !ok {
+		t.Fatalf("unexpected type: %T", decoded)
+	}
+	if newAttention.HeadCount != attention.HeadCount || !newAttention.Causal {
+		t.Error("unexpected attention configuration")
+	}
+	expected := attention.BatchSeqs(seqsToVarSeqs(selfAttentionTests)).OutputSeqs()
+	actual := newAttention.BatchSeqs(seqsToVarSeqs(selfAttentionTests)).OutputSeqs()
+	testSequencesEqual(t, "outputs", actual, expected)
+}
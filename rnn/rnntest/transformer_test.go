@@ -0,0 +1,69 @@
+package rnntest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+var transformerTests = [][]linalg.Vector{
+	{{1, 2, 3, -1}, {-1, -2, 1, 0.5}},
+	{{1, 0, 3, 1}},
+	{},
+}
+
+func TestTransformerEncoderGradients(t *testing.T) {
+	rand.Seed(123)
+	encoder := rnn.NewTransformerEncoder(4, 2, 3, 1)
+	test := SeqFuncTest{
+		S:        encoder,
+		Params:   encoder.Parameters(),
+		TestSeqs: transformerTests,
+	}
+	test.Run(t)
+}
+
+func TestTransformerEncoderLearnedGradients(t *testing.T) {
+	rand.Seed(123)
+	encoder := rnn.NewTransformerEncoder(4, 2, 3, 1)
+	encoder.LearnPositions(5)
+	encoder.Layers[0].Attention.Causal = true
+	test := SeqFuncTest{
+		S:        encoder,
+		Params:   encoder.Parameters(),
+		TestSeqs: transformerTests,
+	}
+	test.Run(t)
+}
+
+func TestTransformerEncoderSerialize(t *testing.T) {
+	rand.Seed(123)
+	for _, learned := range []bool{false, true} {
+		encoder := rnn.NewTransformerEncoder(4, 2, 6, 2)
+		if learned {
+			encoder.LearnPositions(4)
+		}
+		data, err := encoder.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := serializer.GetDeserializer(encoder.SerializerType())(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newEncoder, ok := decoded.(*rnn.TransformerEncoder)
+		if !ok {
+			t.Fatalf("unexpected type: %T", decoded)
+		}
+		if len(newEncoder.Parameters()) != len(encoder.Parameters()) {
+			t.Fatalf("expected %d parameters but got %d", len(encoder.Parameters()),
+				len(newEncoder.Parameters()))
+		}
+		expected := encoder.BatchSeqs(seqsToVarSeqs(selfAttentionTests)).OutputSeqs()
+		actual := newEncoder.BatchSeqs(seqsToVarSeqs(selfAttentionTests)).OutputSeqs()
+		testSequencesEqual(t, "outputs", actual, expected)
+	}
+}
@@ -0,0 +1,491 @@
+package rnn
+
+import (
+	"errors"
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+// SelfAttention is a SeqFunc which applies multi-head
+// scaled dot-product self-attention, as described in
+// https://arxiv.org/abs/1706.03762.
+//
+// Every timestep of an input sequence is projected to
+// a query, a key, and a value.
+// The projections are split into HeadCount equally
+// sized heads, each of which attends over the entire
+// sequence independently.
+// The concatenated head outputs are fed through the
+// Output projection to produce the output at each
+// timestep.
+type SelfAttention struct {
+	HeadCount int
+
+	// Causal, if true, prevents each timestep from
+	// attending to later timesteps.
+	Causal bool
+
+	Query  *neuralnet.DenseLayer
+	Key    *neuralnet.DenseLayer
+	Value  *neuralnet.DenseLayer
+	Output *neuralnet.DenseLayer
+}
+
+// NewSelfAttention creates a SelfAttention with random
+// projections whose inputs and outputs are all of size
+// inSize.
+// The inSize must be divisible by headCount.
+func NewSelfAttention(inSize, headCount int) *SelfAttention {
+	if inSize%headCount != 0 {
+		panic("input size must be divisible by head count")
+	}
+	return &SelfAttention{
+		HeadCount: headCount,
+		Query:     newAttentionProjection(inSize),
+		Key:       newAttentionProjection(inSize),
+		Value:     newAttentionProjection(inSize),
+		Output:    newAttentionProjection(inSize),
+	}
+}
+
+// DeserializeSelfAttention deserializes a SelfAttention.
+func DeserializeSelfAttention(d []byte) (*SelfAttention, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) != 6 {
+		return nil, errors.New("invalid SelfAttention slice length")
+	}
+	headCount, ok1 := slice[0].(serializer.Int)
+	causal, ok2 := slice[1].(serializer.Int)
+	res := &SelfAttention{HeadCount: int(headCount), Causal: causal != 0}
+	var ok3, ok4, ok5, ok6 bool
+	res.Query, ok3 = slice[2].(*neuralnet.DenseLayer)
+	res.Key, ok4 = slice[3].(*neuralnet.DenseLayer)
+	res.Value, ok5 = slice[4].(*neuralnet.DenseLayer)
+	res.Output, ok6 = slice[5].(*neuralnet.DenseLayer)
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || !ok6 {
+		return nil, errors.New("invalid SelfAttention slice types")
+	}
+	return res, nil
+}
+
+// BatchSeqs applies self-attention to each sequence.
+func (s *SelfAttention) BatchSeqs(seqs [][]autofunc.Result) ResultSeqs {
+	joined, lengths := packSeqs(seqs)
+	if joined == nil {
+		return &packedSeqsResult{PackedOut: make([][]linalg.Vector, len(seqs))}
+	}
+	return newPackedSeqsResult(s.applyPacked(joined, lengths), lengths)
+}
+
+// BatchSeqsR is like BatchSeqs, but with R-operator
+// support.
+func (s *SelfAttention) BatchSeqsR(rv autofunc.RVector, seqs [][]autofunc.RResult) RResultSeqs {
+	joined, lengths := packSeqsR(seqs)
+	if joined == nil {
+		return &packedSeqsRResult{
+			PackedOut:  make([][]linalg.Vector, len(seqs)),
+			RPackedOut: make([][]linalg.Vector, len(seqs)),
+		}
+	}
+	return newPackedSeqsRResult(s.applyPackedR(rv, joined, lengths), lengths)
+}
+
+// Parameters returns the parameters of the query, key,
+// value, and output projections, in that order.
+func (s *SelfAttention) Parameters() []*autofunc.Variable {
+	var res []*autofunc.Variable
+	for _, l := range []*neuralnet.DenseLayer{s.Query, s.Key, s.Value, s.Output} {
+		res = append(res, l.Parameters()...)
+	}
+	return res
+}
+
+// SerializerType returns the unique ID used to serialize
+// SelfAttention instances with the serializer package.
+func (s *SelfAttention) SerializerType() string {
+	return serializerTypeSelfAttention
+}
+
+// Serialize serializes the SelfAttention.
+func (s *SelfAttention) Serialize() ([]byte, error) {
+	var causal serializer.Int
+	if s.Causal {
+		causal = 1
+	}
+	slist := []serializer.Serializer{
+		serializer.Int(s.HeadCount),
+		causal,
+		s.Query,
+		s.Key,
+		s.Value,
+		s.Output,
+	}
+	return serializer.SerializeSlice(slist)
+}
+
+func (s *SelfAttention) shape(lengths []int) *attentionShape {
+	hidden := s.Query.OutputCount
+	if hidden%s.HeadCount != 0 {
+		panic("hidden size must be divisible by head count")
+	}
+	return &attentionShape{
+		Lengths:   lengths,
+		HeadCount: s.HeadCount,
+		HeadSize:  hidden / s.HeadCount,
+		Causal:    s.Causal,
+	}
+}
+
+// applyPacked applies self-attention to a packed batch
+// of sequences with the given lengths.
+func (s *SelfAttention) applyPacked(in autofunc.Result, lengths []int) autofunc.Result {
+	shape := s.shape(lengths)
+	n := len(in.Output()) / s.Query.InputCount
+	return autofunc.Pool(in, func(in autofunc.Result) autofunc.Result {
+		attention := &attentionResult{
+			Shape: shape,
+			Query: s.Query.Batch(in, n),
+			Key:   s.Key.Batch(in, n),
+			Value: s.Value.Batch(in, n),
+		}
+		attention.OutputVec, attention.Probs = shape.Forward(
+			attention.Query.Output(), attention.Key.Output(),
+			attention.Value.Output())
+		return s.Output.Batch(attention, n)
+	})
+}
+
+// applyPackedR is like applyPacked, but for RResults.
+func (s *SelfAttention) applyPackedR(rv autofunc.RVector, in autofunc.RResult,
+	lengths []int) autofunc.RResult {
+	shape := s.shape(lengths)
+	n := len(in.Output()) / s.Query.InputCount
+	return autofunc.PoolR(in, func(in autofunc.RResult) autofunc.RResult {
+		attention := &attentionRResult{
+			Shape: shape,
+			Query: s.Query.BatchR(rv, in, n),
+			Key:   s.Key.BatchR(rv, in, n),
+			Value: s.Value.BatchR(rv, in, n),
+		}
+		attention.OutputVec, attention.Probs = shape.Forward(
+			attention.Query.Output(), attention.Key.Output(),
+			attention.Value.Output())
+		attention.ROutputVec, attention.ProbsR = shape.ForwardR(
+			attention.Query, attention.Key, attention.Value, attention.Probs)
+		return s.Output.BatchR(rv, attention, n)
+	})
+}
+
+func newAttentionProjection(size int) *neuralnet.DenseLayer {
+	res := &neuralnet.DenseLayer{InputCount: size, OutputCount: size}
+	res.Randomize()
+	return res
+}
+
+// attentionShape describes how a packed batch of query,
+// key, and value vectors is split up into sequences and
+// attention heads.
+//
+// A packed vector stores every timestep of every sequence
+// consecutively, and each timestep stores the components
+// for every head consecutively.
+type attentionShape struct {
+	Lengths   []int
+	HeadCount int
+	HeadSize  int
+	Causal    bool
+}
+
+// forEachBlock calls f for every (sequence, head) pair,
+// giving the index of the pair, the first timestep of
+// the sequence in the packed batch, and the length of
+// the sequence.
+func (a *attentionShape) forEachBlock(f func(block, start, length, head int)) {
+	var block, start int
+	for _, length := range a.Lengths {
+		for head := 0; head < a.HeadCount; head++ {
+			f(block, start, length, head)
+			block++
+		}
+		start += length
+	}
+}
+
+// span returns the number of keys visible to the query
+// at timestep i of a sequence.
+func (a *attentionShape) span(i, length int) int {
+	if a.Causal {
+		return i + 1
+	}
+	return length
+}
+
+func (a *attentionShape) vec(packed linalg.Vector, t, head int) linalg.Vector {
+	start := (t*a.HeadCount + head) * a.HeadSize
+	return packed[start : start+a.HeadSize]
+}
+
+func (a *attentionShape) scale() float64 {
+	return 1 / math.Sqrt(float64(a.HeadSize))
+}
+
+// Forward computes the attention outputs and, for each
+// block, the attention probabilities (stored as a square
+// matrix in row-major order).
+func (a *attentionShape) Forward(q, k, v linalg.Vector) (out linalg.Vector,
+	probs []linalg.Vector) {
+	out = make(linalg.Vector, len(v))
+	a.forEachBlock(func(block, start, length, head int) {
+		p := make(linalg.Vector, length*length)
+		for i := 0; i < length; i++ {
+			query := a.vec(q, start+i, head)
+			row := p[i*length : i*length+a.span(i, length)]
+			for j := range row {
+				row[j] = a.scale() * query.Dot(a.vec(k, start+j, head))
+			}
+			softmaxInPlace(row)
+			outVec := a.vec(out, start+i, head)
+			for j, prob := range row {
+				outVec.Add(a.vec(v, start+j, head).Copy().Scale(prob))
+			}
+		}
+		probs = append(probs, p)
+	})
+	return
+}
+
+// ForwardR computes the R-derivatives of the attention
+// outputs and probabilities.
+func (a *attentionShape) ForwardR(q, k, v autofunc.RResult,
+	probs []linalg.Vector) (outR linalg.Vector, probsR []linalg.Vector) {
+	qVec, kVec, vVec := q.Output(), k.Output(), v.Output()
+	qR, kR, vR := q.ROutput(), k.ROutput(), v.ROutput()
+	outR = make(linalg.Vector, len(vVec))
+	a.forEachBlock(func(block, start, length, head int) {
+		p := probs[block]
+		pR := make(linalg.Vector, length*length)
+		for i := 0; i < length; i++ {
+			span := a.span(i, length)
+			row := p[i*length : i*length+span]
+			rowR := pR[i*length : i*length+span]
+			query := a.vec(qVec, start+i, head)
+			queryR := a.vec(qR, start+i, head)
+			for j := range rowR {
+				rowR[j] = a.scale() * (queryR.Dot(a.vec(kVec, start+j, head)) +
+					query.Dot(a.vec(kR, start+j, head)))
+			}
+			softmaxR(row, rowR)
+			outVec := a.vec(outR, start+i, head)
+			for j, prob := range row {
+				outVec.Add(a.vec(vVec, start+j, head).Copy().Scale(rowR[j]))
+				outVec.Add(a.vec(vR, start+j, head).Copy().Scale(prob))
+			}
+		}
+		probsR = append(probsR, pR)
+	})
+	return
+}
+
+// Backward computes the gradients of the query, key, and
+// value vectors given the upstream gradient.
+func (a *attentionShape) Backward(q, k, v linalg.Vector, probs []linalg.Vector,
+	upstream linalg.Vector) (dq, dk, dv linalg.Vector) {
+	dq = make(linalg.Vector, len(q))
+	dk = make(linalg.Vector, len(k))
+	dv = make(linalg.Vector, len(v))
+	a.forEachBlock(func(block, start, length, head int) {
+		p := probs[block]
+		for i := 0; i < length; i++ {
+			row := p[i*length : i*length+a.span(i, length)]
+			up := a.vec(upstream, start+i, head)
+			scoreGrad := a.scoreGrad(row, up, v, start, head)
+			for j, prob := range row {
+				a.vec(dv, start+j, head).Add(up.Copy().Scale(prob))
+				a.vec(dq, start+i, head).Add(a.vec(k, start+j, head).Copy().Scale(
+					a.scale() * scoreGrad[j]))
+				a.vec(dk, start+j, head).Add(a.vec(q, start+i, head).Copy().Scale(
+					a.scale() * scoreGrad[j]))
+			}
+		}
+	})
+	return
+}
+
+// BackwardR computes the R-derivatives of the gradients
+// computed by Backward.
+func (a *attentionShape) BackwardR(q, k, v autofunc.RResult, probs,
+	probsR []linalg.Vector, upstream, upstreamR linalg.Vector) (dqR, dkR,
+	dvR linalg.Vector) {
+	qVec, kVec, vVec := q.Output(), k.Output(), v.Output()
+	qR, kR, vR := q.ROutput(), k.ROutput(), v.ROutput()
+	dqR = make(linalg.Vector, len(qVec))
+	dkR = make(linalg.Vector, len(kVec))
+	dvR = make(linalg.Vector, len(vVec))
+	a.forEachBlock(func(block, start, length, head int) {
+		p := probs[block]
+		pR := probsR[block]
+		for i := 0; i < length; i++ {
+			span := a.span(i, length)
+			row := p[i*length : i*length+span]
+			rowR := pR[i*length : i*length+span]
+			up := a.vec(upstream, start+i, head)
+			upR := a.vec(upstreamR, start+i, head)
+
+			probGrad := make(linalg.Vector, span)
+			probGradR := make(linalg.Vector, span)
+			for j := range row {
+				probGrad[j] = up.Dot(a.vec(vVec, start+j, head))
+				probGradR[j] = upR.Dot(a.vec(vVec, start+j, head)) +
+					up.Dot(a.vec(vR, start+j, head))
+			}
+			var dot, dotR float64
+			for j, prob := range row {
+				dot += prob * probGrad[j]
+				dotR += rowR[j]*probGrad[j] + prob*probGradR[j]
+			}
+
+			query := a.vec(qVec, start+i, head)
+			queryR := a.vec(qR, start+i, head)
+			for j, prob := range row {
+				scoreGrad := prob * (probGrad[j] - dot)
+				scoreGradR := rowR[j]*(probGrad[j]-dot) + prob*(probGradR[j]-dotR)
+				key := a.vec(kVec, start+j, head)
+				keyR := a.vec(kR, start+j, head)
+
+				a.vec(dvR, start+j, head).Add(up.Copy().Scale(rowR[j])).
+					Add(upR.Copy().Scale(prob))
+				a.vec(dqR, start+i, head).Add(key.Copy().Scale(a.scale() * scoreGradR)).
+					Add(keyR.Copy().Scale(a.scale() * scoreGrad))
+				a.vec(dkR, start+j, head).Add(query.Copy().Scale(a.scale() * scoreGradR)).
+					Add(queryR.Copy().Scale(a.scale() * scoreGrad))
+			}
+		}
+	})
+	return
+}
+
+// scoreGrad computes the gradient of the pre-softmax
+// attention scores for one query.
+func (a *attentionShape) scoreGrad(row, up, v linalg.Vector, start,
+	head int) linalg.Vector {
+	res := make(linalg.Vector, len(row))
+	var dot float64
+	for j, prob := range row {
+		res[j] = up.Dot(a.vec(v, start+j, head))
+		dot += prob * res[j]
+	}
+	for j, prob := range row {
+		res[j] = prob * (res[j] - dot)
+	}
+	return res
+}
+
+type attentionResult struct {
+	OutputVec linalg.Vector
+	Probs     []linalg.Vector
+	Shape     *attentionShape
+
+	Query autofunc.Result
+	Key   autofunc.Result
+	Value autofunc.Result
+}
+
+func (a *attentionResult) Output() linalg.Vector {
+	return a.OutputVec
+}
+
+func (a *attentionResult) Constant(g autofunc.Gradient) bool {
+	return a.Query.Constant(g) && a.Key.Constant(g) && a.Value.Constant(g)
+}
+
+func (a *attentionResult) PropagateGradient(upstream linalg.Vector, g autofunc.Gradient) {
+	if a.Constant(g) {
+		return
+	}
+	dq, dk, dv := a.Shape.Backward(a.Query.Output(), a.Key.Output(),
+		a.Value.Output(), a.Probs, upstream)
+	for _, x := range []struct {
+		Result   autofunc.Result
+		Upstream linalg.Vector
+	}{{a.Query, dq}, {a.Key, dk}, {a.Value, dv}} {
+		if !x.Result.Constant(g) {
+			x.Result.PropagateGradient(x.Upstream, g)
+		}
+	}
+}
+
+type attentionRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Probs      []linalg.Vector
+	ProbsR     []linalg.Vector
+	Shape      *attentionShape
+
+	Query autofunc.RResult
+	Key   autofunc.RResult
+	Value autofunc.RResult
+}
+
+func (a *attentionRResult) Output() linalg.Vector {
+	return a.OutputVec
+}
+
+func (a *attentionRResult) ROutput() linalg.Vector {
+	return a.ROutputVec
+}
+
+func (a *attentionRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return a.Query.Constant(rg, g) && a.Key.Constant(rg, g) && a.Value.Constant(rg, g)
+}
+
+func (a *attentionRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rg autofunc.RGradient, g autofunc.Gradient) {
+	if a.Constant(rg, g) {
+		return
+	}
+	dq, dk, dv := a.Shape.Backward(a.Query.Output(), a.Key.Output(),
+		a.Value.Output(), a.Probs, upstream)
+	dqR, dkR, dvR := a.Shape.BackwardR(a.Query, a.Key, a.Value, a.Probs,
+		a.ProbsR, upstream, upstreamR)
+	for _, x := range []struct {
+		Result    autofunc.RResult
+		Upstream  linalg.Vector
+		UpstreamR linalg.Vector
+	}{{a.Query, dq, dqR}, {a.Key, dk, dkR}, {a.Value, dv, dvR}} {
+		if !x.Result.Constant(rg, g) {
+			x.Result.PropagateRGradient(x.Upstream, x.UpstreamR, rg, g)
+		}
+	}
+}
+
+// softmaxInPlace replaces a vector of scores with the
+// corresponding softmax probabilities.
+func softmaxInPlace(v linalg.Vector) {
+	max := math.Inf(-1)
+	for _, x := range v {
+		max = math.Max(max, x)
+	}
+	var sum float64
+	for i, x := range v {
+		v[i] = math.Exp(x - max)
+		sum += v[i]
+	}
+	v.Scale(1 / sum)
+}
+
+// softmaxR replaces the R-derivatives of a vector of
+// scores with the R-derivatives of their softmax, given
+// the softmax probabilities.
+func softmaxR(probs, scoresR linalg.Vector) {
+	dot := probs.Dot(scoresR)
+	for i, p := range probs {
+		scoresR[i] = p * (scoresR[i] - dot)
+	}
+}
@@ -206,3 +206,103 @@ func compareGrads(t *testing.T, prefix string, actual,
 		}
 	}
 }
+
+func TestMaskedGradienters(t *testing.T) {
+	block := rnn.StackedBlock{rnn.NewLSTM(3, 4), rnntest.NewSquareBlock(0)}
+	samples := sgd.SliceSampleSet{}
+	shuffled := sgd.SliceSampleSet{}
+	for i := 0; i < 6; i++ {
+		var seq Sample
+		for j := 0; j < i+2; j++ {
+			input := make(linalg.Vector, 3)
+			output := make(linalg.Vector, 4)
+			mask := make(linalg.Vector, 4)
+			for k := range input {
+				input[k] = rand.NormFloat64()
+			}
+			for k := range output {
+				output[k] = rand.Float64()
+				mask[k] = float64(rand.Intn(2))
+			}
+			seq.Inputs = append(seq.Inputs, input)
+			seq.Outputs = append(seq.Outputs, output)
+			if j%3 == 0 {
+				seq.Masks = append(seq.Masks, nil)
+			} else {
+				seq.Masks = append(seq.Masks, mask)
+			}
+		}
+		samples = append(samples, seq)
+
+		changed := seq
+		changed.Outputs = make([]linalg.Vector, len(seq.Outputs))
+		for j, output := range seq.Outputs {
+			changed.Outputs[j] = output.Copy()
+			if seq.Masks[j] == nil {
+				continue
+			}
+			for k, m := range seq.Masks[j] {
+				if m == 0 {
+					changed.Outputs[j][k] = rand.Float64()
+				}
+			}
+		}
+		shuffled = append(shuffled, changed)
+	}
+
+	rv := autofunc.RVector(autofunc.NewGradient(block.Parameters()))
+	for _, v := range rv {
+		for i := range v {
+			v[i] = rand.NormFloat64()
+		}
+	}
+
+	gradienters := []sgd.RGradienter{
+		&BPTT{
+			Block:    block,
+			Learner:  block,
+			CostFunc: gradienterTestCost,
+			MaxLanes: 2,
+		},
+		&TruncatedBPTT{
+			Block:    block,
+			Learner:  block,
+			CostFunc: gradienterTestCost,
+			MaxLanes: 3,
+			HeadSize: 10,
+		},
+		&SeqFuncGradienter{
+			SeqFunc:  &rnn.BlockSeqFunc{Block: block},
+			Learner:  block,
+			CostFunc: gradienterTestCost,
+		},
+	}
+	expected, expectedR := gradienters[0].RGradient(rv, samples)
+	expected = copyGrad(expected)
+	expectedR = autofunc.RGradient(copyGrad(autofunc.Gradient(expectedR)))
+	for _, g := range gradienters {
+		for _, set := range []sgd.SampleSet{samples, shuffled} {
+			actual, actualR := g.RGradient(rv, set)
+			compareGrads(t, "masked gradient", actual, expected)
+			compareGrads(t, "masked r-gradient", actualR, expectedR)
+		}
+	}
+
+	// With a head and tail shorter than the sequences,
+	// truncation changes the gradient, so masked outputs
+	// are checked against the truncated gradient itself.
+	truncated := &TruncatedBPTT{
+		Block:    block,
+		Learner:  block,
+		CostFunc: gradienterTestCost,
+		MaxLanes: 3,
+		HeadSize: 2,
+		TailSize: 2,
+	}
+	expected, expectedR = truncated.RGradient(rv, samples)
+	expected = copyGrad(expected)
+	expectedR = autofunc.RGradient(copyGrad(autofunc.Gradient(expectedR)))
+	actual, actualR := truncated.RGradient(rv, shuffled)
+	compareGrads(t, "truncated masked gradient", actual, expected)
+	compareGrads(t, "truncated masked r-gradient", actualR, expectedR)
+}
@@ -18,18 +18,19 @@ func TotalCostBlock(b rnn.Block, batchSize int, s sgd.SampleSet, c neuralnet.Cos
 
 	var cost float64
 	for i := 0; i < s.Len(); i += batchSize {
-		var inSeqs, outSeqs [][]linalg.Vector
+		var inSeqs [][]linalg.Vector
+		var samples []Sample
 		for j := i; j < i+batchSize && j < s.Len(); j++ {
 			seq := s.GetSample(j).(Sample)
 			inSeqs = append(inSeqs, seq.Inputs)
-			outSeqs = append(outSeqs, seq.Outputs)
+			samples = append(samples, seq)
 		}
 		output := runner.RunAll(inSeqs)
-		for j, outSeq := range outSeqs {
+		for j, sample := range samples {
 			for t, actual := range output[j] {
-				expected := outSeq[t]
+				expected, costFunc := sample.target(t, c)
 				actualVar := &autofunc.Variable{Vector: actual}
-				cost += c.Cost(expected, actualVar).Output()[0]
+				cost += costFunc.Cost(expected, actualVar).Output()[0]
 			}
 		}
 	}
@@ -46,7 +47,7 @@ func TotalCostSeqFunc(f rnn.SeqFunc, batchSize int, s sgd.SampleSet,
 	var totalCost float64
 	for i := 0; i < s.Len(); i += batchSize {
 		var inSeqs [][]autofunc.Result
-		var outSeqs [][]linalg.Vector
+		var samples []Sample
 		for j := i; j < i+batchSize && j < s.Len(); j++ {
 			seq := s.GetSample(j).(Sample)
 			inSeq := make([]autofunc.Result, len(seq.Inputs))
@@ -54,15 +55,14 @@ func TotalCostSeqFunc(f rnn.SeqFunc, batchSize int, s sgd.SampleSet,
 				inSeq[k] = &autofunc.Variable{Vector: in}
 			}
 			inSeqs = append(inSeqs, inSeq)
-			outSeqs = append(outSeqs, seq.Outputs)
+			samples = append(samples, seq)
 		}
 		output := f.BatchSeqs(inSeqs)
 		for j, actualSeq := range output.OutputSeqs() {
-			expectedSeq := outSeqs[j]
 			for k, actual := range actualSeq {
-				expected := expectedSeq[k]
+				expected, costFunc := samples[j].target(k, c)
 				actualVar := &autofunc.Variable{Vector: actual}
-				totalCost += c.Cost(expected, actualVar).Output()[0]
+				totalCost += costFunc.Cost(expected, actualVar).Output()[0]
 			}
 		}
 	}
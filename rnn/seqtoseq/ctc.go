@@ -0,0 +1,207 @@
+package seqtoseq
+
+import (
+	"sort"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+// CTCSample is a training sample for connectionist
+// temporal classification (CTC).
+//
+// Unlike a Sample, a CTCSample does not specify an output
+// for every input.
+// Instead, it specifies a sequence of class labels which
+// is typically much shorter than the input sequence.
+// The labels should not include the blank symbol.
+type CTCSample struct {
+	Inputs []linalg.Vector
+	Label  []int
+}
+
+// A CTCGradienter computes gradients of the CTC cost for
+// a SeqFunc on sample sets full of CTCSample objects.
+// To train an rnn.Block, wrap it in an rnn.BlockSeqFunc.
+//
+// The outputs of the SeqFunc are treated as log
+// probabilities, so the SeqFunc should typically end with
+// a neuralnet.LogSoftmaxLayer.
+// Each output vector includes an entry for the blank
+// symbol, whose index is given by Blank.
+//
+// The cost of a sample is the negative log probability
+// of its label, summed over every alignment of the label
+// to the output sequence.
+// Samples whose labels cannot be aligned to their
+// outputs (i.e. whose outputs are too short) are
+// ignored.
+type CTCGradienter struct {
+	SeqFunc rnn.SeqFunc
+	Learner sgd.Learner
+	Blank   int
+
+	// MaxLanes specifies the maximum number of lanes
+	// any BlockInput or BlockRInput may have at once
+	// while computing gradients.
+	// If this is 0, a reasonable default is used.
+	MaxLanes int
+
+	// MaxGoroutines specifies the maximum number of
+	// Goroutines on which to invoke Batch or BatchR
+	// on Learner at once.
+	MaxGoroutines int
+
+	helper *neuralnet.GradHelper
+}
+
+func (c *CTCGradienter) Gradient(set sgd.SampleSet) autofunc.Gradient {
+	return c.makeHelper().Gradient(sortCTCSamples(set))
+}
+
+func (c *CTCGradienter) RGradient(v autofunc.RVector,
+	set sgd.SampleSet) (autofunc.Gradient, autofunc.RGradient) {
+	return c.makeHelper().RGradient(v, sortCTCSamples(set))
+}
+
+func (c *CTCGradienter) makeHelper() *neuralnet.GradHelper {
+	if c.helper != nil {
+		c.helper.MaxConcurrency = c.MaxGoroutines
+		c.helper.MaxSubBatch = c.MaxLanes
+		return c.helper
+	}
+	c.helper = &neuralnet.GradHelper{
+		MaxConcurrency: c.MaxGoroutines,
+		MaxSubBatch:    c.MaxLanes,
+		Learner:        c.Learner,
+		CompGrad:       c.runBatch,
+		CompRGrad:      c.runBatchR,
+	}
+	return c.helper
+}
+
+func (c *CTCGradienter) runBatch(g autofunc.Gradient, set sgd.SampleSet) {
+	samples := ctcSampleSlice(set)
+	seqIns := make([][]autofunc.Result, len(samples))
+	for i, sample := range samples {
+		ins := make([]autofunc.Result, len(sample.Inputs))
+		for j, x := range sample.Inputs {
+			ins[j] = &autofunc.Variable{Vector: x}
+		}
+		seqIns[i] = ins
+	}
+
+	output := c.SeqFunc.BatchSeqs(seqIns)
+
+	upstream := make([][]linalg.Vector, len(samples))
+	for i, outSeq := range output.OutputSeqs() {
+		upstream[i] = newCTCLattice(outSeq, samples[i].Label, c.Blank).Gradient()
+	}
+
+	output.Gradient(upstream, g)
+}
+
+func (c *CTCGradienter) runBatchR(rv autofunc.RVector, rg autofunc.RGradient,
+	g autofunc.Gradient, set sgd.SampleSet) {
+	samples := ctcSampleSlice(set)
+	seqIns := make([][]autofunc.RResult, len(samples))
+	var zeroVec linalg.Vector
+	for i, sample := range samples {
+		ins := make([]autofunc.RResult, len(sample.Inputs))
+		for j, x := range sample.Inputs {
+			variable := &autofunc.Variable{Vector: x}
+			if zeroVec == nil {
+				zeroVec = make(linalg.Vector, len(x))
+			}
+			ins[j] = &autofunc.RVariable{
+				Variable:   variable,
+				ROutputVec: zeroVec,
+			}
+		}
+		seqIns[i] = ins
+	}
+
+	output := c.SeqFunc.BatchSeqsR(rv, seqIns)
+
+	upstream := make([][]linalg.Vector, len(samples))
+	upstreamR := make([][]linalg.Vector, len(samples))
+	for i, outSeq := range output.OutputSeqs() {
+		lattice := newCTCLattice(outSeq, samples[i].Label, c.Blank)
+		upstream[i] = lattice.Gradient()
+		_, upstreamR[i] = lattice.RGradient(output.ROutputSeqs()[i])
+	}
+
+	output.RGradient(upstream, upstreamR, rg, g)
+}
+
+// TotalCostCTC runs an rnn.SeqFunc on a set of
+// CTCSamples and evaluates the total CTC cost.
+// See CTCGradienter for details on the cost.
+// Samples whose labels cannot be aligned to their
+// outputs contribute an infinite cost.
+//
+// The batchSize specifies how many samples to run in
+// batches while computing the cost.
+func TotalCostCTC(f rnn.SeqFunc, batchSize int, s sgd.SampleSet, blank int) float64 {
+	var totalCost float64
+	for i := 0; i < s.Len(); i += batchSize {
+		var inSeqs [][]autofunc.Result
+		var labels [][]int
+		for j := i; j < i+batchSize && j < s.Len(); j++ {
+			sample := s.GetSample(j).(CTCSample)
+			inSeq := make([]autofunc.Result, len(sample.Inputs))
+			for k, in := range sample.Inputs {
+				inSeq[k] = &autofunc.Variable{Vector: in}
+			}
+			inSeqs = append(inSeqs, inSeq)
+			labels = append(labels, sample.Label)
+		}
+		output := f.BatchSeqs(inSeqs)
+		for j, actualSeq := range output.OutputSeqs() {
+			totalCost += newCTCLattice(actualSeq, labels[j], blank).Cost()
+		}
+	}
+	return totalCost
+}
+
+// ctcSampleSlice converts a sample set into a slice of
+// CTCSamples.
+func ctcSampleSlice(s sgd.SampleSet) []CTCSample {
+	res := make([]CTCSample, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		res[i] = s.GetSample(i).(CTCSample)
+	}
+	return res
+}
+
+// sortCTCSamples sorts the CTCSamples in a SampleSet by
+// size, with the longest sequences coming first.
+func sortCTCSamples(s sgd.SampleSet) sgd.SampleSet {
+	origSet := ctcSampleSlice(s)
+	res := make(ctcSorter, len(origSet))
+	copy(res, origSet)
+	sort.Sort(res)
+
+	resSet := make(sgd.SliceSampleSet, len(res))
+	for i, x := range res {
+		resSet[i] = x
+	}
+	return resSet
+}
+
+type ctcSorter []CTCSample
+
+func (c ctcSorter) Len() int {
+	return len(c)
+}
+
+func (c ctcSorter) Less(i, j int) bool {
+	return len(c[i].Inputs) > len(c[j].Inputs)
+}
+
+func (c ctcSorter) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
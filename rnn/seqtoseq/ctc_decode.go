@@ -0,0 +1,147 @@
+package seqtoseq
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// CTCGreedyDecode decodes the output of a CTC model by
+// choosing the most likely symbol at every timestep,
+// merging repeated symbols, and then removing blanks.
+//
+// The outputs should be log probabilities, as described
+// for CTCGradienter.
+func CTCGreedyDecode(logProbs []linalg.Vector, blank int) []int {
+	res := []int{}
+	last := blank
+	for _, probs := range logProbs {
+		var symbol int
+		for i, x := range probs {
+			if x > probs[symbol] {
+				symbol = i
+			}
+		}
+		if symbol != blank && symbol != last {
+			res = append(res, symbol)
+		}
+		last = symbol
+	}
+	return res
+}
+
+// CTCBeamDecode decodes the output of a CTC model using
+// prefix beam search, which keeps track of the beamSize
+// most likely label prefixes at every timestep.
+//
+// Unlike CTCGreedyDecode, this accounts for the fact
+// that many alignments can produce the same label, so
+// it may find a more likely label.
+//
+// A beamSize less than 1 is treated as 1.
+// Ties between equally likely prefixes are broken
+// deterministically.
+func CTCBeamDecode(logProbs []linalg.Vector, blank, beamSize int) []int {
+	if beamSize < 1 {
+		beamSize = 1
+	}
+	beam := []*ctcBeamEntry{{
+		Label:       []int{},
+		LogBlank:    0,
+		LogNonBlank: math.Inf(-1),
+	}}
+	for _, probs := range logProbs {
+		next := newCTCBeamSet()
+		for _, entry := range beam {
+			for symbol, logProb := range probs {
+				if symbol == blank {
+					dest := next.Lookup(entry.Label)
+					dest.LogBlank = logAdd(dest.LogBlank, entry.LogTotal()+logProb)
+					continue
+				}
+				extended := append(append([]int{}, entry.Label...), symbol)
+				dest := next.Lookup(extended)
+				if len(entry.Label) > 0 && entry.Label[len(entry.Label)-1] == symbol {
+					// A repeated symbol only extends the label
+					// if a blank separates the repetitions.
+					dest.LogNonBlank = logAdd(dest.LogNonBlank, entry.LogBlank+logProb)
+					same := next.Lookup(entry.Label)
+					same.LogNonBlank = logAdd(same.LogNonBlank, entry.LogNonBlank+logProb)
+				} else {
+					dest.LogNonBlank = logAdd(dest.LogNonBlank, entry.LogTotal()+logProb)
+				}
+			}
+		}
+		beam = next.Entries
+		sort.Stable(ctcBeamSorter(beam))
+		if len(beam) > beamSize {
+			beam = beam[:beamSize]
+		}
+	}
+	return beam[0].Label
+}
+
+type ctcBeamEntry struct {
+	Label       []int
+	LogBlank    float64
+	LogNonBlank float64
+}
+
+// LogTotal returns the log probability of the prefix,
+// regardless of whether the last symbol was a blank.
+func (c *ctcBeamEntry) LogTotal() float64 {
+	return logAdd(c.LogBlank, c.LogNonBlank)
+}
+
+// ctcBeamSet stores beam entries keyed by their label
+// prefixes, remembering the order in which they were
+// created so that iteration is deterministic.
+type ctcBeamSet struct {
+	Entries []*ctcBeamEntry
+	byLabel map[string]*ctcBeamEntry
+}
+
+func newCTCBeamSet() *ctcBeamSet {
+	return &ctcBeamSet{byLabel: map[string]*ctcBeamEntry{}}
+}
+
+// Lookup finds or creates the entry for a label prefix.
+func (c *ctcBeamSet) Lookup(label []int) *ctcBeamEntry {
+	strs := make([]string, len(label))
+	for i, x := range label {
+		strs[i] = strconv.Itoa(x)
+	}
+	key := strings.Join(strs, ",")
+	if entry, ok := c.byLabel[key]; ok {
+		return entry
+	}
+	entry := &ctcBeamEntry{
+		Label:       label,
+		LogBlank:    math.Inf(-1),
+		LogNonBlank: math.Inf(-1),
+	}
+	c.byLabel[key] = entry
+	c.Entries = append(c.Entries, entry)
+	return entry
+}
+
+type ctcBeamSorter []*ctcBeamEntry
+
+func (c ctcBeamSorter) Len() int {
+	return len(c)
+}
+
+func (c ctcBeamSorter) Less(i, j int) bool {
+	return c[i].LogTotal() > c[j].LogTotal()
+}
+
+func (c ctcBeamSorter) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func logAdd(x, y float64) float64 {
+	return logSumExp([]float64{x, y})
+}
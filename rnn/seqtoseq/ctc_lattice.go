@@ -0,0 +1,276 @@
+package seqtoseq
+
+import (
+	"math"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// ctcLattice stores the forward-backward variables used
+// to compute the CTC cost of a label sequence.
+//
+// All of the probabilities are stored in log space.
+// The backward variables do not include the probability
+// of the symbol emitted at the current timestep.
+type ctcLattice struct {
+	LogProbs []linalg.Vector
+
+	// Symbols is the label sequence with a blank before,
+	// between, and after every label.
+	Symbols []int
+	Blank   int
+
+	LogAlpha [][]float64
+	LogBeta  [][]float64
+	LogProb  float64
+}
+
+func newCTCLattice(logProbs []linalg.Vector, label []int, blank int) *ctcLattice {
+	symbols := make([]int, 0, len(label)*2+1)
+	for _, x := range label {
+		symbols = append(symbols, blank, x)
+	}
+	symbols = append(symbols, blank)
+
+	res := &ctcLattice{
+		LogProbs: logProbs,
+		Symbols:  symbols,
+		Blank:    blank,
+		LogAlpha: make([][]float64, len(logProbs)),
+		LogBeta:  make([][]float64, len(logProbs)),
+	}
+	if len(logProbs) == 0 {
+		if len(label) == 0 {
+			res.LogProb = 0
+		} else {
+			res.LogProb = math.Inf(-1)
+		}
+		return res
+	}
+	res.forward()
+	res.backward()
+	return res
+}
+
+// Cost returns the negative log-likelihood of the label.
+func (c *ctcLattice) Cost() float64 {
+	return -c.LogProb
+}
+
+// Gradient computes the gradient of the cost with
+// respect to the log probabilities.
+func (c *ctcLattice) Gradient() []linalg.Vector {
+	res := c.zeroSeq()
+	if math.IsInf(c.LogProb, -1) {
+		return res
+	}
+	for t, alphas := range c.LogAlpha {
+		for s, symbol := range c.Symbols {
+			res[t][symbol] -= math.Exp(alphas[s] + c.LogBeta[t][s] - c.LogProb)
+		}
+	}
+	return res
+}
+
+// RGradient computes the derivatives of the cost and of
+// the gradient with respect to R, given the derivatives
+// of the log probabilities with respect to R.
+func (c *ctcLattice) RGradient(logProbsR []linalg.Vector) (costR float64,
+	gradR []linalg.Vector) {
+	gradR = c.zeroSeq()
+	if len(c.LogProbs) == 0 || math.IsInf(c.LogProb, -1) {
+		return
+	}
+	alphaR := c.forwardR(logProbsR)
+	betaR := c.backwardR(logProbsR)
+
+	lastT := len(c.LogProbs) - 1
+	var ends []int
+	if len(c.Symbols) > 1 {
+		ends = append(ends, len(c.Symbols)-2)
+	}
+	ends = append(ends, len(c.Symbols)-1)
+	var endLogs, endRs []float64
+	for _, s := range ends {
+		endLogs = append(endLogs, c.LogAlpha[lastT][s])
+		endRs = append(endRs, alphaR[lastT][s])
+	}
+	probR := weightedMean(endLogs, endRs)
+
+	for t, alphas := range c.LogAlpha {
+		for s, symbol := range c.Symbols {
+			occupancy := math.Exp(alphas[s] + c.LogBeta[t][s] - c.LogProb)
+			if occupancy == 0 {
+				continue
+			}
+			gradR[t][symbol] -= occupancy * (alphaR[t][s] + betaR[t][s] - probR)
+		}
+	}
+	return -probR, gradR
+}
+
+func (c *ctcLattice) forward() {
+	for t, logProbs := range c.LogProbs {
+		alphas := make([]float64, len(c.Symbols))
+		for s, symbol := range c.Symbols {
+			if t == 0 {
+				if s < 2 {
+					alphas[s] = logProbs[symbol]
+				} else {
+					alphas[s] = math.Inf(-1)
+				}
+				continue
+			}
+			var preds []float64
+			for _, p := range c.predecessors(s) {
+				preds = append(preds, c.LogAlpha[t-1][p])
+			}
+			alphas[s] = logProbs[symbol] + logSumExp(preds)
+		}
+		c.LogAlpha[t] = alphas
+	}
+
+	lastT := len(c.LogProbs) - 1
+	var ends []float64
+	for s := len(c.Symbols) - 2; s < len(c.Symbols); s++ {
+		if s >= 0 {
+			ends = append(ends, c.LogAlpha[lastT][s])
+		}
+	}
+	c.LogProb = logSumExp(ends)
+}
+
+func (c *ctcLattice) backward() {
+	for t := len(c.LogProbs) - 1; t >= 0; t-- {
+		betas := make([]float64, len(c.Symbols))
+		for s := range c.Symbols {
+			if t == len(c.LogProbs)-1 {
+				if s >= len(c.Symbols)-2 {
+					betas[s] = 0
+				} else {
+					betas[s] = math.Inf(-1)
+				}
+				continue
+			}
+			var succs []float64
+			for _, n := range c.successors(s) {
+				succs = append(succs, c.LogProbs[t+1][c.Symbols[n]]+c.LogBeta[t+1][n])
+			}
+			betas[s] = logSumExp(succs)
+		}
+		c.LogBeta[t] = betas
+	}
+}
+
+// forwardR computes the derivatives of the forward
+// variables with respect to R, divided by the forward
+// variables themselves.
+func (c *ctcLattice) forwardR(logProbsR []linalg.Vector) [][]float64 {
+	res := make([][]float64, len(c.LogProbs))
+	for t, probsR := range logProbsR {
+		res[t] = make([]float64, len(c.Symbols))
+		for s, symbol := range c.Symbols {
+			res[t][s] = probsR[symbol]
+			if t == 0 {
+				continue
+			}
+			var logs, rs []float64
+			for _, p := range c.predecessors(s) {
+				logs = append(logs, c.LogAlpha[t-1][p])
+				rs = append(rs, res[t-1][p])
+			}
+			res[t][s] += weightedMean(logs, rs)
+		}
+	}
+	return res
+}
+
+// backwardR is like forwardR, but for the backward
+// variables.
+func (c *ctcLattice) backwardR(logProbsR []linalg.Vector) [][]float64 {
+	res := make([][]float64, len(c.LogProbs))
+	for t := len(c.LogProbs) - 1; t >= 0; t-- {
+		res[t] = make([]float64, len(c.Symbols))
+		if t == len(c.LogProbs)-1 {
+			continue
+		}
+		for s := range c.Symbols {
+			var logs, rs []float64
+			for _, n := range c.successors(s) {
+				symbol := c.Symbols[n]
+				logs = append(logs, c.LogProbs[t+1][symbol]+c.LogBeta[t+1][n])
+				rs = append(rs, logProbsR[t+1][symbol]+res[t+1][n])
+			}
+			res[t][s] = weightedMean(logs, rs)
+		}
+	}
+	return res
+}
+
+// predecessors returns the lattice states which can
+// transition to state s.
+func (c *ctcLattice) predecessors(s int) []int {
+	res := []int{s}
+	if s > 0 {
+		res = append(res, s-1)
+	}
+	if s > 1 && c.Symbols[s] != c.Blank && c.Symbols[s] != c.Symbols[s-2] {
+		res = append(res, s-2)
+	}
+	return res
+}
+
+// successors returns the lattice states to which state
+// s can transition.
+func (c *ctcLattice) successors(s int) []int {
+	res := []int{s}
+	if s+1 < len(c.Symbols) {
+		res = append(res, s+1)
+	}
+	if s+2 < len(c.Symbols) && c.Symbols[s+2] != c.Blank &&
+		c.Symbols[s+2] != c.Symbols[s] {
+		res = append(res, s+2)
+	}
+	return res
+}
+
+func (c *ctcLattice) zeroSeq() []linalg.Vector {
+	res := make([]linalg.Vector, len(c.LogProbs))
+	for i, x := range c.LogProbs {
+		res[i] = make(linalg.Vector, len(x))
+	}
+	return res
+}
+
+func logSumExp(logs []float64) float64 {
+	max := math.Inf(-1)
+	for _, x := range logs {
+		max = math.Max(max, x)
+	}
+	if math.IsInf(max, -1) {
+		return max
+	}
+	var sum float64
+	for _, x := range logs {
+		sum += math.Exp(x - max)
+	}
+	return max + math.Log(sum)
+}
+
+// weightedMean computes the mean of values, weighting
+// each value by the exponential of its corresponding
+// log weight.
+// It returns 0 if every weight is 0.
+func weightedMean(logWeights, values []float64) float64 {
+	total := logSumExp(logWeights)
+	if math.IsInf(total, -1) {
+		return 0
+	}
+	var res float64
+	for i, x := range logWeights {
+		if w := math.Exp(x - total); w != 0 {
+			res += w * values[i]
+		}
+	}
+	return res
+}
@@ -0,0 +1,324 @@
+package seqtoseq
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+const (
+	ctcTestDelta = 1e-5
+	ctcTestPrec  = 1e-4
+)
+
+func TestCTCCost(t *testing.T) {
+	labels := [][]int{{1, 2}, {1, 1}, {}, {2}, {1, 2, 1, 2}}
+	for _, label := range labels {
+		logProbs := randomLogProbs(4, 3)
+		actual := newCTCLattice(logProbs, label, 0).Cost()
+		expected := bruteForceCTCCost(logProbs, label, 0)
+		if math.IsInf(expected, 1) {
+			if !math.IsInf(actual, 1) {
+				t.Errorf("label %v: expected infinite cost but got %f", label, actual)
+			}
+		} else if math.Abs(actual-expected) > 1e-8 {
+			t.Errorf("label %v: expected %f but got %f", label, expected, actual)
+		}
+	}
+}
+
+func TestCTCGradient(t *testing.T) {
+	for _, label := range [][]int{{2, 1, 2}, {1, 1}, {}} {
+		logProbs := randomLogProbs(7, 4)
+		lattice := newCTCLattice(logProbs, label, 3)
+		actual := lattice.Gradient()
+		for i, vec := range logProbs {
+			for j := range vec {
+				old := vec[j]
+				vec[j] = old + ctcTestDelta
+				plus := newCTCLattice(logProbs, label, 3).Cost()
+				vec[j] = old - ctcTestDelta
+				minus := newCTCLattice(logProbs, label, 3).Cost()
+				vec[j] = old
+				expected := (plus - minus) / (2 * ctcTestDelta)
+				if math.Abs(actual[i][j]-expected) > ctcTestPrec {
+					t.Errorf("label %v: entry %d,%d should be %f but got %f", label,
+						i, j, expected, actual[i][j])
+				}
+			}
+		}
+	}
+}
+
+func TestCTCRGradient(t *testing.T) {
+	for _, label := range [][]int{{2, 1, 2}, {1, 1}, {}} {
+		logProbs := randomLogProbs(7, 4)
+		logProbsR := randomLogProbs(7, 4)
+		lattice := newCTCLattice(logProbs, label, 0)
+		costR, gradR := lattice.RGradient(logProbsR)
+
+		offset := func(scale float64) []linalg.Vector {
+			res := make([]linalg.Vector, len(logProbs))
+			for i, x := range logProbs {
+				res[i] = x.Copy().Add(logProbsR[i].Copy().Scale(scale))
+			}
+			return res
+		}
+		plus := newCTCLattice(offset(ctcTestDelta), label, 0)
+		minus := newCTCLattice(offset(-ctcTestDelta), label, 0)
+
+		expectedCostR := (plus.Cost() - minus.Cost()) / (2 * ctcTestDelta)
+		if math.Abs(costR-expectedCostR) > ctcTestPrec {
+			t.Errorf("label %v: cost R should be %f but got %f", label,
+				expectedCostR, costR)
+		}
+		plusGrad := plus.Gradient()
+		minusGrad := minus.Gradient()
+		for i, vec := range gradR {
+			for j, actual := range vec {
+				expected := (plusGrad[i][j] - minusGrad[i][j]) / (2 * ctcTestDelta)
+				if math.Abs(actual-expected) > ctcTestPrec {
+					t.Errorf("label %v: entry %d,%d should be %f but got %f", label,
+						i, j, expected, actual)
+				}
+			}
+		}
+	}
+}
+
+func TestCTCGradienter(t *testing.T) {
+	block := rnn.NewLSTM(3, 4)
+	seqFunc := &rnn.BlockSeqFunc{Block: block}
+	samples := sgd.SliceSampleSet{}
+	for i := 0; i < 5; i++ {
+		var sample CTCSample
+		for j := 0; j < i+3; j++ {
+			input := make(linalg.Vector, 3)
+			for k := range input {
+				input[k] = rand.NormFloat64()
+			}
+			sample.Inputs = append(sample.Inputs, input)
+		}
+		for j := 0; j < i/2+1; j++ {
+			sample.Label = append(sample.Label, rand.Intn(3)+1)
+		}
+		samples = append(samples, sample)
+	}
+	g := &CTCGradienter{
+		SeqFunc:  seqFunc,
+		Learner:  block,
+		Blank:    0,
+		MaxLanes: 2,
+	}
+	rv := autofunc.RVector(autofunc.NewGradient(block.Parameters()))
+	for _, v := range rv {
+		for i := range v {
+			v[i] = rand.NormFloat64()
+		}
+	}
+
+	grad := copyGrad(g.Gradient(samples))
+	for _, param := range block.Parameters() {
+		for i := range param.Vector {
+			old := param.Vector[i]
+			param.Vector[i] = old + ctcTestDelta
+			plus := TotalCostCTC(seqFunc, 2, samples, 0)
+			param.Vector[i] = old - ctcTestDelta
+			minus := TotalCostCTC(seqFunc, 2, samples, 0)
+			param.Vector[i] = old
+			expected := (plus - minus) / (2 * ctcTestDelta)
+			if actual := grad[param][i]; math.Abs(actual-expected) > ctcTestPrec {
+				t.Fatalf("gradient: expected %f but got %f", expected, actual)
+			}
+		}
+	}
+
+	_, rgrad := g.RGradient(rv, samples)
+	rgrad = autofunc.RGradient(copyGrad(autofunc.Gradient(rgrad)))
+	for _, param := range block.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(ctcTestDelta))
+	}
+	plusGrad := copyGrad(g.Gradient(samples))
+	for _, param := range block.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(-2 * ctcTestDelta))
+	}
+	minusGrad := copyGrad(g.Gradient(samples))
+	for _, param := range block.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(ctcTestDelta))
+		for i, actual := range rgrad[param] {
+			expected := (plusGrad[param][i] - minusGrad[param][i]) / (2 * ctcTestDelta)
+			if math.Abs(actual-expected) > ctcTestPrec {
+				t.Fatalf("r-gradient: expected %f but got %f", expected, actual)
+			}
+		}
+	}
+}
+
+func TestCTCGreedyDecode(t *testing.T) {
+	probs := []linalg.Vector{
+		{0.1, 0.8, 0.1},
+		{0.1, 0.8, 0.1},
+		{0.8, 0.1, 0.1},
+		{0.1, 0.8, 0.1},
+		{0.1, 0.1, 0.8},
+		{0.8, 0.1, 0.1},
+	}
+	logProbs := make([]linalg.Vector, len(probs))
+	for i, vec := range probs {
+		logProbs[i] = make(linalg.Vector, len(vec))
+		for j, x := range vec {
+			logProbs[i][j] = math.Log(x)
+		}
+	}
+	actual := CTCGreedyDecode(logProbs, 0)
+	expected := []int{1, 1, 2}
+	if !labelsEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestCTCBeamDecode(t *testing.T) {
+	logProbs := []linalg.Vector{
+		{math.Log(0.6), math.Log(0.4)},
+		{math.Log(0.6), math.Log(0.4)},
+	}
+	if actual := CTCGreedyDecode(logProbs, 0); len(actual) != 0 {
+		t.Errorf("greedy decode gave %v", actual)
+	}
+	if actual := CTCBeamDecode(logProbs, 0, 4); !labelsEqual(actual, []int{1}) {
+		t.Errorf("beam decode gave %v", actual)
+	}
+
+	for i := 0; i < 10; i++ {
+		logProbs := randomLogProbs(5, 3)
+		actual := CTCBeamDecode(logProbs, 0, 100)
+		bestCost := math.Inf(1)
+		var best []int
+		for _, label := range allLabels(2, 5) {
+			if cost := bruteForceCTCCost(logProbs, label, 0); cost < bestCost {
+				bestCost = cost
+				best = label
+			}
+		}
+		if !labelsEqual(actual, best) {
+			t.Errorf("expected %v but got %v", best, actual)
+		}
+	}
+}
+
+func TestCTCBeamDecodeEdgeCases(t *testing.T) {
+	logProbs := randomLogProbs(6, 4)
+	expected := CTCBeamDecode(logProbs, 0, 1)
+	for _, beamSize := range []int{0, -3} {
+		if actual := CTCBeamDecode(logProbs, 0, beamSize); !labelsEqual(actual, expected) {
+			t.Errorf("beam size %d: expected %v but got %v", beamSize, expected, actual)
+		}
+	}
+
+	// With uniform probabilities, every beam is tied.
+	uniform := make([]linalg.Vector, 4)
+	for i := range uniform {
+		uniform[i] = linalg.Vector{math.Log(1.0 / 3), math.Log(1.0 / 3), math.Log(1.0 / 3)}
+	}
+	expected = CTCBeamDecode(uniform, 0, 3)
+	for i := 0; i < 20; i++ {
+		if actual := CTCBeamDecode(uniform, 0, 3); !labelsEqual(actual, expected) {
+			t.Fatalf("nondeterministic result: %v then %v", expected, actual)
+		}
+	}
+}
+
+func randomLogProbs(length, size int) []linalg.Vector {
+	res := make([]linalg.Vector, length)
+	for i := range res {
+		res[i] = make(linalg.Vector, size)
+		var sum float64
+		for j := range res[i] {
+			res[i][j] = rand.NormFloat64()
+			sum += math.Exp(res[i][j])
+		}
+		for j := range res[i] {
+			res[i][j] -= math.Log(sum)
+		}
+	}
+	return res
+}
+
+// bruteForceCTCCost computes the CTC cost by summing
+// over every path through the outputs.
+func bruteForceCTCCost(logProbs []linalg.Vector, label []int, blank int) float64 {
+	var prob float64
+	var paths func(prefix []int)
+	paths = func(prefix []int) {
+		if len(prefix) == len(logProbs) {
+			if labelsEqual(collapsePath(prefix, blank), label) {
+				var logProb float64
+				for t, symbol := range prefix {
+					logProb += logProbs[t][symbol]
+				}
+				prob += math.Exp(logProb)
+			}
+			return
+		}
+		for symbol := range logProbs[len(prefix)] {
+			paths(append(append([]int{}, prefix...), symbol))
+		}
+	}
+	paths(nil)
+	return -math.Log(prob)
+}
+
+func collapsePath(path []int, blank int) []int {
+	res := []int{}
+	last := blank
+	for _, x := range path {
+		if x != blank && x != last {
+			res = append(res, x)
+		}
+		last = x
+	}
+	return res
+}
+
+// allLabels lists every label with symbols 1 through
+// symbolCount and length at most maxLen.
+func allLabels(symbolCount, maxLen int) [][]int {
+	res := [][]int{{}}
+	last := [][]int{{}}
+	for i := 0; i < maxLen; i++ {
+		var next [][]int
+		for _, label := range last {
+			for s := 1; s <= symbolCount; s++ {
+				next = append(next, append(append([]int{}, label...), s))
+			}
+		}
+		res = append(res, next...)
+		last = next
+	}
+	return res
+}
+
+func labelsEqual(l1, l2 []int) bool {
+	if len(l1) != len(l2) {
+		return false
+	}
+	for i, x := range l1 {
+		if l2[i] != x {
+			return false
+		}
+	}
+	return true
+}
+
+func copyGrad(g autofunc.Gradient) autofunc.Gradient {
+	res := autofunc.Gradient{}
+	for k, v := range g {
+		res[k] = v.Copy()
+	}
+	return res
+}
@@ -1,9 +1,16 @@
 // Package seqtoseq implements gradient-based training
 // for models which take an input sequence and produce
 // an output sequence of the same length.
+//
+// It also supports connectionist temporal classification
+// (CTC), for models whose outputs are label sequences
+// with no known alignment to the inputs.
 package seqtoseq
 
-import "github.com/unixpickle/num-analysis/linalg"
+import (
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/neuralnet"
+)
 
 // Sample is a training sample containing an input
 // sequence and its corresponding output sequence.
@@ -12,4 +19,23 @@ import "github.com/unixpickle/num-analysis/linalg"
 type Sample struct {
 	Inputs  []linalg.Vector
 	Outputs []linalg.Vector
+
+	// Masks, if non-nil, specifies which components of
+	// each output to train on, as in the Mask field of
+	// neuralnet.VectorSample.
+	// A nil mask at any timestep means that the entire
+	// output at that timestep is used.
+	// An all-zero mask means that the timestep is not
+	// supervised at all.
+	Masks []linalg.Vector
+}
+
+// target returns the desired output at the given
+// timestep, along with a cost function that accounts
+// for the timestep's mask.
+func (s Sample) target(t int, c neuralnet.CostFunc) (linalg.Vector, neuralnet.CostFunc) {
+	if t >= len(s.Masks) || s.Masks[t] == nil {
+		return s.Outputs[t], c
+	}
+	return neuralnet.MaskOutput(s.Outputs[t], s.Masks[t]), &neuralnet.MaskedCost{CostFunc: c}
 }
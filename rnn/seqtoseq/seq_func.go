@@ -70,10 +70,9 @@ func (s *SeqFuncGradienter) runBatch(g autofunc.Gradient, set sgd.SampleSet) {
 	upstream := make([][]linalg.Vector, len(seqIns))
 	for i, outSeq := range output.OutputSeqs() {
 		us := make([]linalg.Vector, len(outSeq))
-		expectedSeq := seqs[i].Outputs
 		for j, actual := range outSeq {
-			expected := expectedSeq[j]
-			us[j] = costFuncDeriv(s.CostFunc, expected, actual)
+			expected, costFunc := seqs[i].target(j, s.CostFunc)
+			us[j] = costFuncDeriv(costFunc, expected, actual)
 		}
 		upstream[i] = us
 	}
@@ -109,10 +108,9 @@ func (s *SeqFuncGradienter) runBatchR(rv autofunc.RVector, rg autofunc.RGradient
 		rOutSeq := output.ROutputSeqs()[i]
 		us := make([]linalg.Vector, len(outSeq))
 		usR := make([]linalg.Vector, len(outSeq))
-		expectedSeq := seqs[i].Outputs
 		for j, actual := range outSeq {
-			expected := expectedSeq[j]
-			us[j], usR[j] = costFuncRDeriv(s.CostFunc, expected, actual, rOutSeq[j])
+			expected, costFunc := seqs[i].target(j, s.CostFunc)
+			us[j], usR[j] = costFuncRDeriv(costFunc, expected, actual, rOutSeq[j])
 		}
 		upstream[i] = us
 		upstreamR[i] = usR
@@ -111,8 +111,8 @@ func (s *seqProp) BackPropagate(g autofunc.Gradient, headSize, tailSize int) {
 		upstream.Outputs = nil
 		if i >= lowHead {
 			for lane, output := range mem.Output.Outputs() {
-				desiredOut := mem.InSeqs[lane].Outputs[0]
-				outGrad := costFuncDeriv(s.CostFunc, desiredOut, output)
+				desiredOut, costFunc := mem.InSeqs[lane].target(0, s.CostFunc)
+				outGrad := costFuncDeriv(costFunc, desiredOut, output)
 				upstream.Outputs = append(upstream.Outputs, outGrad)
 			}
 		}
@@ -241,8 +241,8 @@ func (s *seqRProp) BackPropagate(g autofunc.Gradient, rg autofunc.RGradient,
 		if i >= lowHead {
 			rout := mem.Output.ROutputs()
 			for lane, output := range mem.Output.Outputs() {
-				desiredOut := mem.InSeqs[lane].Outputs[0]
-				d, rd := costFuncRDeriv(s.CostFunc, desiredOut, output, rout[lane])
+				desiredOut, costFunc := mem.InSeqs[lane].target(0, s.CostFunc)
+				d, rd := costFuncRDeriv(costFunc, desiredOut, output, rout[lane])
 				upstream.Outputs = append(upstream.Outputs, d)
 				upstream.ROutputs = append(upstream.ROutputs, rd)
 			}
@@ -343,6 +343,9 @@ func removeFirst(seqs []Sample) []Sample {
 			continue
 		}
 		s := Sample{Inputs: seq.Inputs[1:], Outputs: seq.Outputs[1:]}
+		if len(seq.Masks) > 0 {
+			s.Masks = seq.Masks[1:]
+		}
 		nextSeqs = append(nextSeqs, s)
 	}
 	return nextSeqs
@@ -13,6 +13,10 @@ const (
 	serializerTypeNetworkSeqFunc = serializerPrefix + "NetworkSeqFunc"
 	serializerTypeBidirectional  = serializerPrefix + "Bidirectional"
 	serializerTypeStateOutBlock  = serializerPrefix + "StateOutBlock"
+	serializerTypeSelfAttention  = serializerPrefix + "SelfAttention"
+
+	serializerTypeTransformerLayer   = serializerPrefix + "TransformerLayer"
+	serializerTypeTransformerEncoder = serializerPrefix + "TransformerEncoder"
 )
 
 func init() {
@@ -25,4 +29,9 @@ func init() {
 	serializer.RegisterTypedDeserializer(serializerTypeNetworkSeqFunc, DeserializeNetworkSeqFunc)
 	serializer.RegisterTypedDeserializer(serializerTypeBidirectional, DeserializeBidirectional)
 	serializer.RegisterTypedDeserializer(serializerTypeStateOutBlock, DeserializeStateOutBlock)
+	serializer.RegisterTypedDeserializer(serializerTypeSelfAttention, DeserializeSelfAttention)
+	serializer.RegisterTypedDeserializer(serializerTypeTransformerLayer,
+		DeserializeTransformerLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeTransformerEncoder,
+		DeserializeTransformerEncoder)
 }
@@ -0,0 +1,347 @@
+package rnn
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+// TransformerLayer is one layer of a TransformerEncoder.
+//
+// A layer applies self-attention followed by a
+// position-wise feedforward network.
+// Each of these sub-layers is wrapped in a residual
+// connection and followed by layer normalization.
+type TransformerLayer struct {
+	Attention       *SelfAttention
+	AttentionNorm   *neuralnet.LayerNorm
+	FeedForward     neuralnet.Network
+	FeedForwardNorm *neuralnet.LayerNorm
+}
+
+// NewTransformerLayer creates a TransformerLayer with
+// random weights.
+// The feedforward network has one hidden layer of
+// ReLU units.
+func NewTransformerLayer(modelSize, headCount, feedForwardSize int) *TransformerLayer {
+	ff := neuralnet.Network{
+		&neuralnet.DenseLayer{InputCount: modelSize, OutputCount: feedForwardSize},
+		&neuralnet.ReLU{},
+		&neuralnet.DenseLayer{InputCount: feedForwardSize, OutputCount: modelSize},
+	}
+	ff.Randomize()
+	return &TransformerLayer{
+		Attention:       NewSelfAttention(modelSize, headCount),
+		AttentionNorm:   neuralnet.NewLayerNorm(modelSize),
+		FeedForward:     ff,
+		FeedForwardNorm: neuralnet.NewLayerNorm(modelSize),
+	}
+}
+
+// DeserializeTransformerLayer deserializes a
+// TransformerLayer.
+func DeserializeTransformerLayer(d []byte) (*TransformerLayer, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) != 4 {
+		return nil, errors.New("invalid TransformerLayer slice length")
+	}
+	attention, ok1 := slice[0].(*SelfAttention)
+	attentionNorm, ok2 := slice[1].(*neuralnet.LayerNorm)
+	ff, ok3 := slice[2].(neuralnet.Network)
+	ffNorm, ok4 := slice[3].(*neuralnet.LayerNorm)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, errors.New("invalid TransformerLayer slice types")
+	}
+	return &TransformerLayer{
+		Attention:       attention,
+		AttentionNorm:   attentionNorm,
+		FeedForward:     ff,
+		FeedForwardNorm: ffNorm,
+	}, nil
+}
+
+// BatchSeqs applies the layer to each sequence.
+func (t *TransformerLayer) BatchSeqs(seqs [][]autofunc.Result) ResultSeqs {
+	joined, lengths := packSeqs(seqs)
+	if joined == nil {
+		return &packedSeqsResult{PackedOut: make([][]linalg.Vector, len(seqs))}
+	}
+	return newPackedSeqsResult(t.applyPacked(joined, lengths), lengths)
+}
+
+// BatchSeqsR is like BatchSeqs, but with R-operator
+// support.
+func (t *TransformerLayer) BatchSeqsR(rv autofunc.RVector,
+	seqs [][]autofunc.RResult) RResultSeqs {
+	joined, lengths := packSeqsR(seqs)
+	if joined == nil {
+		return &packedSeqsRResult{
+			PackedOut:  make([][]linalg.Vector, len(seqs)),
+			RPackedOut: make([][]linalg.Vector, len(seqs)),
+		}
+	}
+	return newPackedSeqsRResult(t.applyPackedR(rv, joined, lengths), lengths)
+}
+
+// Parameters returns the parameters of the attention
+// sub-layer, its normalization, the feedforward network,
+// and its normalization, in that order.
+func (t *TransformerLayer) Parameters() []*autofunc.Variable {
+	res := t.Attention.Parameters()
+	res = append(res, t.AttentionNorm.Parameters()...)
+	res = append(res, t.FeedForward.Parameters()...)
+	return append(res, t.FeedForwardNorm.Parameters()...)
+}
+
+// SerializerType returns the unique ID used to serialize
+// TransformerLayer instances with the serializer package.
+func (t *TransformerLayer) SerializerType() string {
+	return serializerTypeTransformerLayer
+}
+
+// Serialize serializes the layer.
+func (t *TransformerLayer) Serialize() ([]byte, error) {
+	slist := []serializer.Serializer{
+		t.Attention,
+		t.AttentionNorm,
+		t.FeedForward,
+		t.FeedForwardNorm,
+	}
+	return serializer.SerializeSlice(slist)
+}
+
+func (t *TransformerLayer) applyPacked(in autofunc.Result, lengths []int) autofunc.Result {
+	n := len(in.Output()) / t.AttentionNorm.InputCount
+	return autofunc.Pool(in, func(in autofunc.Result) autofunc.Result {
+		attended := autofunc.Add(in, t.Attention.applyPacked(in, lengths))
+		normed := t.AttentionNorm.Batch(attended, n)
+		ff := &neuralnet.Residual{Body: t.FeedForward}
+		return t.FeedForwardNorm.Batch(ff.Batch(normed, n), n)
+	})
+}
+
+func (t *TransformerLayer) applyPackedR(rv autofunc.RVector, in autofunc.RResult,
+	lengths []int) autofunc.RResult {
+	n := len(in.Output()) / t.AttentionNorm.InputCount
+	return autofunc.PoolR(in, func(in autofunc.RResult) autofunc.RResult {
+		attended := autofunc.AddR(in, t.Attention.applyPackedR(rv, in, lengths))
+		normed := t.AttentionNorm.BatchR(rv, attended, n)
+		ff := &neuralnet.Residual{Body: t.FeedForward}
+		return t.FeedForwardNorm.BatchR(rv, ff.BatchR(rv, normed, n), n)
+	})
+}
+
+// TransformerEncoder is a SeqFunc which adds positional
+// encodings to its input sequences and feeds them through
+// a stack of TransformerLayers, as described in
+// https://arxiv.org/abs/1706.03762.
+//
+// By default, the fixed sinusoidal positional encodings
+// from the paper are used.
+// If LearnedPositions is non-nil, it stores a learned
+// encoding for each timestep instead, in which case the
+// encoder cannot process sequences which are longer than
+// the number of learned encodings.
+//
+// A decoder-style stack which cannot look ahead can be
+// made by setting Causal on every layer's Attention.
+type TransformerEncoder struct {
+	ModelSize int
+	Layers    []*TransformerLayer
+
+	LearnedPositions *autofunc.Variable
+}
+
+// NewTransformerEncoder creates a TransformerEncoder with
+// randomly initialized layers and sinusoidal positional
+// encodings.
+func NewTransformerEncoder(modelSize, headCount, feedForwardSize,
+	layerCount int) *TransformerEncoder {
+	res := &TransformerEncoder{ModelSize: modelSize}
+	for i := 0; i < layerCount; i++ {
+		layer := NewTransformerLayer(modelSize, headCount, feedForwardSize)
+		res.Layers = append(res.Layers, layer)
+	}
+	return res
+}
+
+// DeserializeTransformerEncoder deserializes a
+// TransformerEncoder.
+func DeserializeTransformerEncoder(d []byte) (*TransformerEncoder, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) < 2 {
+		return nil, errors.New("invalid TransformerEncoder slice length")
+	}
+	modelSize, ok1 := slice[0].(serializer.Int)
+	positionData, ok2 := slice[1].(serializer.Bytes)
+	if !ok1 || !ok2 {
+		return nil, errors.New("invalid TransformerEncoder slice types")
+	}
+	res := &TransformerEncoder{ModelSize: int(modelSize)}
+	if err := json.Unmarshal(positionData, &res.LearnedPositions); err != nil {
+		return nil, err
+	}
+	for _, x := range slice[2:] {
+		layer, ok := x.(*TransformerLayer)
+		if !ok {
+			return nil, errors.New("invalid TransformerEncoder slice types")
+		}
+		res.Layers = append(res.Layers, layer)
+	}
+	return res, nil
+}
+
+// LearnPositions switches the encoder to learned
+// positional encodings, randomly initializing an
+// encoding for each of the first maxLen timesteps.
+func (t *TransformerEncoder) LearnPositions(maxLen int) {
+	t.LearnedPositions = &autofunc.Variable{
+		Vector: make(linalg.Vector, maxLen*t.ModelSize),
+	}
+	for i := range t.LearnedPositions.Vector {
+		t.LearnedPositions.Vector[i] = rand.NormFloat64() * 0.1
+	}
+}
+
+// BatchSeqs applies the encoder to each sequence.
+func (t *TransformerEncoder) BatchSeqs(seqs [][]autofunc.Result) ResultSeqs {
+	joined, lengths := packSeqs(seqs)
+	if joined == nil {
+		return &packedSeqsResult{PackedOut: make([][]linalg.Vector, len(seqs))}
+	}
+	out := autofunc.Add(joined, t.positions(lengths))
+	for _, layer := range t.Layers {
+		out = layer.applyPacked(out, lengths)
+	}
+	return newPackedSeqsResult(out, lengths)
+}
+
+// BatchSeqsR is like BatchSeqs, but with R-operator
+// support.
+func (t *TransformerEncoder) BatchSeqsR(rv autofunc.RVector,
+	seqs [][]autofunc.RResult) RResultSeqs {
+	joined, lengths := packSeqsR(seqs)
+	if joined == nil {
+		return &packedSeqsRResult{
+			PackedOut:  make([][]linalg.Vector, len(seqs)),
+			RPackedOut: make([][]linalg.Vector, len(seqs)),
+		}
+	}
+	out := autofunc.AddR(joined, t.positionsR(rv, lengths))
+	for _, layer := range t.Layers {
+		out = layer.applyPackedR(rv, out, lengths)
+	}
+	return newPackedSeqsRResult(out, lengths)
+}
+
+// Parameters returns the learned positional encodings
+// (if there are any) followed by the parameters of every
+// layer.
+func (t *TransformerEncoder) Parameters() []*autofunc.Variable {
+	var res []*autofunc.Variable
+	if t.LearnedPositions != nil {
+		res = append(res, t.LearnedPositions)
+	}
+	for _, layer := range t.Layers {
+		res = append(res, layer.Parameters()...)
+	}
+	return res
+}
+
+// SerializerType returns the unique ID used to serialize
+// TransformerEncoder instances with the serializer
+// package.
+func (t *TransformerEncoder) SerializerType() string {
+	return serializerTypeTransformerEncoder
+}
+
+// Serialize serializes the encoder.
+func (t *TransformerEncoder) Serialize() ([]byte, error) {
+	positionData, err := json.Marshal(t.LearnedPositions)
+	if err != nil {
+		return nil, err
+	}
+	slist := []serializer.Serializer{
+		serializer.Int(t.ModelSize),
+		serializer.Bytes(positionData),
+	}
+	for _, layer := range t.Layers {
+		slist = append(slist, layer)
+	}
+	return serializer.SerializeSlice(slist)
+}
+
+// positions generates the positional encodings for a
+// packed batch of sequences.
+func (t *TransformerEncoder) positions(lengths []int) autofunc.Result {
+	if t.LearnedPositions == nil {
+		return &autofunc.Variable{Vector: t.sinusoids(lengths)}
+	}
+	return autofunc.Pool(t.LearnedPositions, func(p autofunc.Result) autofunc.Result {
+		var rows []autofunc.Result
+		t.forEachTimestep(lengths, func(time int) {
+			rows = append(rows, autofunc.Slice(p, time*t.ModelSize,
+				(time+1)*t.ModelSize))
+		})
+		return autofunc.Concat(rows...)
+	})
+}
+
+// positionsR is like positions, but for RResults.
+func (t *TransformerEncoder) positionsR(rv autofunc.RVector,
+	lengths []int) autofunc.RResult {
+	if t.LearnedPositions == nil {
+		v := &autofunc.Variable{Vector: t.sinusoids(lengths)}
+		return autofunc.NewRVariable(v, rv)
+	}
+	learned := autofunc.NewRVariable(t.LearnedPositions, rv)
+	return autofunc.PoolR(learned, func(p autofunc.RResult) autofunc.RResult {
+		var rows []autofunc.RResult
+		t.forEachTimestep(lengths, func(time int) {
+			rows = append(rows, autofunc.SliceR(p, time*t.ModelSize,
+				(time+1)*t.ModelSize))
+		})
+		return autofunc.ConcatR(rows...)
+	})
+}
+
+func (t *TransformerEncoder) forEachTimestep(lengths []int, f func(time int)) {
+	maxLen := len(t.LearnedPositions.Vector) / t.ModelSize
+	for _, length := range lengths {
+		if length > maxLen {
+			panic("sequence is longer than the learned positions")
+		}
+		for time := 0; time < length; time++ {
+			f(time)
+		}
+	}
+}
+
+func (t *TransformerEncoder) sinusoids(lengths []int) linalg.Vector {
+	var res linalg.Vector
+	for _, length := range lengths {
+		for time := 0; time < length; time++ {
+			for i := 0; i < t.ModelSize; i++ {
+				freq := math.Pow(10000, -float64(i-i%2)/float64(t.ModelSize))
+				if i%2 == 0 {
+					res = append(res, math.Sin(float64(time)*freq))
+				} else {
+					res = append(res, math.Cos(float64(time)*freq))
+				}
+			}
+		}
+	}
+	return res
+}
@@ -22,6 +22,10 @@ type SubgradientSolver struct {
 	// Values closer to 0 will result in better accuracy, while values closer to 1 will cause the
 	// solver to approach the solution in fewer steps.
 	StepSize float64
+
+	// StepSizeFunc, if non-nil, is used in place of StepSize to compute the step size for each
+	// step, where the first step is 0.
+	StepSizeFunc func(step int) float64
 }
 
 func (s *SubgradientSolver) Solve(p *Problem) *LinearClassifier {
@@ -30,7 +34,7 @@ func (s *SubgradientSolver) Solve(p *Problem) *LinearClassifier {
 	}
 
 	for i := 0; i < s.Steps; i++ {
-		args = s.descend(p, args)
+		args = s.descend(p, args, s.stepSize(i))
 	}
 
 	return &LinearClassifier{
@@ -40,14 +44,22 @@ func (s *SubgradientSolver) Solve(p *Problem) *LinearClassifier {
 	}
 }
 
-func (s *SubgradientSolver) descend(p *Problem, args softMarginArgs) softMarginArgs {
+func (s *SubgradientSolver) stepSize(step int) float64 {
+	if s.StepSizeFunc != nil {
+		return s.StepSizeFunc(step)
+	}
+	return s.StepSize
+}
+
+func (s *SubgradientSolver) descend(p *Problem, args softMarginArgs,
+	stepSize float64) softMarginArgs {
 	res := args
 	res.normal = make([]float64, len(args.normal))
 	copy(res.normal, args.normal)
 
-	res.threshold -= s.thresholdPartial(p, args) * s.StepSize
+	res.threshold -= s.thresholdPartial(p, args) * stepSize
 	for i := range res.normal {
-		res.normal[i] -= s.normalPartial(p, args, i) * s.StepSize
+		res.normal[i] -= s.normalPartial(p, args, i) * stepSize
 	}
 
 	return res